@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/pitoniak32/trace-export/pkg/backfill"
+	"github.com/pitoniak32/trace-export/pkg/cache"
+	"github.com/pitoniak32/trace-export/pkg/config"
+	ig "github.com/pitoniak32/trace-export/pkg/github"
+)
+
+const TRACE_EXPORT_BACKFILL_REPOS_KEY string = "TRACE_EXPORT_BACKFILL_REPOS"
+const TRACE_EXPORT_BACKFILL_ORG_KEY string = "TRACE_EXPORT_BACKFILL_ORG"
+const TRACE_EXPORT_BACKFILL_SINCE_KEY string = "TRACE_EXPORT_BACKFILL_SINCE"
+const TRACE_EXPORT_BACKFILL_UNTIL_KEY string = "TRACE_EXPORT_BACKFILL_UNTIL"
+const TRACE_EXPORT_BACKFILL_CONCURRENCY_KEY string = "TRACE_EXPORT_BACKFILL_CONCURRENCY"
+const TRACE_EXPORT_BACKFILL_CHECKPOINT_KEY string = "TRACE_EXPORT_BACKFILL_CHECKPOINT"
+const TRACE_EXPORT_BACKFILL_DRY_RUN_KEY string = "TRACE_EXPORT_BACKFILL_DRY_RUN"
+
+// runBackfill exports the traces of workflow runs that completed before the service was deployed.
+func runBackfill(ctx context.Context, args []string) (err error) {
+	flags := newCommandFlags("backfill", backfillUsage)
+	cfg, err := flags.loadConfig(args, true)
+	if err != nil {
+		return err
+	}
+	var repos repoFlags
+	var org, since, until, checkpointPath string
+	var concurrency int
+	var dryRun bool
+	flags.envVar(&repos, "repo", TRACE_EXPORT_BACKFILL_REPOS_KEY, "repo to backfill as 'owner/repo', can be passed more than once or comma separated")
+	flags.envString(&org, "org", TRACE_EXPORT_BACKFILL_ORG_KEY, "", "backfill every (non archived) repo of the org")
+	flags.envString(&since, "since", TRACE_EXPORT_BACKFILL_SINCE_KEY, "", "only export runs created at or after this date (YYYY-MM-DD or RFC3339)")
+	flags.envString(&until, "until", TRACE_EXPORT_BACKFILL_UNTIL_KEY, "", "only export runs created before this date (YYYY-MM-DD or RFC3339), defaults to now")
+	flags.envInt(&concurrency, "concurrency", TRACE_EXPORT_BACKFILL_CONCURRENCY_KEY, 4, "number of runs exported at the same time")
+	flags.envString(&checkpointPath, "checkpoint", TRACE_EXPORT_BACKFILL_CHECKPOINT_KEY, "backfill-checkpoint.json", "file the progress is recorded in, so the backfill can be resumed")
+	flags.envBool(&dryRun, "dry-run", TRACE_EXPORT_BACKFILL_DRY_RUN_KEY, false, "print the runs that would be exported without exporting them")
+	err = flags.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	sinceTime, err := parseDate(since)
+	if err != nil {
+		return fmt.Errorf("invalid -since: %w", err)
+	}
+
+	// when running as a Cloud Run job with multiple tasks, each task exports its own part of the runs.
+	shard, err := backfill.ShardFromEnv()
+	if err != nil {
+		return err
+	}
+	if shard.Count > 1 {
+		slog.Info("running sharded backfill", "shard.index", shard.Index, "shard.count", shard.Count)
+	}
+
+	checkpoint, err := backfill.LoadCheckpoint(shard.CheckpointPath(checkpointPath))
+	if err != nil {
+		return err
+	}
+
+	untilTime := time.Now()
+	if until != "" {
+		untilTime, err = parseDate(until)
+		if err != nil {
+			return fmt.Errorf("invalid -until: %w", err)
+		}
+	} else if checkpointSince, checkpointUntil := checkpoint.Range(); checkpointSince.Equal(sinceTime) && !checkpointUntil.IsZero() {
+		// a backfill resumed without -until ends where it did when it was started
+		untilTime = checkpointUntil
+	}
+
+	err = setup(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err = errors.Join(err, otelShutdown(context.Background()))
+	}()
+
+	client, err := newGitHubClient(cfg.GitHub)
+	if err != nil {
+		return err
+	}
+	budget := ig.NewRateBudget(cfg.GitHub.RateLimitReserve)
+	backfiller, err := backfill.NewBackfiller(client, budget, workflowRunTracer, checkpoint, backfill.Options{
+		Repos:       repos,
+		Org:         org,
+		Since:       sinceTime,
+		Until:       untilTime,
+		Concurrency: concurrency,
+		DryRun:      dryRun,
+		Shard:       shard,
+	}, os.Stdout)
+	if err != nil {
+		return err
+	}
+
+	propCache := cache.NewPropCache(cfg.Cache.TTL, ig.RefreshCustomProperties(client, budget))
+	summary, err := backfiller.Run(withEnricher(withSampler(ctx), func() *config.Config { return cfg }, propCache))
+	slog.Info("backfill summary",
+		"listed", summary.Listed,
+		"exported", summary.Exported,
+		"skipped", summary.Skipped,
+		"failed", summary.Failed,
+	)
+
+	return err
+}
+
+func parseDate(value string) (time.Time, error) {
+	if t, err := time.Parse(time.DateOnly, value); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
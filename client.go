@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/bradleyfalzon/ghinstallation/v2"
+	eg "github.com/google/go-github/v66/github"
+	"github.com/pitoniak32/trace-export/pkg/config"
+)
+
+// newGitHubClient returns a client that is authenticated as the app installation when one is
+// configured, or with the token otherwise.
+func newGitHubClient(cfg config.GitHub) (*eg.Client, error) {
+	apiUrl := strings.TrimSuffix(cfg.APIURL, "/")
+	enterprise := apiUrl != "" && apiUrl != "https://api.github.com"
+
+	var client *eg.Client
+	if cfg.App.Enabled() {
+		var transport *ghinstallation.Transport
+		var err error
+		if cfg.App.PrivateKeyPath != "" {
+			transport, err = ghinstallation.NewKeyFromFile(http.DefaultTransport, cfg.App.ID, cfg.App.InstallationID, cfg.App.PrivateKeyPath)
+		} else {
+			transport, err = ghinstallation.New(http.DefaultTransport, cfg.App.ID, cfg.App.InstallationID, []byte(cfg.App.PrivateKey))
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to setup GitHub App authentication: %w", err)
+		}
+		if enterprise {
+			transport.BaseURL = apiUrl
+		}
+		client = eg.NewClient(&http.Client{Transport: transport})
+	} else {
+		client = eg.NewClient(nil).WithAuthToken(cfg.Token)
+	}
+
+	if !enterprise {
+		return client, nil
+	}
+	return client.WithEnterpriseURLs(apiUrl, apiUrl)
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	eg "github.com/google/go-github/v66/github"
+	"github.com/pitoniak32/trace-export/pkg/cache"
+	"github.com/pitoniak32/trace-export/pkg/chrometrace"
+	"github.com/pitoniak32/trace-export/pkg/config"
+	ig "github.com/pitoniak32/trace-export/pkg/github"
+	"github.com/pitoniak32/trace-export/pkg/spantree"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// requireAdmin only passes on requests with the admin token, the endpoint doesn't exist without one.
+func requireAdmin(reloader *config.Reloader, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := reloader.Current().Admin.Token
+		if token == "" {
+			http.NotFound(w, r)
+			return
+		}
+
+		given, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+type renderResponse struct {
+	Spans []*spantree.Node `json:"spans"`
+	Error string           `json:"error,omitempty"`
+}
+
+// debugRender handles a workflow_run payload like a webhook, but returns the spans instead of
+// exporting them. The spans that were created are returned even when handling fails. With
+// '?format=chrome' a run that was handled is returned in the Chrome Trace Event Format instead.
+func debugRender(reloader *config.Reloader, propCache *cache.PropCache) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "expected a POST of a workflow_run payload", http.StatusMethodNotAllowed)
+			return
+		}
+		format := r.URL.Query().Get("format")
+		if format != "" && format != "json" && format != "chrome" {
+			http.Error(w, "format must be json or chrome", http.StatusBadRequest)
+			return
+		}
+
+		workflowRunEvent, err := webhookFromBody[eg.WorkflowRunEvent](r.Body)
+		if err != nil {
+			http.Error(w, "failed to get WorkflowRunEvent from request body: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		ctx := withEnricher(r.Context(), reloader.Current, propCache)
+		spans, err := spantree.Render(ctx, func(ctx context.Context, tracer trace.Tracer) error {
+			return ig.HandlePayload(ctx, *workflowRunEvent, tracer)
+		})
+
+		if err == nil && format == "chrome" {
+			w.Header().Set("Content-Type", "application/json")
+			if err := chrometrace.Write(w, spans); err != nil {
+				slog.Error("failed to write rendered spans", "err", err)
+			}
+			return
+		}
+
+		res := renderResponse{Spans: spans}
+		status := http.StatusOK
+		if err != nil {
+			res.Error = err.Error()
+			status = http.StatusUnprocessableEntity
+		}
+		if res.Spans == nil {
+			res.Spans = []*spantree.Node{}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(res); err != nil {
+			slog.Error("failed to write rendered spans", "err", err)
+		}
+	}
+}
+
+// debugExporter returns how many spans were exported, and dropped because the export queue was full
+// or the exporter failed, since the service started.
+func debugExporter(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(exporterStats()); err != nil {
+		slog.Error("failed to write exporter stats", "err", err)
+	}
+}
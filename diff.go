@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	ig "github.com/pitoniak32/trace-export/pkg/github"
+	"github.com/pitoniak32/trace-export/pkg/rundiff"
+)
+
+const TRACE_EXPORT_DIFF_FORMAT_KEY string = "TRACE_EXPORT_DIFF_FORMAT"
+
+// runDiff compares the durations of the jobs and steps of two runs. The runs are passed as their
+// urls, or as 'owner/repo base_run_id[/attempt] head_run_id[/attempt]'.
+func runDiff(ctx context.Context, args []string) (err error) {
+	flags := newCommandFlags("diff", diffUsage)
+	cfg, err := flags.loadConfig(args, true)
+	if err != nil {
+		return err
+	}
+	var format string
+	flags.envString(&format, "format", TRACE_EXPORT_DIFF_FORMAT_KEY, "table", "one of table, json or markdown")
+	err = flags.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	write, ok := map[string]func(io.Writer, rundiff.Report) error{
+		"table":    rundiff.WriteTable,
+		"json":     rundiff.WriteJSON,
+		"markdown": rundiff.WriteMarkdown,
+	}[format]
+	if !ok {
+		return fmt.Errorf("invalid -format '%s', must be table, json or markdown", format)
+	}
+
+	baseRef, headRef, err := parseRunPair(flags.Args())
+	if err != nil {
+		return err
+	}
+
+	setupLogging(cfg, os.Stderr)
+
+	base, err := renderRun(ctx, cfg, baseRef)
+	if err != nil {
+		return err
+	}
+	head, err := renderRun(ctx, cfg, headRef)
+	if err != nil {
+		return err
+	}
+	if len(base) != 1 || len(head) != 1 {
+		return errors.New("expected the runs to have a single root span")
+	}
+
+	return write(os.Stdout, rundiff.Compare(base[0], head[0]))
+}
+
+// parseRunPair parses the base and head runs of the diff command.
+func parseRunPair(args []string) (ig.RunRef, ig.RunRef, error) {
+	var base, head ig.RunRef
+	var baseErr, headErr error
+	switch len(args) {
+	case 2:
+		base, baseErr = ig.ParseRunURL(args[0])
+		head, headErr = ig.ParseRunURL(args[1])
+	case 3:
+		base, baseErr = ig.ParseRunID(args[0], args[1])
+		head, headErr = ig.ParseRunID(args[0], args[2])
+	default:
+		return base, head, fmt.Errorf("expected the urls of two runs, or 'owner/repo base_run_id[/attempt] head_run_id[/attempt]', got %d arguments", len(args))
+	}
+	return base, head, errors.Join(baseErr, headErr)
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/pitoniak32/trace-export/pkg/cache"
+	"github.com/pitoniak32/trace-export/pkg/config"
+	ig "github.com/pitoniak32/trace-export/pkg/github"
+)
+
+// runExport exports the trace of a single workflow run. Inside of a GitHub Actions job every flag
+// defaults to the run that the job is a part of, so the run can trace itself from its final job.
+func runExport(ctx context.Context, args []string) (err error) {
+	flags := newCommandFlags("export", exportUsage)
+	cfg, err := flags.loadConfig(args, true)
+	if err != nil {
+		return err
+	}
+	var repo string
+	var runId, runAttempt int64
+	flags.envString(&repo, "repo", "GITHUB_REPOSITORY", "", "repo of the run as 'owner/repo'")
+	flags.envInt64(&runId, "run-id", "GITHUB_RUN_ID", 0, "id of the run")
+	flags.envInt64(&runAttempt, "run-attempt", "GITHUB_RUN_ATTEMPT", 1, "attempt of the run")
+	err = flags.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	owner, name, err := ig.SplitRepo(repo)
+	if err != nil {
+		return err
+	}
+	if runId == 0 {
+		return errors.New("a run id is required, pass -run-id or set GITHUB_RUN_ID")
+	}
+	if runAttempt < 1 {
+		runAttempt = 1
+	}
+
+	err = setup(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err = errors.Join(err, otelShutdown(context.Background()))
+	}()
+
+	// GITHUB_API_URL points the client at the GitHub instance the job is running on.
+	client, err := newGitHubClient(cfg.GitHub)
+	if err != nil {
+		return err
+	}
+	budget := ig.NewRateBudget(0)
+
+	run, jobs, err := ig.GetRunAttempt(ctx, client, budget, owner, name, runId, runAttempt)
+	if err != nil {
+		return err
+	}
+
+	// when running as the final job of the run, the run and this job are still in progress.
+	closedRun, closedJobs := ig.CloseInProgress(*run, *jobs, time.Now())
+
+	slog.Info("exporting workflow run", "repo", repo, "run.id", runId, "run.attempt", runAttempt, "run.status", run.GetStatus(), "jobs", closedJobs.GetTotalCount())
+	propCache := cache.NewPropCache(cfg.Cache.TTL, ig.RefreshCustomProperties(client, budget))
+	ctx = withEnricher(ctx, func() *config.Config { return cfg }, propCache)
+	return ig.TraceWorkflowRun(ctx, closedRun, runId, closedJobs, workflowRunTracer)
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pitoniak32/trace-export/pkg/config"
+)
+
+// commandFlags is the flag set of a command. The settings of the config are loaded from the -config
+// file and the environment before the flags are parsed, so a passed flag overrides both. The flags
+// that are only used by the command fall back to their environment variable.
+type commandFlags struct {
+	*flag.FlagSet
+	cfg        *config.Config
+	configPath string
+	// environment variable of each flag of the command, keyed by the flag name
+	envKeys map[string]string
+}
+
+func newCommandFlags(name, usage string) *commandFlags {
+	c := &commandFlags{
+		FlagSet: flag.NewFlagSet(name, flag.ExitOnError),
+		envKeys: make(map[string]string),
+	}
+	// read by loadConfig before the flags are parsed
+	c.String("config", "", withEnvKey("YAML config file, see config.example.yaml", config.TRACE_EXPORT_CONFIG_KEY))
+
+	c.Usage = func() {
+		out := c.Output()
+		fmt.Fprintf(out, "Usage: trace-export %s [flags]\n\n%s\n\nFlags (flag > env > config file > default):\n", name, usage)
+		c.PrintDefaults()
+	}
+
+	return c
+}
+
+// loadConfig loads the config file and environment, and adds a flag for each setting of the config
+// that the command uses. The config is validated by Parse.
+func (c *commandFlags) loadConfig(args []string, commonOnly bool) (*config.Config, error) {
+	c.configPath = configPathFromArgs(args)
+	cfg, err := config.Load(c.configPath, os.LookupEnv)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, field := range cfg.Fields() {
+		if commonOnly && !field.Common {
+			continue
+		}
+		c.Var(field.Value, field.Flag, withEnvKey(field.Usage, field.EnvKey))
+	}
+
+	c.cfg = cfg
+	return cfg, nil
+}
+
+// reloadConfig loads the config file and environment again, and applies the flags that were passed
+// on startup over them. The config is validated by the config.Reloader.
+func (c *commandFlags) reloadConfig() (*config.Config, error) {
+	cfg, err := config.Load(c.configPath, os.LookupEnv)
+	if err != nil {
+		return nil, err
+	}
+
+	var errs error
+	for _, field := range cfg.Fields() {
+		if !c.isPassed(field.Flag) {
+			continue
+		}
+		// the flag is bound to the config from startup, which still has the passed value
+		errs = errors.Join(errs, field.Value.Set(c.Lookup(field.Flag).Value.String()))
+	}
+	if errs != nil {
+		return nil, errs
+	}
+
+	return cfg, nil
+}
+
+func (c *commandFlags) isPassed(name string) bool {
+	passed := false
+	c.Visit(func(f *flag.Flag) {
+		passed = passed || f.Name == name
+	})
+	return passed
+}
+
+// configPathFromArgs finds the -config flag before the rest of the flags are parsed.
+func configPathFromArgs(args []string) string {
+	configPath := os.Getenv(config.TRACE_EXPORT_CONFIG_KEY)
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			break
+		}
+		if !strings.HasPrefix(arg, "-") {
+			continue
+		}
+
+		name, value, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if name != "config" {
+			continue
+		}
+		if hasValue {
+			configPath = value
+		} else if i+1 < len(args) {
+			configPath = args[i+1]
+			i += 1
+		}
+	}
+	return configPath
+}
+
+func (c *commandFlags) envString(p *string, name, envKey, value, usage string) {
+	c.envKeys[name] = envKey
+	c.StringVar(p, name, value, withEnvKey(usage, envKey))
+}
+
+func (c *commandFlags) envInt(p *int, name, envKey string, value int, usage string) {
+	c.envKeys[name] = envKey
+	c.IntVar(p, name, value, withEnvKey(usage, envKey))
+}
+
+func (c *commandFlags) envInt64(p *int64, name, envKey string, value int64, usage string) {
+	c.envKeys[name] = envKey
+	c.Int64Var(p, name, value, withEnvKey(usage, envKey))
+}
+
+func (c *commandFlags) envBool(p *bool, name, envKey string, value bool, usage string) {
+	c.envKeys[name] = envKey
+	c.BoolVar(p, name, value, withEnvKey(usage, envKey))
+}
+
+func (c *commandFlags) envFloat64(p *float64, name, envKey string, value float64, usage string) {
+	c.envKeys[name] = envKey
+	c.Float64Var(p, name, value, withEnvKey(usage, envKey))
+}
+
+func (c *commandFlags) envDuration(p *time.Duration, name, envKey string, value time.Duration, usage string) {
+	c.envKeys[name] = envKey
+	c.DurationVar(p, name, value, withEnvKey(usage, envKey))
+}
+
+func (c *commandFlags) envVar(value flag.Value, name, envKey, usage string) {
+	c.envKeys[name] = envKey
+	c.Var(value, name, withEnvKey(usage, envKey))
+}
+
+func withEnvKey(usage, envKey string) string {
+	return fmt.Sprintf("%s (env %s)", usage, envKey)
+}
+
+// Parse parses the args, sets the flags of the command that weren't passed from the environment,
+// and validates the config.
+func (c *commandFlags) Parse(args []string) error {
+	err := c.FlagSet.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	passed := make(map[string]bool)
+	c.Visit(func(f *flag.Flag) {
+		passed[f.Name] = true
+	})
+
+	var errs error
+	for name, envKey := range c.envKeys {
+		value := os.Getenv(envKey)
+		if passed[name] || value == "" {
+			continue
+		}
+
+		err := c.Set(name, value)
+		if err != nil {
+			errs = errors.Join(errs, fmt.Errorf("invalid %s '%s': %w", envKey, value, err))
+		}
+	}
+	if errs != nil {
+		return errs
+	}
+
+	if c.cfg != nil {
+		err = c.cfg.Validate()
+		if err != nil {
+			return fmt.Errorf("invalid config:\n%w", err)
+		}
+	}
+
+	return nil
+}
+
+// repoFlags collects the values of a flag that can be passed more than once, or as a comma
+// separated list.
+type repoFlags []string
+
+func (r *repoFlags) String() string {
+	return strings.Join(*r, ",")
+}
+
+func (r *repoFlags) Set(value string) error {
+	for _, repo := range strings.Split(value, ",") {
+		if repo = strings.TrimSpace(repo); repo != "" {
+			*r = append(*r, repo)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	ig "github.com/pitoniak32/trace-export/pkg/github"
+	"github.com/pitoniak32/trace-export/pkg/waterfall"
+)
+
+const TRACE_EXPORT_INSPECT_WIDTH_KEY string = "TRACE_EXPORT_INSPECT_WIDTH"
+
+// runInspect prints the waterfall of a single run, for a trace shaped view without a tracing
+// backend. The run is passed as its url, or as 'owner/repo run_id[/attempt]'.
+func runInspect(ctx context.Context, args []string) (err error) {
+	flags := newCommandFlags("inspect", inspectUsage)
+	cfg, err := flags.loadConfig(args, true)
+	if err != nil {
+		return err
+	}
+	var width int
+	var noColor bool
+	flags.envInt(&width, "width", TRACE_EXPORT_INSPECT_WIDTH_KEY, 60, "width of the bars, in characters")
+	flags.BoolVar(&noColor, "no-color", false, "don't highlight failures and the critical path with colors, also disabled by NO_COLOR or when the output isn't a terminal")
+	err = flags.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	ref, err := ig.ParseRunArgs(flags.Args())
+	if err != nil {
+		return err
+	}
+
+	setupLogging(cfg, os.Stderr)
+
+	spans, err := renderRun(ctx, cfg, ref)
+	if err != nil {
+		return err
+	}
+	if len(spans) != 1 {
+		return errors.New("expected the run to have a single root span")
+	}
+
+	color := !noColor && os.Getenv("NO_COLOR") == "" && isTerminal(os.Stdout)
+	err = waterfall.Render(os.Stdout, spans[0], waterfall.Options{Width: width, Color: color})
+	if err != nil {
+		return fmt.Errorf("failed to print %s: %w", ref, err)
+	}
+	return nil
+}
+
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
@@ -11,111 +12,330 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
-	"time"
+	"strings"
 
 	eg "github.com/google/go-github/v66/github"
 	"github.com/pitoniak32/trace-export/pkg/cache"
+	"github.com/pitoniak32/trace-export/pkg/config"
 	ig "github.com/pitoniak32/trace-export/pkg/github"
 	"github.com/pitoniak32/trace-export/pkg/otel"
+	"github.com/pitoniak32/trace-export/pkg/sampling"
+	"github.com/pitoniak32/trace-export/pkg/state"
+	"github.com/pitoniak32/trace-export/pkg/webhook"
 
 	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/trace"
 )
 
-const OTEL_EXPORTER_OTLP_ENDPOINT_KEY string = "OTEL_EXPORTER_OTLP_ENDPOINT"
-
 var (
-	otlpEndpoint      string
 	serviceTracer     trace.Tracer
 	workflowRunTracer trace.Tracer
 	otelShutdown      func(context.Context) error
+	exporterStats     func() otel.ExporterStats
+	// nil when every run is kept
+	runSampler     *sampling.Sampler
+	payloadHandler *ig.Handler
 )
 
-func setup() context.Context {
+// command is a subcommand of the cli, it parses its own flags.
+type command struct {
+	name  string
+	usage string
+	run   func(ctx context.Context, args []string) error
+}
+
+const serveUsage = "Receive GitHub webhooks and export the traces of workflow runs (default)."
+const backfillUsage = "Export the traces of workflow runs that completed in the past."
+const exportUsage = "Export the trace of a single workflow run, defaults to the run of the current GitHub Actions job."
+const replayUsage = "Deliver recorded webhooks from a JSONL file, in process or to a running service."
+const inspectUsage = "Print a waterfall of a single workflow run, given its url or 'owner/repo run_id[/attempt]'."
+const diffUsage = "Compare the durations of the jobs and steps of two workflow runs."
+const renderUsage = "Write the trace of a single workflow run to a file, as Chrome Trace Event JSON for Perfetto."
+
+var commands = []command{
+	{name: "serve", usage: serveUsage, run: runServe},
+	{name: "backfill", usage: backfillUsage, run: runBackfill},
+	{name: "export", usage: exportUsage, run: runExport},
+	{name: "replay", usage: replayUsage, run: runReplay},
+	{name: "render", usage: renderUsage, run: runRender},
+	{name: "inspect", usage: inspectUsage, run: runInspect},
+	{name: "diff", usage: diffUsage, run: runDiff},
+}
+
+func usage() {
+	out := os.Stderr
+	fmt.Fprintf(out, "Usage: trace-export [command] [flags]\n\nCommands:\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(out, "  %-10s %s\n", cmd.name, cmd.usage)
+	}
+	fmt.Fprintf(out, "\nRun 'trace-export <command> -help' for the flags of a command.\n")
+}
 
+func main() {
 	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
 	slog.SetDefault(logger)
 
-	slog.Info("Getting the collector uri from env!")
-	otlpEndpoint = os.Getenv(OTEL_EXPORTER_OTLP_ENDPOINT_KEY)
-	slog.Info("found value for uri", "key", OTEL_EXPORTER_OTLP_ENDPOINT_KEY, "otlp.endpoint", otlpEndpoint)
+	// serve is the default, so existing deployments that only pass flags (or nothing) keep working.
+	name, args := "serve", os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
+
+	if name == "help" {
+		usage()
+		return
+	}
+
+	for _, cmd := range commands {
+		if cmd.name != name {
+			continue
+		}
+		if err := cmd.run(context.Background(), args); err != nil {
+			slog.Error(err.Error())
+			os.Exit(1)
+		}
+		return
+	}
+
+	fmt.Fprintf(os.Stderr, "unknown command '%s'\n\n", name)
+	usage()
+	os.Exit(2)
+}
+
+// setup configures logging and OpenTelemetry from the validated config, otelShutdown must be called
+// once it returns without an error.
+func setup(ctx context.Context, cfg *config.Config) error {
+	setupLogging(cfg, os.Stdout)
+
+	slog.Info("found value for uri", "key", config.OTEL_EXPORTER_OTLP_ENDPOINT_KEY, "otlp.endpoint", cfg.Exporter.OTLPEndpoint, "otlp.protocol", cfg.Exporter.Protocol)
+
+	destinations := make([]otel.Destination, 0, len(cfg.Exporter.Destinations))
+	for _, destination := range cfg.Exporter.Destinations {
+		destinations = append(destinations, otel.Destination{Name: destination.Name, OTLP: otlpOptions(destination.OTLP)})
+		slog.Info("found destination", "name", destination.Name, "otlp.endpoint", destination.OTLPEndpoint, "otlp.protocol", destination.Protocol)
+	}
+	routes := make([]otel.Route, 0, len(cfg.Exporter.Routes))
+	for _, route := range cfg.Exporter.Routes {
+		routes = append(routes, otel.Route{Orgs: route.Orgs, Repos: route.Repos, Workflows: route.Workflows, Destinations: route.Destinations})
+	}
+
+	if cfg.Sampling.Enabled() {
+		rules := make([]sampling.Rule, 0, len(cfg.Sampling.Rules))
+		for _, rule := range cfg.Sampling.Rules {
+			rules = append(rules, sampling.Rule{Repos: rule.Repos, Workflows: rule.Workflows, Rate: rule.Rate})
+		}
+		runSampler = sampling.NewSampler(sampling.Options{
+			Rate:             cfg.Sampling.Rate,
+			KeepDurationOver: cfg.Sampling.KeepDurationOver,
+			KeepConclusions:  cfg.Sampling.KeepConclusions,
+			Rules:            rules,
+		})
+		slog.Info("sampling workflow runs", "rate", cfg.Sampling.Rate, "rules", len(rules), "keep_duration_over", cfg.Sampling.KeepDurationOver)
+	}
 
-	// Set up OpenTelemetry.
-	ctx := context.Background()
 	var err error
-	serviceTracer, workflowRunTracer, otelShutdown, err = otel.SetupOTelSDK(ctx, otlpEndpoint)
+	serviceTracer, workflowRunTracer, exporterStats, otelShutdown, err = otel.SetupOTelSDK(ctx, otel.ExporterOptions{
+		OTLP: otlpOptions(cfg.Exporter.OTLP),
+		File: otel.FileOptions{
+			Dir:      cfg.Exporter.File.Dir,
+			Split:    cfg.Exporter.File.Split,
+			MaxBytes: cfg.Exporter.File.MaxBytes,
+		},
+		Zipkin: otel.ZipkinOptions{
+			Endpoint: cfg.Exporter.Zipkin.Endpoint,
+			Timeout:  cfg.Exporter.Zipkin.Timeout,
+		},
+		Resource: otel.ResourceOptions{
+			ServiceName: cfg.Exporter.Resource.ServiceName,
+			Attributes:  cfg.Exporter.Resource.Attributes,
+			IdleTimeout: cfg.Exporter.Resource.IdleTimeout,
+		},
+		Detectors: cfg.Exporter.Resource.Detectors,
+		Batch: otel.BatchOptions{
+			QueueSize:     cfg.Exporter.Batch.QueueSize,
+			BatchSize:     cfg.Exporter.Batch.BatchSize,
+			ExportTimeout: cfg.Exporter.Batch.ExportTimeout,
+			Interval:      cfg.Exporter.Batch.Interval,
+		},
+		Destinations: destinations,
+		Routes:       routes,
+		Buffer: otel.BufferOptions{
+			Dir:        cfg.Exporter.Buffer.Dir,
+			MaxBytes:   cfg.Exporter.Buffer.MaxBytes,
+			MaxAge:     cfg.Exporter.Buffer.MaxAge,
+			MaxBackoff: cfg.Exporter.Buffer.MaxBackoff,
+			Timeout:    cfg.Exporter.Batch.ExportTimeout,
+		},
+	})
 	if err != nil {
 		var _ = otelShutdown(ctx)
-		slog.Error("Failed to setup OtelSDK", "err", err)
-		os.Exit(1)
+		return fmt.Errorf("failed to setup OtelSDK: %w", err)
 	}
 
-	return ctx
+	return nil
 }
 
-func main() {
-	ctx := setup()
-	defer otelShutdown(ctx)
+func otlpOptions(o config.OTLP) otel.OTLPOptions {
+	return otel.OTLPOptions{
+		Endpoint:          o.OTLPEndpoint,
+		Protocol:          o.Protocol,
+		Headers:           o.Headers,
+		Timeout:           o.Timeout,
+		Certificate:       o.Certificate,
+		ClientCertificate: o.ClientCertificate,
+		ClientKey:         o.ClientKey,
+		ServerName:        o.ServerName,
+		Compression:       o.Compression,
+		Insecure:          o.Insecure,
+	}
+}
 
-	client := eg.NewClient(nil).WithAuthToken(os.Getenv("GITHUB_TOKEN"))
+// setupLogging logs to out at the configured level, commands that write their output to stdout log
+// to stderr instead.
+func setupLogging(cfg *config.Config, out io.Writer) {
+	var level slog.Level
+	// checked by Validate
+	_ = level.UnmarshalText([]byte(cfg.Server.LogLevel))
+	logger := slog.New(slog.NewTextHandler(out, &slog.HandlerOptions{Level: level}))
+	slog.SetDefault(logger)
+}
 
-	limits, _, err := client.RateLimit.Get(ctx)
+func runServe(ctx context.Context, args []string) (err error) {
+	flags := newCommandFlags("serve", serveUsage)
+	cfg, err := flags.loadConfig(args, false)
 	if err != nil {
-		slog.Error(err.Error())
-		os.Exit(1)
+		return err
+	}
+	err = flags.Parse(args)
+	if err != nil {
+		return err
 	}
 
-	slog.Info("github ratelimit",
-		"core.limit", limits.Core.Limit,
-		"core.remaining", limits.Core.Remaining,
-		"core.reset", limits.Core.Reset,
-	)
+	err = setup(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	// Handle shutdown properly so nothing leaks.
+	defer func() {
+		err = errors.Join(err, otelShutdown(context.Background()))
+	}()
 
-	propCache := cache.NewPropCache(12 * time.Hour)
+	ctxCancelScheduled, cancelScheduled := context.WithCancel(ctx)
+	defer cancelScheduled()
 
-	entry := cache.CacheEntry{
-		UpdatedAtMillis: time.Now().UnixMilli(),
-		Props:           map[string]string{"foo": "bar"},
+	reloader := config.NewReloader(cfg, flags.reloadConfig)
+	handler, client, budget, propCache, err := startHandler(ctxCancelScheduled, reloader, cfg.Recorder.Enabled)
+	if err != nil {
+		return err
 	}
 
-	propCache.Insert("trace-export", entry)
+	if len(cfg.Poll.Repos) > 0 {
+		ctx := withEnricher(withSampler(ctxCancelScheduled), reloader.Current, propCache)
+		err := startPoller(ctx, client, budget, cfg.Poll)
+		if err != nil {
+			return fmt.Errorf("failed to setup poller: %w", err)
+		}
+	}
 
-	ctxCancelScheduledRefresh, cancelScheduledRefresh := context.WithCancel(ctx)
-	defer cancelScheduledRefresh()
+	watchReloads(ctxCancelScheduled, reloader, flags.configPath, cfg.Server.ConfigWatchInterval)
 
-	propCache.ScheduleRefresh(ctxCancelScheduledRefresh, 1*time.Hour)
+	return run(cfg, handler)
+}
+
+// startHandler sets up the payload handler and everything the /webhook endpoint uses, the
+// scheduled work stops (and the recorder is closed) when the context is cancelled. Returns the http
+// handler of the service, and the client, rate limit budget and custom properties cache for anything
+// else that calls the api.
+func startHandler(ctx context.Context, reloader *config.Reloader, record bool) (http.Handler, *eg.Client, *ig.RateBudget, *cache.PropCache, error) {
+	cfg := reloader.Current()
 
-	if err := run(&propCache); err != nil {
-		slog.Error(err.Error())
+	client, err := newGitHubClient(cfg.GitHub)
+	if err != nil {
+		return nil, nil, nil, nil, err
 	}
+	// shared by everything in the service that calls the api, keeping some requests in reserve
+	budget := ig.NewRateBudget(cfg.GitHub.RateLimitReserve)
+
+	slog.Info("found value for mode", "mode", cfg.Handler.Mode)
+	payloadHandler, err = ig.NewHandler(ig.Mode(cfg.Handler.Mode), workflowRunTracer, state.NewMemoryStore(cfg.Handler.StateTTL), client, budget)
+	if err != nil {
+		return nil, nil, nil, nil, fmt.Errorf("failed to setup payload handler: %w", err)
+	}
+
+	if cfg.Features.RateLimitCheck {
+		err = logRateLimit(ctx, client, budget)
+		if err != nil {
+			return nil, nil, nil, nil, err
+		}
+	}
+
+	// repos are added the first time one of their webhooks is received, so the cache stays empty
+	// while the custom properties are turned off.
+	propCache := cache.NewPropCache(cfg.Cache.TTL, ig.RefreshCustomProperties(client, budget))
+	propCache.ScheduleRefresh(ctx, cfg.Cache.RefreshInterval)
+
+	payloadHandler.ScheduleSweep(withEnricher(withSampler(ctx), reloader.Current, propCache), cfg.Handler.SweepInterval, cfg.Handler.SweepGrace)
+
+	var recorder *webhook.Recorder
+	if record {
+		archive, err := webhook.NewFileArchive(cfg.Recorder.Dir, cfg.Recorder.MaxBytes, cfg.Recorder.MaxAge)
+		if err != nil {
+			return nil, nil, nil, nil, err
+		}
+		go func() {
+			<-ctx.Done()
+			if err := archive.Close(); err != nil {
+				slog.Error("failed to close webhook archive", "err", err)
+			}
+		}()
+		slog.Info("recording webhooks", "dir", cfg.Recorder.Dir)
+		secrets := func() []string { return reloader.Current().Webhook.Secrets }
+		recorder = webhook.NewRecorder(archive, secrets, cfg.Recorder.Headers, cfg.Recorder.Redact)
+	}
+
+	return newHTTPHandler(reloader, propCache, recorder), client, budget, propCache, nil
 }
 
-func run(propCache *cache.PropCache) (err error) {
+func logRateLimit(ctx context.Context, client *eg.Client, budget *ig.RateBudget) error {
+	var limits *eg.RateLimits
+	err := budget.Do(ctx, func() (*eg.Response, error) {
+		var res *eg.Response
+		var err error
+		limits, res, err = client.RateLimit.Get(ctx)
+		return res, err
+	})
+	if err != nil {
+		return err
+	}
+
+	slog.Info("github ratelimit",
+		"core.limit", limits.Core.Limit,
+		"core.remaining", limits.Core.Remaining,
+		"core.reset", limits.Core.Reset,
+	)
+	return nil
+}
+
+func run(cfg *config.Config, handler http.Handler) (err error) {
 	// Handle SIGINT (CTRL+C) gracefully.
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
 	defer stop()
 
-	// Handle shutdown properly so nothing leaks.
-	defer func() {
-		err = errors.Join(err, otelShutdown(context.Background()))
-	}()
-
-	addr := ":8080"
-
 	// Start HTTP server.
 	srv := &http.Server{
-		Addr:         addr,
+		Addr:         cfg.Server.Addr,
 		BaseContext:  func(_ net.Listener) context.Context { return ctx },
-		ReadTimeout:  time.Second,
-		WriteTimeout: 10 * time.Second,
-		Handler:      newHTTPHandler(propCache),
+		ReadTimeout:  cfg.Server.ReadTimeout,
+		WriteTimeout: cfg.Server.WriteTimeout,
+		Handler:      handler,
 	}
 	srvErr := make(chan error, 1)
 	go func() {
 		srvErr <- srv.ListenAndServe()
 	}()
 
-	slog.Info("starting server!", "addr", addr)
+	slog.Info("starting server!", "addr", cfg.Server.Addr)
 
 	// Wait for interruption.
 	select {
@@ -133,7 +353,7 @@ func run(propCache *cache.PropCache) (err error) {
 	return
 }
 
-func newHTTPHandler(propCache *cache.PropCache) http.Handler {
+func newHTTPHandler(reloader *config.Reloader, propCache *cache.PropCache, recorder *webhook.Recorder) http.Handler {
 	mux := http.NewServeMux()
 
 	// handleFunc is a replacement for mux.HandleFunc
@@ -145,16 +365,18 @@ func newHTTPHandler(propCache *cache.PropCache) http.Handler {
 	}
 
 	// Register handlers.
-	handleFunc("/webhook", ghWebhook)
-	handleFunc("/hello", func(w http.ResponseWriter, r *http.Request) {
-		propCache.Insert("from-hello", cache.CacheEntry{
-			UpdatedAtMillis: time.Now().UnixMilli(),
-			Props:           map[string]string{"foo": "bar"},
-		})
-		w.WriteHeader(http.StatusAccepted)
-		_, err := w.Write([]byte("hello"))
+	webhookHandler := http.MaxBytesHandler(http.HandlerFunc(ghWebhook(reloader, propCache)), webhook.MAX_PAYLOAD_BYTES)
+	if recorder != nil {
+		webhookHandler = recorder.Middleware(webhookHandler)
+	}
+	mux.Handle("/webhook", webhookHandler)
+	handleFunc("/debug/render", requireAdmin(reloader, debugRender(reloader, propCache)))
+	handleFunc("/debug/exporter", requireAdmin(reloader, debugExporter))
+	handleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		_, err := w.Write([]byte("ok"))
 		if err != nil {
-			slog.Error("failed hello")
+			slog.Error("failed to write health check response", "err", err)
 		}
 	})
 
@@ -163,27 +385,129 @@ func newHTTPHandler(propCache *cache.PropCache) http.Handler {
 	return handler
 }
 
-func ghWebhook(w http.ResponseWriter, r *http.Request) {
-	_, span := serviceTracer.Start(r.Context(), "github-webhook")
-	defer span.End()
+func ghWebhook(reloader *config.Reloader, propCache *cache.PropCache) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := serviceTracer.Start(r.Context(), "github-webhook")
+		defer span.End()
+
+		// the same config is used for the whole request, even if it is reloaded in the meantime
+		cfg := reloader.Current()
+
+		body, err := ig.ValidateWebhookSignature(r, cfg.Webhook.Secrets)
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			slog.Warn("rejected webhook", "err", err)
+			http.Error(w, "payload too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		if err != nil {
+			slog.Warn("rejected webhook", "err", err)
+			http.Error(w, "invalid signature", http.StatusUnauthorized)
+			return
+		}
+
+		// the header is missing when payloads are posted by hand, those have always been workflow_run events.
+		eventType := eg.WebHookType(r)
+		if eventType == "" {
+			eventType = "workflow_run"
+		}
+
+		switch eventType {
+		case "workflow_run":
+			workflowRunEvent, err := webhookFromBody[eg.WorkflowRunEvent](bytes.NewReader(body))
+			if err != nil || workflowRunEvent == nil {
+				slog.Warn("rejected malformed webhook", "event", eventType, "err", err)
+				http.Error(w, fmt.Sprintf("failed to get WorkflowRunEvent from request body: %s", err), http.StatusBadRequest)
+				return
+			}
+
+			repo := workflowRunEvent.GetRepo().GetFullName()
+			if !cfg.Filters.Allows(repo, workflowRunEvent.GetWorkflowRun().GetName()) {
+				slog.Debug("skipping filtered webhook", "repo", repo, "workflow", workflowRunEvent.GetWorkflowRun().GetName())
+				return
+			}
+
+			ctx = withEnricher(withSampler(ctx), func() *config.Config { return cfg }, propCache)
+			err = payloadHandler.HandleWorkflowRunEvent(ctx, *workflowRunEvent)
+			if err != nil {
+				fmt.Println(err)
+			}
+		case "workflow_job":
+			workflowJobEvent, err := webhookFromBody[eg.WorkflowJobEvent](bytes.NewReader(body))
+			if err != nil || workflowJobEvent == nil {
+				slog.Warn("rejected malformed webhook", "event", eventType, "err", err)
+				http.Error(w, fmt.Sprintf("failed to get WorkflowJobEvent from request body: %s", err), http.StatusBadRequest)
+				return
+			}
+
+			repo := workflowJobEvent.GetRepo().GetFullName()
+			if !cfg.Filters.Allows(repo, workflowJobEvent.GetWorkflowJob().GetWorkflowName()) {
+				slog.Debug("skipping filtered webhook", "repo", repo, "workflow", workflowJobEvent.GetWorkflowJob().GetWorkflowName())
+				return
+			}
+
+			// the spans of jobs traced in live mode don't start from the root span of their run
+			ctx = enrich(withSampler(ctx), cfg, propCache, repo)
+			err = payloadHandler.HandleWorkflowJobEvent(ctx, *workflowJobEvent)
+			if err != nil {
+				fmt.Println(err)
+			}
+		default:
+			slog.Debug("skipping unsupported webhook event", "event", eventType)
+		}
+	}
+}
+
+// enrich adds the configured attributes and the custom properties of the repo to the traces of its
+// runs. The traces are still exported without the custom properties when they can't be fetched, or
+// the rate limit is used up.
+func enrich(ctx context.Context, cfg *config.Config, propCache *cache.PropCache, repo string) context.Context {
+	attributes := make([]attribute.KeyValue, 0, len(cfg.Enrichment.Attributes))
+	for key, value := range cfg.Enrichment.Attributes {
+		attributes = append(attributes, attribute.String(key, value))
+	}
+	set := attribute.NewSet(attributes...)
+	ctx = ig.ContextWithRunAttributes(ctx, set.ToSlice()...)
 
-	workflowRunEvent, err := webhookFromBody(r.Body)
-	if err != nil || workflowRunEvent == nil {
-		panic(fmt.Errorf("failed to get WorkflowRunEvent from request body: %s", err))
+	if !cfg.Features.CustomProperties || repo == "" {
+		return ctx
 	}
 
-	err = ig.HandlePayload(*workflowRunEvent, workflowRunTracer)
+	// the run is traced without waiting for the rate limit, it is exported without the properties
+	// instead
+	props, err := propCache.GetOrRefreshProps(ig.ContextWithoutRateWait(ctx), repo)
 	if err != nil {
-		fmt.Println(err)
+		slog.Warn("failed to get custom properties", "repo", repo, "err", err)
+		return ctx
+	}
+
+	ctx = otel.ContextWithCustomProperties(ctx, props)
+	return ig.ContextWithRunAttributes(ctx, ig.AttributesFromCustomProperties(props)...)
+}
+
+// withEnricher enriches the runs traced with the context when their root span starts, with the
+// config current at that time.
+func withEnricher(ctx context.Context, current func() *config.Config, propCache *cache.PropCache) context.Context {
+	return ig.ContextWithEnricher(ctx, func(ctx context.Context, repo string) context.Context {
+		return enrich(ctx, current(), propCache, repo)
+	})
+}
+
+// withSampler only exports the runs the sampler keeps, the commands that export a run that was asked
+// for don't use it.
+func withSampler(ctx context.Context) context.Context {
+	if runSampler == nil {
+		return ctx
 	}
+	return ig.ContextWithSampler(ctx, runSampler)
 }
 
-func webhookFromBody(body io.ReadCloser) (*eg.WorkflowRunEvent, error) {
+func webhookFromBody[T any](body io.Reader) (*T, error) {
 	dec := json.NewDecoder(body)
 	if dec == nil {
 		return nil, errors.New("failed to create json decoder for request body")
 	}
-	var event eg.WorkflowRunEvent
+	var event T
 	err := dec.Decode(&event)
 	if err != nil {
 		return nil, err
@@ -0,0 +1,360 @@
+package backfill
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync"
+	"time"
+
+	eg "github.com/google/go-github/v66/github"
+	ig "github.com/pitoniak32/trace-export/pkg/github"
+	myOtel "github.com/pitoniak32/trace-export/pkg/otel"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	tracer = otel.Tracer(myOtel.SERVICE_TRACER_NAME)
+)
+
+// the runs api only returns the first 1000 results of a query, so the date range is listed in windows.
+// A window with more runs is split in half until it has few enough, or is as short as the created
+// filter allows.
+const (
+	listWindow     = 24 * time.Hour
+	maxListResults = 1000
+	minListWindow  = time.Second
+)
+
+type Options struct {
+	// repos to backfill as 'owner/repo'
+	Repos []string
+	// all the repos of the org are backfilled when set
+	Org string
+	// only runs created in [Since, Until) are exported
+	Since time.Time
+	Until time.Time
+	// the number of runs that are exported at the same time
+	Concurrency int
+	// print the runs that would be exported without exporting them
+	DryRun bool
+	// only the runs owned by the shard are exported, the zero value exports every run
+	Shard Shard
+}
+
+type Summary struct {
+	Listed   int
+	Exported int
+	Skipped  int
+	Failed   int
+}
+
+type Backfiller struct {
+	client     *eg.Client
+	budget     *ig.RateBudget
+	tracer     trace.Tracer
+	checkpoint *Checkpoint
+	opts       Options
+	// where the runs are printed to in dry run mode
+	out io.Writer
+}
+
+func NewBackfiller(client *eg.Client, budget *ig.RateBudget, tracer trace.Tracer, checkpoint *Checkpoint, opts Options, out io.Writer) (*Backfiller, error) {
+	if len(opts.Repos) == 0 && opts.Org == "" {
+		return nil, errors.New("at least one repo or an org is required")
+	}
+	for _, repo := range opts.Repos {
+		if _, _, err := ig.SplitRepo(repo); err != nil {
+			return nil, err
+		}
+	}
+	if opts.Since.IsZero() || !opts.Since.Before(opts.Until) {
+		return nil, fmt.Errorf("invalid date range '%s' to '%s'", opts.Since.Format(time.RFC3339), opts.Until.Format(time.RFC3339))
+	}
+	if opts.Concurrency < 1 {
+		opts.Concurrency = 1
+	}
+	if opts.Shard.Count == 0 {
+		opts.Shard = Shard{Index: 0, Count: 1}
+	}
+	if err := opts.Shard.Validate(); err != nil {
+		return nil, err
+	}
+	if err := checkpoint.UseRange(opts.Since, opts.Until); err != nil {
+		return nil, err
+	}
+
+	return &Backfiller{
+		client:     client,
+		budget:     budget,
+		tracer:     tracer,
+		checkpoint: checkpoint,
+		opts:       opts,
+		out:        out,
+	}, nil
+}
+
+// Run exports the workflow runs of every repo, skipping the runs that the checkpoint says were
+// already exported.
+func (b *Backfiller) Run(ctx context.Context) (Summary, error) {
+	ctx, span := tracer.Start(ctx, "Backfill", trace.WithAttributes(
+		attribute.String("backfill.since", b.opts.Since.Format(time.RFC3339)),
+		attribute.String("backfill.until", b.opts.Until.Format(time.RFC3339)),
+		attribute.Bool("backfill.dry_run", b.opts.DryRun),
+		attribute.Int("backfill.shard.index", b.opts.Shard.Index),
+		attribute.Int("backfill.shard.count", b.opts.Shard.Count),
+	))
+	defer span.End()
+
+	var summary Summary
+
+	repos, err := b.repos(ctx)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return summary, err
+	}
+
+	span.SetAttributes(attribute.Int("backfill.repos.total", len(repos)))
+
+	var errs error
+	reposDone := 0
+	for _, repo := range repos {
+		if b.checkpoint.IsRepoDone(repo) {
+			reposDone += 1
+			slog.Info("skipping repo that was already backfilled", "repo", repo)
+			continue
+		}
+
+		repoSummary, err := b.backfillRepo(ctx, repo)
+		summary.Listed += repoSummary.Listed
+		summary.Exported += repoSummary.Exported
+		summary.Skipped += repoSummary.Skipped
+		summary.Failed += repoSummary.Failed
+		if err != nil {
+			errs = errors.Join(errs, err)
+			continue
+		}
+
+		if !b.opts.DryRun {
+			errs = errors.Join(errs, b.checkpoint.MarkRepoDone(repo))
+		}
+
+		reposDone += 1
+		span.SetAttributes(attribute.Int("backfill.repos.done", reposDone))
+		slog.Info("backfill progress", "shard", b.opts.Shard.String(), "repos.done", reposDone, "repos.total", len(repos), "exported", summary.Exported)
+	}
+
+	span.SetAttributes(
+		attribute.Int("backfill.total.listed", summary.Listed),
+		attribute.Int("backfill.total.exported", summary.Exported),
+		attribute.Int("backfill.total.skipped", summary.Skipped),
+		attribute.Int("backfill.total.failed", summary.Failed),
+	)
+	if errs != nil {
+		span.SetStatus(codes.Error, errs.Error())
+	}
+
+	return summary, errs
+}
+
+func (b *Backfiller) backfillRepo(ctx context.Context, repo string) (Summary, error) {
+	ctx, span := tracer.Start(ctx, repo)
+	defer span.End()
+
+	var summary Summary
+
+	runs, err := b.listRuns(ctx, repo)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return summary, err
+	}
+	summary.Listed = len(runs)
+
+	var mu sync.Mutex
+	var errs error
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, b.opts.Concurrency)
+	for _, run := range runs {
+		if b.checkpoint.IsExported(repo, run.GetID(), run.GetRunAttempt()) {
+			summary.Skipped += 1
+			continue
+		}
+
+		if b.opts.DryRun {
+			fmt.Fprintf(b.out, "%s\t%d\t%d\t%s\t%s\t%s\n", repo, run.GetID(), run.GetRunAttempt(), run.GetRunStartedAt().Format(time.RFC3339), run.GetConclusion(), run.GetName())
+			continue
+		}
+
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			err := b.exportRun(ctx, repo, run)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				slog.Error("failed to backfill workflow run", "repo", repo, "run.id", run.GetID(), "err", err)
+				summary.Failed += 1
+				errs = errors.Join(errs, err)
+				return
+			}
+			summary.Exported += 1
+		}()
+	}
+	wg.Wait()
+
+	slog.Info("backfilled repo", "repo", repo, "listed", summary.Listed, "exported", summary.Exported, "skipped", summary.Skipped, "failed", summary.Failed)
+	return summary, errs
+}
+
+func (b *Backfiller) exportRun(ctx context.Context, repo string, run *eg.WorkflowRun) error {
+	owner, name, _ := ig.SplitRepo(repo)
+
+	jobs, err := ig.ListJobs(ctx, b.client, b.budget, owner, name, run.GetID(), int64(run.GetRunAttempt()))
+	if err != nil {
+		return err
+	}
+
+	err = ig.TraceWorkflowRun(ctx, *run, run.GetID(), *jobs, b.tracer)
+	if err != nil {
+		return err
+	}
+
+	return b.checkpoint.MarkExported(repo, run.GetID(), run.GetRunAttempt())
+}
+
+// listRuns lists the completed runs of the repo in the date range that are owned by the shard.
+func (b *Backfiller) listRuns(ctx context.Context, repo string) ([]*eg.WorkflowRun, error) {
+	seen := make(map[int64]bool)
+	var runs []*eg.WorkflowRun
+
+	// windows are listed in order, the halves of a window with too many runs replace it at the front
+	var windows [][2]time.Time
+	for windowStart := b.opts.Since; windowStart.Before(b.opts.Until); windowStart = windowStart.Add(listWindow) {
+		windowEnd := windowStart.Add(listWindow)
+		if windowEnd.After(b.opts.Until) {
+			windowEnd = b.opts.Until
+		}
+		windows = append(windows, [2]time.Time{windowStart, windowEnd})
+	}
+
+	for len(windows) > 0 {
+		windowStart, windowEnd := windows[0][0], windows[0][1]
+		windows = windows[1:]
+
+		page, err := b.listWindow(ctx, repo, windowStart, windowEnd, seen, &runs)
+		if err != nil {
+			return nil, err
+		}
+		if page.GetTotalCount() <= maxListResults {
+			continue
+		}
+
+		if windowEnd.Sub(windowStart) <= minListWindow {
+			slog.Warn("more runs were created in the window than the api lists, some of them are not exported", "repo", repo, "window.start", windowStart.Format(time.RFC3339), "window.end", windowEnd.Format(time.RFC3339), "runs", page.GetTotalCount())
+			trace.SpanFromContext(ctx).AddEvent("truncated window", trace.WithAttributes(
+				attribute.String("backfill.window.start", windowStart.Format(time.RFC3339)),
+				attribute.String("backfill.window.end", windowEnd.Format(time.RFC3339)),
+				attribute.Int("backfill.window.runs", page.GetTotalCount()),
+			))
+			continue
+		}
+
+		middle := windowStart.Add(windowEnd.Sub(windowStart) / 2)
+		slog.Debug("splitting the window of runs", "repo", repo, "window.start", windowStart.Format(time.RFC3339), "window.end", windowEnd.Format(time.RFC3339), "runs", page.GetTotalCount())
+		windows = append([][2]time.Time{{windowStart, middle}, {middle, windowEnd}}, windows...)
+	}
+
+	return runs, nil
+}
+
+// listWindow adds the runs created in the window to runs, skipping the ones that were seen. Only
+// the first page is listed when the window has more runs than the api returns, it is split instead.
+// Returns the first page.
+func (b *Backfiller) listWindow(ctx context.Context, repo string, windowStart, windowEnd time.Time, seen map[int64]bool, runs *[]*eg.WorkflowRun) (*eg.WorkflowRuns, error) {
+	owner, name, _ := ig.SplitRepo(repo)
+
+	opts := &eg.ListWorkflowRunsOptions{
+		Status: "completed",
+		// both ends of the range are inclusive, runs on the boundary are deduplicated below
+		Created:     fmt.Sprintf("%s..%s", windowStart.UTC().Format(time.RFC3339), windowEnd.UTC().Format(time.RFC3339)),
+		ListOptions: eg.ListOptions{PerPage: 100},
+	}
+
+	var first *eg.WorkflowRuns
+	for {
+		var page *eg.WorkflowRuns
+		var res *eg.Response
+		err := b.budget.Do(ctx, func() (*eg.Response, error) {
+			var err error
+			page, res, err = b.client.Actions.ListRepositoryWorkflowRuns(ctx, owner, name, opts)
+			return res, err
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list workflow runs of '%s': %w", repo, err)
+		}
+		if first == nil {
+			first = page
+			if page.GetTotalCount() > maxListResults && windowEnd.Sub(windowStart) > minListWindow {
+				return first, nil
+			}
+		}
+
+		for _, run := range page.WorkflowRuns {
+			if seen[run.GetID()] || !run.GetCreatedAt().Time.Before(b.opts.Until) || !b.opts.Shard.Owns(repo, run.GetID()) {
+				continue
+			}
+			seen[run.GetID()] = true
+			*runs = append(*runs, run)
+		}
+
+		if res.NextPage == 0 {
+			return first, nil
+		}
+		opts.Page = res.NextPage
+	}
+}
+
+// repos returns the repos passed in the options, and the repos of the org.
+func (b *Backfiller) repos(ctx context.Context) ([]string, error) {
+	repos := append([]string{}, b.opts.Repos...)
+	if b.opts.Org == "" {
+		return repos, nil
+	}
+
+	opts := &eg.RepositoryListByOrgOptions{ListOptions: eg.ListOptions{PerPage: 100}}
+	for {
+		var page []*eg.Repository
+		var res *eg.Response
+		err := b.budget.Do(ctx, func() (*eg.Response, error) {
+			var err error
+			page, res, err = b.client.Repositories.ListByOrg(ctx, b.opts.Org, opts)
+			return res, err
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list the repos of org '%s': %w", b.opts.Org, err)
+		}
+
+		for _, repo := range page {
+			if repo.GetArchived() {
+				continue
+			}
+			repos = append(repos, repo.GetFullName())
+		}
+
+		if res.NextPage == 0 {
+			break
+		}
+		opts.Page = res.NextPage
+	}
+
+	return repos, nil
+}
@@ -0,0 +1,239 @@
+package backfill
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	eg "github.com/google/go-github/v66/github"
+	ig "github.com/pitoniak32/trace-export/pkg/github"
+	"github.com/pitoniak32/trace-export/pkg/internal"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestClient returns a client for a fake api that has two completed runs for 'octo/repo'.
+func newTestClient(t *testing.T) *eg.Client {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/octo/repo/actions/runs", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"total_count": 2, "workflow_runs": [
+			{"id": 1, "name": "ci", "run_attempt": 1, "created_at": "2024-01-01T10:00:00Z", "run_started_at": "2024-01-01T10:00:00Z", "updated_at": "2024-01-01T10:05:00Z"},
+			{"id": 2, "name": "ci", "run_attempt": 1, "created_at": "2024-01-01T11:00:00Z", "run_started_at": "2024-01-01T11:00:00Z", "updated_at": "2024-01-01T11:05:00Z"}
+		]}`))
+	})
+	mux.HandleFunc("/repos/octo/repo/actions/runs/{id}/attempts/1/jobs", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"total_count": 1, "jobs": [{"id": 10, "name": "build", "started_at": "2024-01-01T10:01:00Z", "completed_at": "2024-01-01T10:04:00Z"}]}`))
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	client := eg.NewClient(nil)
+	client.BaseURL, _ = url.Parse(server.URL + "/")
+	return client
+}
+
+func TestBackfillResumesFromCheckpoint(t *testing.T) {
+	// Arrange
+	checkpointPath := filepath.Join(t.TempDir(), "checkpoint.json")
+	tracer, exporter := internal.NewTestTracerWithExporter()
+	opts := Options{
+		Repos:       []string{"octo/repo"},
+		Since:       time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		Until:       time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC),
+		Concurrency: 2,
+	}
+	checkpoint, err := LoadCheckpoint(checkpointPath)
+	assert.NoError(t, err)
+	assert.NoError(t, checkpoint.UseRange(opts.Since, opts.Until))
+	assert.NoError(t, checkpoint.MarkExported("octo/repo", 1, 1))
+
+	// a new checkpoint is loaded to make sure the progress was written to disk
+	checkpoint, err = LoadCheckpoint(checkpointPath)
+	assert.NoError(t, err)
+	backfiller, err := NewBackfiller(newTestClient(t), ig.NewRateBudget(0), tracer, checkpoint, opts, &bytes.Buffer{})
+	assert.NoError(t, err)
+
+	// Act
+	summary, err := backfiller.Run(context.Background())
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, Summary{Listed: 2, Exported: 1, Skipped: 1}, summary)
+	assert.Equal(t, 3, len(exporter.GetSpans()), "expected root, queued and job spans for the run that wasn't exported yet")
+	assert.Equal(t, ig.RunTraceID(2, 1), exporter.GetSpans()[0].SpanContext.TraceID())
+
+	checkpoint, err = LoadCheckpoint(checkpointPath)
+	assert.NoError(t, err)
+	assert.True(t, checkpoint.IsRepoDone("octo/repo"))
+}
+
+func TestBackfillRefusesCheckpointOfAnotherRange(t *testing.T) {
+	// Arrange
+	checkpointPath := filepath.Join(t.TempDir(), "checkpoint.json")
+	checkpoint, err := LoadCheckpoint(checkpointPath)
+	assert.NoError(t, err)
+	january := Options{Repos: []string{"octo/repo"}, Since: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), Until: time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)}
+	assert.NoError(t, checkpoint.UseRange(january.Since, january.Until))
+	assert.NoError(t, checkpoint.MarkRepoDone("octo/repo"))
+
+	tests := map[string]struct {
+		since    time.Time
+		until    time.Time
+		expected bool
+	}{
+		"same range":     {since: january.Since, until: january.Until, expected: true},
+		"later range":    {since: january.Until, until: time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)},
+		"extended range": {since: january.Since, until: time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			// a new checkpoint is loaded to make sure the range was written to disk
+			checkpoint, err := LoadCheckpoint(checkpointPath)
+			assert.NoError(t, err)
+			opts := Options{Repos: []string{"octo/repo"}, Since: test.since, Until: test.until}
+
+			// Act
+			_, err = NewBackfiller(newTestClient(t), ig.NewRateBudget(0), internal.NewTestTracer(), checkpoint, opts, &bytes.Buffer{})
+
+			// Assert
+			if test.expected {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorContains(t, err, "use another checkpoint")
+			}
+		})
+	}
+}
+
+func TestBackfillDryRun(t *testing.T) {
+	// Arrange
+	tracer, exporter := internal.NewTestTracerWithExporter()
+	checkpoint, err := LoadCheckpoint("")
+	assert.NoError(t, err)
+	out := &bytes.Buffer{}
+	opts := Options{
+		Repos:  []string{"octo/repo"},
+		Since:  time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		Until:  time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC),
+		DryRun: true,
+	}
+	backfiller, err := NewBackfiller(newTestClient(t), ig.NewRateBudget(0), tracer, checkpoint, opts, out)
+	assert.NoError(t, err)
+
+	// Act
+	summary, err := backfiller.Run(context.Background())
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, 2, summary.Listed)
+	assert.Equal(t, 0, len(exporter.GetSpans()))
+	assert.Contains(t, out.String(), "octo/repo\t1\t1\t2024-01-01T10:00:00Z")
+	assert.Contains(t, out.String(), "octo/repo\t2\t1\t2024-01-01T11:00:00Z")
+	assert.False(t, checkpoint.IsRepoDone("octo/repo"))
+}
+
+func TestBackfillSplitsWindowsWithTooManyRuns(t *testing.T) {
+	// Arrange
+	created := []time.Time{
+		time.Date(2024, 1, 1, 1, 0, 0, 0, time.UTC),
+		time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC),
+		time.Date(2024, 1, 1, 23, 0, 0, 0, time.UTC),
+	}
+	var queries []string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/octo/repo/actions/runs", func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query().Get("created")
+		queries = append(queries, query)
+		start, end, _ := strings.Cut(query, "..")
+		from, _ := time.Parse(time.RFC3339, start)
+		to, _ := time.Parse(time.RFC3339, end)
+
+		// pretends that windows longer than 6 hours have more runs than the api lists
+		runs := []map[string]any{}
+		for i, at := range created {
+			if !at.Before(from) && !at.After(to) {
+				runs = append(runs, map[string]any{"id": i + 1, "run_attempt": 1, "created_at": at})
+			}
+		}
+		total := len(runs)
+		if to.Sub(from) > 6*time.Hour {
+			total = 1001
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"total_count": total, "workflow_runs": runs})
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	client := eg.NewClient(nil)
+	client.BaseURL, _ = url.Parse(server.URL + "/")
+
+	tracer, _ := internal.NewTestTracerWithExporter()
+	checkpoint, err := LoadCheckpoint("")
+	assert.NoError(t, err)
+	opts := Options{
+		Repos: []string{"octo/repo"},
+		Since: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		Until: time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC),
+	}
+	backfiller, err := NewBackfiller(client, ig.NewRateBudget(0), tracer, checkpoint, opts, &bytes.Buffer{})
+	assert.NoError(t, err)
+
+	// Act
+	runs, err := backfiller.listRuns(context.Background(), "octo/repo")
+
+	// Assert
+	assert.NoError(t, err)
+	ids := []int64{}
+	for _, run := range runs {
+		ids = append(ids, run.GetID())
+	}
+	assert.Equal(t, []int64{1, 2, 3}, ids, "the runs should be listed in order")
+	assert.Equal(t, []string{
+		"2024-01-01T00:00:00Z..2024-01-02T00:00:00Z",
+		"2024-01-01T00:00:00Z..2024-01-01T12:00:00Z",
+		"2024-01-01T00:00:00Z..2024-01-01T06:00:00Z",
+		"2024-01-01T06:00:00Z..2024-01-01T12:00:00Z",
+		"2024-01-01T12:00:00Z..2024-01-02T00:00:00Z",
+		"2024-01-01T12:00:00Z..2024-01-01T18:00:00Z",
+		"2024-01-01T18:00:00Z..2024-01-02T00:00:00Z",
+	}, queries)
+}
+
+func TestBackfillWarnsAboutWindowsThatCantBeSplit(t *testing.T) {
+	// Arrange
+	requests := 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/octo/repo/actions/runs", func(w http.ResponseWriter, r *http.Request) {
+		requests += 1
+		_, _ = w.Write([]byte(`{"total_count": 5000, "workflow_runs": [{"id": 1, "run_attempt": 1, "created_at": "2024-01-01T00:00:00Z"}]}`))
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	client := eg.NewClient(nil)
+	client.BaseURL, _ = url.Parse(server.URL + "/")
+
+	tracer, _ := internal.NewTestTracerWithExporter()
+	checkpoint, err := LoadCheckpoint("")
+	assert.NoError(t, err)
+	opts := Options{
+		Repos: []string{"octo/repo"},
+		Since: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		Until: time.Date(2024, 1, 1, 0, 0, 4, 0, time.UTC),
+	}
+	backfiller, err := NewBackfiller(client, ig.NewRateBudget(0), tracer, checkpoint, opts, &bytes.Buffer{})
+	assert.NoError(t, err)
+
+	// Act
+	runs, err := backfiller.listRuns(context.Background(), "octo/repo")
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(runs), "the runs of the windows that can't be split should still be listed")
+	assert.Equal(t, 7, requests, "the 4 second window should be split into 1 second windows")
+}
@@ -0,0 +1,156 @@
+package backfill
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pitoniak32/trace-export/pkg/internal"
+)
+
+// Checkpoint records the progress of a backfill, so it can be resumed without exporting the same
+// workflow runs again.
+type Checkpoint struct {
+	mu   sync.Mutex
+	path string
+	// the date range of the backfill, the repos are only done for it
+	Since time.Time `json:"since"`
+	Until time.Time `json:"until"`
+	// progress of each repo, keyed by 'owner/repo'
+	Repos map[string]*RepoProgress `json:"repos"`
+}
+
+type RepoProgress struct {
+	// set once every run of the repo in the date range has been exported
+	Done bool `json:"done"`
+	// the runs that have been exported, keyed by 'run_id/run_attempt'
+	Exported map[string]bool `json:"exported,omitempty"`
+}
+
+// LoadCheckpoint reads the checkpoint from the path, a missing file is an empty checkpoint.
+func LoadCheckpoint(path string) (*Checkpoint, error) {
+	c := &Checkpoint{path: path, Repos: make(map[string]*RepoProgress)}
+	if path == "" {
+		return c, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read checkpoint '%s': %w", path, err)
+	}
+
+	err = json.Unmarshal(data, c)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse checkpoint '%s': %w", path, err)
+	}
+	if c.Repos == nil {
+		c.Repos = make(map[string]*RepoProgress)
+	}
+
+	return c, nil
+}
+
+// Range returns the date range of the backfill the checkpoint is of, zero when it isn't of one yet.
+func (c *Checkpoint) Range() (time.Time, time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.Since, c.Until
+}
+
+// UseRange records the date range of the backfill in a new checkpoint. The progress of another
+// range can't be resumed, the repos that are done would be skipped without exporting the runs that
+// are only in this range.
+func (c *Checkpoint) UseRange(since time.Time, until time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.Since.IsZero() && len(c.Repos) == 0 {
+		c.Since, c.Until = since, until
+		return nil
+	}
+	if c.Since.IsZero() {
+		return fmt.Errorf("checkpoint '%s' doesn't record the date range of its backfill, remove it or use another checkpoint", c.path)
+	}
+	if !c.Since.Equal(since) || !c.Until.Equal(until) {
+		return fmt.Errorf("checkpoint '%s' is of the backfill from '%s' to '%s', use another checkpoint to backfill from '%s' to '%s'",
+			c.path, c.Since.Format(time.RFC3339), c.Until.Format(time.RFC3339), since.Format(time.RFC3339), until.Format(time.RFC3339))
+	}
+	return nil
+}
+
+func runKey(runId int64, runAttempt int) string {
+	return fmt.Sprintf("%d/%d", runId, runAttempt)
+}
+
+func (c *Checkpoint) IsRepoDone(repo string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	progress, ok := c.Repos[repo]
+	return ok && progress.Done
+}
+
+func (c *Checkpoint) IsExported(repo string, runId int64, runAttempt int) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	progress, ok := c.Repos[repo]
+	return ok && progress.Exported[runKey(runId, runAttempt)]
+}
+
+func (c *Checkpoint) MarkExported(repo string, runId int64, runAttempt int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	progress := c.progress(repo)
+	progress.Exported[runKey(runId, runAttempt)] = true
+	return c.save()
+}
+
+// MarkRepoDone marks the repo as done, and drops the runs that were recorded for it.
+func (c *Checkpoint) MarkRepoDone(repo string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.Repos[repo] = &RepoProgress{Done: true}
+	return c.save()
+}
+
+// progress must be called with the lock held.
+func (c *Checkpoint) progress(repo string) *RepoProgress {
+	progress, ok := c.Repos[repo]
+	if !ok {
+		progress = &RepoProgress{}
+		c.Repos[repo] = progress
+	}
+	if progress.Exported == nil {
+		progress.Exported = make(map[string]bool)
+	}
+	return progress
+}
+
+// save must be called with the lock held.
+func (c *Checkpoint) save() error {
+	if c.path == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode checkpoint: %w", err)
+	}
+
+	err = internal.WriteFileAtomic(c.path, data)
+	if err != nil {
+		return fmt.Errorf("failed to write checkpoint '%s': %w", c.path, err)
+	}
+
+	return nil
+}
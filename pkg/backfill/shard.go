@@ -0,0 +1,78 @@
+package backfill
+
+import (
+	"fmt"
+	"hash/fnv"
+	"os"
+	"strconv"
+	"strings"
+
+	myOtel "github.com/pitoniak32/trace-export/pkg/otel"
+)
+
+// Shard is the part of the repo/run space that a single task of a sharded backfill exports.
+type Shard struct {
+	Index int
+	Count int
+}
+
+// ShardFromEnv reads the shard from the variables that Cloud Run sets for each task of a job. When
+// they are not set the backfill is not sharded.
+func ShardFromEnv() (Shard, error) {
+	shard := Shard{Index: 0, Count: 1}
+
+	if value := os.Getenv(myOtel.CLOUD_RUN_TASK_INDEX_KEY); value != "" {
+		index, err := strconv.Atoi(value)
+		if err != nil {
+			return shard, fmt.Errorf("invalid %s '%s': %w", myOtel.CLOUD_RUN_TASK_INDEX_KEY, value, err)
+		}
+		shard.Index = index
+	}
+
+	if value := os.Getenv(myOtel.CLOUD_RUN_TASK_COUNT_KEY); value != "" {
+		count, err := strconv.Atoi(value)
+		if err != nil {
+			return shard, fmt.Errorf("invalid %s '%s': %w", myOtel.CLOUD_RUN_TASK_COUNT_KEY, value, err)
+		}
+		shard.Count = count
+	}
+
+	return shard, shard.Validate()
+}
+
+func (s Shard) Validate() error {
+	if s.Count < 1 || s.Index < 0 || s.Index >= s.Count {
+		return fmt.Errorf("invalid shard %d of %d", s.Index, s.Count)
+	}
+	return nil
+}
+
+// Owns reports whether the run belongs to this shard. Runs are spread over the shards by a hash of
+// the repo and run id, so every task makes the same decision without coordinating.
+func (s Shard) Owns(repo string, runId int64) bool {
+	if s.Count <= 1 {
+		return true
+	}
+
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(fmt.Sprintf("%s/%d", repo, runId)))
+	return h.Sum64()%uint64(s.Count) == uint64(s.Index)
+}
+
+// CheckpointPath returns the path of the checkpoint file for this shard, each task records its own
+// progress so they don't overwrite each other.
+func (s Shard) CheckpointPath(path string) string {
+	if s.Count <= 1 || path == "" {
+		return path
+	}
+
+	suffix := fmt.Sprintf(".%d-of-%d", s.Index, s.Count)
+	if base, ok := strings.CutSuffix(path, ".json"); ok {
+		return base + suffix + ".json"
+	}
+	return path + suffix
+}
+
+func (s Shard) String() string {
+	return fmt.Sprintf("%d/%d", s.Index, s.Count)
+}
@@ -0,0 +1,86 @@
+package backfill
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShardFromEnv(t *testing.T) {
+	// Arrange
+	tests := map[string]struct {
+		givenIndex    string
+		givenCount    string
+		expectedShard Shard
+		expectedErr   bool
+	}{
+		"not running as a cloud run job": {
+			expectedShard: Shard{Index: 0, Count: 1},
+		},
+		"third task of four": {
+			givenIndex:    "2",
+			givenCount:    "4",
+			expectedShard: Shard{Index: 2, Count: 4},
+		},
+		"index out of range": {
+			givenIndex:  "4",
+			givenCount:  "4",
+			expectedErr: true,
+		},
+		"count is not a number": {
+			givenIndex:  "0",
+			givenCount:  "four",
+			expectedErr: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv("CLOUD_RUN_TASK_INDEX", test.givenIndex)
+			t.Setenv("CLOUD_RUN_TASK_COUNT", test.givenCount)
+
+			// Act
+			shard, err := ShardFromEnv()
+
+			// Assert
+			if test.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, test.expectedShard, shard)
+		})
+	}
+}
+
+func TestShardOwnsEveryRunExactlyOnce(t *testing.T) {
+	// Arrange
+	count := 5
+	owned := make([]int, count)
+
+	// Act
+	for _, repo := range []string{"octo/a", "octo/b", "other/c"} {
+		for runId := int64(1); runId <= 200; runId++ {
+			owners := 0
+			for index := 0; index < count; index++ {
+				if (Shard{Index: index, Count: count}).Owns(repo, runId) {
+					owners += 1
+					owned[index] += 1
+				}
+			}
+
+			// Assert
+			assert.Equal(t, 1, owners, fmt.Sprintf("run %s/%d should be owned by exactly one shard", repo, runId))
+		}
+	}
+	for index, runs := range owned {
+		assert.Greater(t, runs, 0, fmt.Sprintf("shard %d should own some of the runs", index))
+	}
+}
+
+func TestShardCheckpointPath(t *testing.T) {
+	assert.Equal(t, "backfill-checkpoint.json", Shard{Index: 0, Count: 1}.CheckpointPath("backfill-checkpoint.json"))
+	assert.Equal(t, "backfill-checkpoint.1-of-3.json", Shard{Index: 1, Count: 3}.CheckpointPath("backfill-checkpoint.json"))
+	assert.Equal(t, "progress.1-of-3", Shard{Index: 1, Count: 3}.CheckpointPath("progress"))
+}
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"maps"
 	"sync"
 	"time"
 
@@ -19,74 +20,111 @@ var (
 	tracer = otel.Tracer(myOtel.SERVICE_TRACER_NAME)
 )
 
+// the lookups of repos that failed are not retried for this long, so every webhook of the repo
+// doesn't call the api again
+const FAILED_LOOKUP_TTL = time.Minute
+
 type CacheEntry struct {
 	UpdatedAtMillis int64
 	Props           map[string]string
 }
 
+// EntryRefreshFn updates the entry for name in place, it is called for each entry that needs a refresh.
+type EntryRefreshFn func(ctx context.Context, name string, entry *CacheEntry) error
+
 type PropCache struct {
+	mu sync.RWMutex
 	// the number of seconds that need to pass since the UpdatedAt of an entry for it to be expired
 	expireAfter time.Duration
 	entries     map[string]CacheEntry
 	// will be called for each entry that is considered expired when a cache refresh is requested
-	entryRefreshFn func(ctx context.Context, name string, entry *CacheEntry) error
+	entryRefreshFn EntryRefreshFn
+	// the repos whose lookup failed, and when, they are looked up again after failedLookupTTL
+	failedLookups   map[string]failedLookup
+	failedLookupTTL time.Duration
+	now             func() time.Time
 }
 
-func NewPropCache(expireAfter time.Duration) PropCache {
-	c := PropCache{
-		expireAfter: expireAfter,
-		entries:     make(map[string]CacheEntry),
-		entryRefreshFn: func(ctx context.Context, name string, entry *CacheEntry) error {
-			span := trace.SpanFromContext(ctx)
-
-			time.Sleep(2 * time.Second)
-			// Create a timeout to make sure that the refresh doesnt hang forever
-			// ctxTimeout, cancelRefresh := context.WithTimeout(ctx, 5*time.Second)
-			// defer cancelRefresh()
-
-			// req, err := http.NewRequestWithContext(ctxTimeout, http.MethodGet, "https://jsonplaceholder.typicode.com/todos/1", nil)
-			// if err != nil {
-			// 	fmt.Println("Error creating request:", err)
-			// 	return err
-			// }
-			//
-			// client := &http.Client{}
-			// resp, err := client.Do(req)
-			// if err != nil {
-			// 	return err
-			// }
-			// defer resp.Body.Close()
-			//
-			// body, _ := io.ReadAll(resp.Body)
-			// fmt.Println("Response:", string(body))
-
-			if name == "trace-export" {
-				err := fmt.Errorf("ran into error updating repo '%s'", name)
-				span.SetStatus(codes.Error, err.Error())
-			} else {
-				entry.UpdatedAtMillis = time.Now().UnixMilli()
-			}
+type failedLookup struct {
+	at  time.Time
+	err error
+}
 
-			return nil
-		},
+func NewPropCache(expireAfter time.Duration, entryRefreshFn EntryRefreshFn) *PropCache {
+	c := &PropCache{
+		expireAfter:     expireAfter,
+		entries:         make(map[string]CacheEntry),
+		entryRefreshFn:  entryRefreshFn,
+		failedLookups:   make(map[string]failedLookup),
+		failedLookupTTL: FAILED_LOOKUP_TTL,
+		now:             time.Now,
 	}
 	return c
 }
 
 func (c *PropCache) InsertMap(inEntries map[string]CacheEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
 	for name, entry := range inEntries {
 		c.entries[name] = entry
 	}
 }
 
 func (c *PropCache) Insert(name string, entry CacheEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
 	c.entries[name] = entry
 }
 
 func (c *PropCache) GetProps(repoName string) map[string]string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
 	return c.entries[repoName].Props
 }
 
+// GetOrRefreshProps returns the props of the repo, refreshing its entry first when it is not in the
+// cache yet. The refreshed entry is inserted, so the scheduled refresh will keep it up to date. A
+// failed refresh is returned again, without refreshing, until it is older than FAILED_LOOKUP_TTL.
+func (c *PropCache) GetOrRefreshProps(ctx context.Context, repoName string) (map[string]string, error) {
+	c.mu.RLock()
+	entry, ok := c.entries[repoName]
+	failed, hasFailed := c.failedLookups[repoName]
+	c.mu.RUnlock()
+	if ok {
+		return entry.Props, nil
+	}
+	if hasFailed && c.now().Sub(failed.at) < c.failedLookupTTL {
+		return nil, fmt.Errorf("the lookup failed %s ago: %w", c.now().Sub(failed.at).Round(time.Second), failed.err)
+	}
+
+	ctx, span := tracer.Start(ctx, "RefreshMissingCacheEntry", trace.WithAttributes(attribute.String("cache.entry.name", repoName)))
+	defer span.End()
+
+	err := c.entryRefreshFn(ctx, repoName, &entry)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		c.mu.Lock()
+		now := c.now()
+		for name, failed := range c.failedLookups {
+			if now.Sub(failed.at) >= c.failedLookupTTL {
+				delete(c.failedLookups, name)
+			}
+		}
+		c.failedLookups[repoName] = failedLookup{at: now, err: err}
+		c.mu.Unlock()
+		return nil, err
+	}
+
+	c.mu.Lock()
+	c.entries[repoName] = entry
+	delete(c.failedLookups, repoName)
+	c.mu.Unlock()
+	return entry.Props, nil
+}
+
 func runAndWait(inverval time.Duration, fn func()) {
 	earlier := time.Now()
 	fn()
@@ -116,7 +154,7 @@ func (c *PropCache) ScheduleRefresh(ctx context.Context, interval time.Duration)
 					if errors.As(errs, &joined) {
 						joinedErrs := joined.Unwrap()
 						for _, err := range joinedErrs {
-							slog.Error("failed to refresh cache entry: %s\n", err)
+							slog.Error("failed to refresh cache entry", "err", err)
 						}
 						failedCount = len(joinedErrs)
 					}
@@ -164,8 +202,13 @@ func (c *PropCache) refreshCache(ctx context.Context, isExpired func(ctx context
 	var wg sync.WaitGroup
 	ch := make(chan error)
 
+	// refresh a copy of the entries, so the lock isn't held while the refresh functions run.
+	c.mu.RLock()
+	entries := maps.Clone(c.entries)
+	c.mu.RUnlock()
+
 	skippedCount := 0
-	for name, entry := range c.entries {
+	for name, entry := range entries {
 		ctx, span := tracer.Start(ctx, name)
 		defer span.End()
 
@@ -179,7 +222,11 @@ func (c *PropCache) refreshCache(ctx context.Context, isExpired func(ctx context
 			wg.Add(1)
 			go func() {
 				defer wg.Done()
-				ch <- c.entryRefreshFn(ctx, name, &entry)
+				err := c.entryRefreshFn(ctx, name, &entry)
+				if err == nil {
+					c.Insert(name, entry)
+				}
+				ch <- err
 			}()
 		} else {
 			skippedCount += 1
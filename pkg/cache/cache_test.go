@@ -34,7 +34,7 @@ func TestNewPropCache(t *testing.T) {
 			t.Parallel()
 
 			// Arrange
-			cache := NewPropCache()
+			cache := NewPropCache(time.Hour, testingEntryRefreshFn)
 
 			// Act
 			cache.InsertMap(test.givenEntries)
@@ -58,13 +58,13 @@ func testingEntryRefreshFn(ctx context.Context, name string, entry *CacheEntry)
 func TestRefreshCacheAt(t *testing.T) {
 	// Arrange
 	tests := map[string]struct {
-		givenCache           PropCache
+		givenCache           *PropCache
 		givenTimestamp       time.Time
 		expectedSuccessCount int
 		expectedErrs         error
 	}{
 		"should not refresh when no entries have expired": {
-			givenCache: PropCache{
+			givenCache: &PropCache{
 				expireAfter: 1 * time.Millisecond,
 				entries: map[string]CacheEntry{
 					"test1": {UpdatedAtMillis: 5, Props: make(map[string]string)},
@@ -77,7 +77,7 @@ func TestRefreshCacheAt(t *testing.T) {
 			expectedErrs:         nil,
 		},
 		"should refresh 1 entry when 1 entry has expired": {
-			givenCache: PropCache{
+			givenCache: &PropCache{
 				expireAfter: 1 * time.Millisecond,
 				entries: map[string]CacheEntry{
 					"test1": {UpdatedAtMillis: 5, Props: make(map[string]string)},
@@ -90,7 +90,7 @@ func TestRefreshCacheAt(t *testing.T) {
 			expectedErrs:         nil,
 		},
 		"should refresh 2 entries when 2 entries have expired": {
-			givenCache: PropCache{
+			givenCache: &PropCache{
 				expireAfter: 1 * time.Millisecond,
 				entries: map[string]CacheEntry{
 					"test1": {UpdatedAtMillis: 5, Props: make(map[string]string)},
@@ -104,7 +104,7 @@ func TestRefreshCacheAt(t *testing.T) {
 			expectedErrs:         nil,
 		},
 		"should fail refresh gracefully and return any errors": {
-			givenCache: PropCache{
+			givenCache: &PropCache{
 				expireAfter: 1 * time.Millisecond,
 				entries: map[string]CacheEntry{
 					"test1":      {UpdatedAtMillis: 5, Props: make(map[string]string)},
@@ -123,7 +123,7 @@ func TestRefreshCacheAt(t *testing.T) {
 			t.Parallel()
 
 			// Act
-			successCount, errs := test.givenCache.RefreshCacheExpiredAt(context.Background(), test.givenTimestamp)
+			successCount, _, errs := test.givenCache.RefreshCacheExpiredAt(context.Background(), test.givenTimestamp)
 
 			// Assert
 			assert.Equal(t, test.expectedErrs, errs)
@@ -135,13 +135,13 @@ func TestRefreshCacheAt(t *testing.T) {
 func TestRefreshCacheForce(t *testing.T) {
 	// Arrange
 	tests := map[string]struct {
-		givenCache           PropCache
+		givenCache           *PropCache
 		givenTimestamp       time.Time
 		expectedSuccessCount int
 		expectedErrs         error
 	}{
 		"should refresh all entries even if none are expired": {
-			givenCache: PropCache{
+			givenCache: &PropCache{
 				expireAfter: 1000 * time.Millisecond,
 				entries: map[string]CacheEntry{
 					"test1": {UpdatedAtMillis: 1, Props: make(map[string]string)},
@@ -153,7 +153,7 @@ func TestRefreshCacheForce(t *testing.T) {
 			expectedSuccessCount: 2,
 		},
 		"should refresh all entries even if 1 entry has expired": {
-			givenCache: PropCache{
+			givenCache: &PropCache{
 				expireAfter: 1 * time.Millisecond,
 				entries: map[string]CacheEntry{
 					"test1": {UpdatedAtMillis: 5, Props: make(map[string]string)},
@@ -165,7 +165,7 @@ func TestRefreshCacheForce(t *testing.T) {
 			expectedSuccessCount: 2,
 		},
 		"should refresh all entries even if 2 entries have expired": {
-			givenCache: PropCache{
+			givenCache: &PropCache{
 				expireAfter: 1 * time.Millisecond,
 				entries: map[string]CacheEntry{
 					"test1": {UpdatedAtMillis: 5, Props: make(map[string]string)},
@@ -184,7 +184,7 @@ func TestRefreshCacheForce(t *testing.T) {
 			t.Parallel()
 
 			// Act
-			count, errs := test.givenCache.RefreshCacheForce(context.Background())
+			count, _, errs := test.givenCache.RefreshCacheForce(context.Background())
 
 			// Assert
 			assert.Equal(t, test.expectedErrs, errs)
@@ -192,3 +192,39 @@ func TestRefreshCacheForce(t *testing.T) {
 		})
 	}
 }
+
+func TestGetOrRefreshPropsCachesFailures(t *testing.T) {
+	// Arrange
+	calls := 0
+	failing := true
+	cache := NewPropCache(time.Hour, func(ctx context.Context, name string, entry *CacheEntry) error {
+		calls += 1
+		if failing {
+			return errors.New("failed")
+		}
+		entry.Props = map[string]string{"team": "platform"}
+		return nil
+	})
+	now := time.Now()
+	cache.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	// Act
+	_, first := cache.GetOrRefreshProps(ctx, "octo/repo")
+	_, cached := cache.GetOrRefreshProps(ctx, "octo/repo")
+
+	// Assert
+	assert.Error(t, first)
+	assert.Error(t, cached)
+	assert.Equal(t, 1, calls, "the failed lookup should not be retried before FAILED_LOOKUP_TTL")
+
+	// Act
+	failing = false
+	now = now.Add(FAILED_LOOKUP_TTL)
+	props, err := cache.GetOrRefreshProps(ctx, "octo/repo")
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, 2, calls)
+	assert.Equal(t, map[string]string{"team": "platform"}, props)
+}
@@ -0,0 +1,157 @@
+package chrometrace
+
+import (
+	"encoding/json"
+	"io"
+
+	"github.com/pitoniak32/trace-export/pkg/spantree"
+)
+
+// the attribute of a job span with the runner it ran on
+const runnerNameKey = "workflow_job.runner_name"
+
+// the thread of the run and the spans that aren't part of a job, like the time it was queued
+const runThreadID = 0
+
+// Trace is the JSON Object Format of the Trace Event Format, which chrome://tracing and
+// ui.perfetto.dev can open.
+// https://docs.google.com/document/d/1CvAClvFfyA5R-PhYUmn5OOQtYMH4h6I0nSsKchNAySU
+type Trace struct {
+	TraceEvents     []Event `json:"traceEvents"`
+	DisplayTimeUnit string  `json:"displayTimeUnit"`
+}
+
+type Event struct {
+	Name string `json:"name"`
+	Cat  string `json:"cat,omitempty"`
+	// 'X' for a complete event (a span), 'M' for the metadata that names processes and threads
+	Ph string `json:"ph"`
+	// in microseconds
+	Ts    int64          `json:"ts"`
+	Dur   int64          `json:"dur,omitempty"`
+	Pid   int            `json:"pid"`
+	Tid   int            `json:"tid"`
+	Cname string         `json:"cname,omitempty"`
+	Args  map[string]any `json:"args,omitempty"`
+}
+
+// Convert turns every tree of spans (like the trace of a workflow run) into a process. The jobs
+// are put on a thread per runner they ran on, with their steps, so the jobs that ran at the same
+// time are shown side by side. The run itself and anything that isn't part of a job is on the
+// first thread.
+func Convert(roots []*spantree.Node) Trace {
+	trace := Trace{TraceEvents: []Event{}, DisplayTimeUnit: "ms"}
+	for i, root := range roots {
+		c := converter{pid: i + 1, threads: map[string]int{}}
+		c.addThread(runThreadID, "workflow run")
+		c.add(root, runThreadID, true)
+
+		trace.TraceEvents = append(trace.TraceEvents, Event{
+			Name: "process_name",
+			Ph:   "M",
+			Pid:  c.pid,
+			Args: map[string]any{"name": root.Name},
+		})
+		trace.TraceEvents = append(trace.TraceEvents, c.events...)
+	}
+	return trace
+}
+
+// Write writes the trace of the span trees as JSON.
+func Write(w io.Writer, roots []*spantree.Node) error {
+	return json.NewEncoder(w).Encode(Convert(roots))
+}
+
+type converter struct {
+	pid    int
+	events []Event
+	// the thread of every runner, by its name
+	threads map[string]int
+	// the threads after the run thread, so they are numbered in the order they are first used
+	count int
+}
+
+func (c *converter) add(node *spantree.Node, tid int, root bool) {
+	if !root {
+		tid = c.threadOf(node, tid)
+	}
+
+	event := Event{
+		Name: node.Name,
+		Cat:  category(node),
+		Ph:   "X",
+		Ts:   node.StartTime.UnixMicro(),
+		Dur:  node.EndTime.Sub(node.StartTime).Microseconds(),
+		Pid:  c.pid,
+		Tid:  tid,
+		Args: args(node),
+	}
+	if node.Status.Code == "Error" {
+		// the red of the legacy viewer
+		event.Cname = "terrible"
+	}
+	c.events = append(c.events, event)
+
+	for _, child := range node.Children {
+		c.add(child, tid, false)
+	}
+}
+
+// threadOf returns the thread of a span, jobs get the thread of their runner and everything else
+// stays on the thread of its parent.
+func (c *converter) threadOf(node *spantree.Node, parent int) int {
+	value, ok := node.Attributes[runnerNameKey]
+	if !ok {
+		return parent
+	}
+	runner, _ := value.(string)
+
+	// jobs that never got a runner (like skipped ones) get a thread of their own
+	name := "runner " + runner
+	if runner == "" {
+		name = "job " + node.Name + " " + node.SpanID
+	}
+	if tid, ok := c.threads[name]; ok {
+		return tid
+	}
+
+	c.count += 1
+	c.threads[name] = c.count
+	c.addThread(c.count, name)
+	return c.count
+}
+
+func (c *converter) addThread(tid int, name string) {
+	c.events = append(c.events,
+		Event{Name: "thread_name", Ph: "M", Pid: c.pid, Tid: tid, Args: map[string]any{"name": name}},
+		Event{Name: "thread_sort_index", Ph: "M", Pid: c.pid, Tid: tid, Args: map[string]any{"sort_index": tid}},
+	)
+}
+
+func category(node *spantree.Node) string {
+	switch {
+	case node.Attributes["workflow_run.id"] != nil:
+		return "workflow_run"
+	case node.Attributes["workflow_job.id"] != nil:
+		return "workflow_job"
+	case node.Attributes["step.number"] != nil:
+		return "step"
+	default:
+		return "span"
+	}
+}
+
+func args(node *spantree.Node) map[string]any {
+	args := make(map[string]any, len(node.Attributes)+2)
+	for key, value := range node.Attributes {
+		args[key] = value
+	}
+	args["span_id"] = node.SpanID
+	if node.Status.Code != "Unset" {
+		args["status"] = node.Status.Code
+		if node.Status.Description != "" {
+			args["status.description"] = node.Status.Description
+		}
+	}
+	return args
+}
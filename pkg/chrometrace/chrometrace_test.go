@@ -0,0 +1,63 @@
+package chrometrace
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pitoniak32/trace-export/pkg/spantree"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConvert(t *testing.T) {
+	// Arrange
+	start := time.UnixMicro(1_000_000)
+	node := func(name string, from time.Duration, to time.Duration, attributes map[string]any, children ...*spantree.Node) *spantree.Node {
+		return &spantree.Node{
+			Name:       name,
+			SpanID:     name,
+			StartTime:  start.Add(from),
+			EndTime:    start.Add(to),
+			Attributes: attributes,
+			Status:     spantree.Status{Code: "Unset"},
+			Children:   children,
+		}
+	}
+	failed := node("test", 2*time.Second, 5*time.Second, map[string]any{"workflow_job.id": int64(2), "workflow_job.runner_name": "runner-2"})
+	failed.Status = spantree.Status{Code: "Error", Description: "exit 1"}
+	root := node("ci", 0, 10*time.Second, map[string]any{"workflow_run.id": int64(1)},
+		node("Queued", 0, time.Second, nil),
+		node("build", time.Second, 4*time.Second, map[string]any{"workflow_job.id": int64(1), "workflow_job.runner_name": "runner-1"},
+			node("go build", time.Second, 3*time.Second, map[string]any{"step.number": int64(1)}),
+		),
+		failed,
+		node("lint", 4*time.Second, 6*time.Second, map[string]any{"workflow_job.id": int64(3), "workflow_job.runner_name": "runner-1"}),
+		node("deploy", 0, 0, map[string]any{"workflow_job.id": int64(4), "workflow_job.runner_name": ""}),
+	)
+
+	// Act
+	trace := Convert([]*spantree.Node{root})
+
+	// Assert
+	threads := map[int]string{}
+	spans := map[string]Event{}
+	for _, event := range trace.TraceEvents {
+		assert.Equal(t, 1, event.Pid)
+		switch {
+		case event.Name == "thread_name":
+			threads[event.Tid] = event.Args["name"].(string)
+		case event.Ph == "X":
+			spans[event.Name] = event
+		}
+	}
+	assert.Equal(t, map[int]string{0: "workflow run", 1: "runner runner-1", 2: "runner runner-2", 3: "job deploy deploy"}, threads)
+
+	assert.Equal(t, Event{Name: "ci", Cat: "workflow_run", Ph: "X", Ts: 1_000_000, Dur: 10_000_000, Pid: 1, Tid: 0, Args: map[string]any{"workflow_run.id": int64(1), "span_id": "ci"}}, spans["ci"])
+	assert.Equal(t, 0, spans["Queued"].Tid)
+	assert.Equal(t, 1, spans["build"].Tid)
+	assert.Equal(t, 1, spans["go build"].Tid, "steps should be on the thread of their job")
+	assert.Equal(t, "step", spans["go build"].Cat)
+	assert.Equal(t, 1, spans["lint"].Tid, "jobs on the same runner should share a thread")
+	assert.Equal(t, 2, spans["test"].Tid)
+	assert.Equal(t, "terrible", spans["test"].Cname)
+	assert.Equal(t, "exit 1", spans["test"].Args["status.description"])
+}
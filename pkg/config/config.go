@@ -1,11 +1,655 @@
 package config
 
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"net/url"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	myOtel "github.com/pitoniak32/trace-export/pkg/otel"
+	"github.com/pitoniak32/trace-export/pkg/sampling"
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the configuration of every command. It is loaded from a YAML file, overridden by
+// environment variables and then flags, and validated before anything is constructed from it.
 type Config struct {
-	otel ConfigOtel
+	Server     Server     `yaml:"server"`
+	GitHub     GitHub     `yaml:"github"`
+	Webhook    Webhook    `yaml:"webhook"`
+	Recorder   Recorder   `yaml:"recorder"`
+	Exporter   Exporter   `yaml:"exporter"`
+	Handler    Handler    `yaml:"handler"`
+	Cache      Cache      `yaml:"cache"`
+	Poll       Poll       `yaml:"poll"`
+	Filters    Filters    `yaml:"filters"`
+	Enrichment Enrichment `yaml:"enrichment"`
+	Sampling   Sampling   `yaml:"sampling"`
+	Features   Features   `yaml:"features"`
+	Admin      Admin      `yaml:"admin"`
+}
+
+type Server struct {
+	Addr         string        `yaml:"addr"`
+	ReadTimeout  time.Duration `yaml:"read_timeout"`
+	WriteTimeout time.Duration `yaml:"write_timeout"`
+	LogLevel     string        `yaml:"log_level"`
+	// how often the config file is checked for changes, 0 only reloads on SIGHUP
+	ConfigWatchInterval time.Duration `yaml:"config_watch_interval"`
+}
+
+// GitHub is how the api is called, either with a token or as a GitHub App installation. The app is
+// used when it is configured.
+type GitHub struct {
+	Token string `yaml:"token"`
+	// only needed for GitHub Enterprise Server
+	APIURL string    `yaml:"api_url"`
+	App    GitHubApp `yaml:"app"`
+	// stop making requests when this many are left in the rate limit, until it resets
+	RateLimitReserve int `yaml:"rate_limit_reserve"`
 }
 
-type ConfigOtel struct {
+type GitHubApp struct {
+	ID             int64  `yaml:"id"`
+	InstallationID int64  `yaml:"installation_id"`
+	PrivateKeyPath string `yaml:"private_key_path"`
+	// the PEM encoded key, instead of PrivateKeyPath
+	PrivateKey string `yaml:"private_key"`
+}
+
+// Enabled reports whether the api is called as the app instead of with the token.
+func (a GitHubApp) Enabled() bool {
+	return a.ID != 0
+}
+
+type Webhook struct {
+	// payloads signed with any of the secrets are accepted, so a secret can be rotated without
+	// dropping deliveries. Payloads are not validated when there are no secrets.
+	Secrets []string `yaml:"secrets"`
+}
+
+// Recorder writes the webhooks that are received to gzip compressed JSONL files, for the replay command.
+type Recorder struct {
+	Enabled bool   `yaml:"enabled"`
+	Dir     string `yaml:"dir"`
+	// a new file is started after this many bytes of (uncompressed) records, or once the file is
+	// this old. Zero doesn't rotate on that limit.
+	MaxBytes int64         `yaml:"max_bytes"`
+	MaxAge   time.Duration `yaml:"max_age"`
+	// the headers that are recorded, the signature is left out by default
+	Headers []string `yaml:"headers"`
+	// dotted paths of payload fields that are redacted, like 'sender.email' or 'commits.*.author'
+	Redact []string `yaml:"redact"`
+}
+
+// Exporter is where the traces are sent, the OTLP settings follow the OTEL_EXPORTER_OTLP_*
+// environment variables of the spec.
+type Exporter struct {
+	OTLP `yaml:",inline"`
+	// write the spans to OTLP/JSON files instead, when a directory is set
+	File ExporterFile `yaml:"file"`
+	// post the spans to Zipkin instead, when an endpoint is set
+	Zipkin ExporterZipkin `yaml:"zipkin"`
+	// the resource of the traces of each run, like a service per repo
+	Resource ExporterResource `yaml:"resource"`
+	// how the spans are queued before they are exported, whatever the exporter
+	Batch ExporterBatch `yaml:"batch"`
+	// keep the batches of runs the collector didn't accept on disk, and export them again later
+	Buffer ExporterBuffer `yaml:"buffer"`
+	// more OTLP endpoints the traces of runs are exported to, the exporter above is named 'default'
+	Destinations []ExporterDestination `yaml:"destinations"`
+	// send the runs that match to some of the destinations, the destinations that no route names
+	// get every run, and the runs that match no route go to every destination
+	Routes []ExporterRoute `yaml:"routes"`
+}
+
+// OTLP is an endpoint the traces are exported to.
+type OTLP struct {
+	// 'host:port', or a url where 'http://' doesn't use TLS. The http/protobuf protocol appends
+	// '/v1/traces' to the path of a url.
+	OTLPEndpoint string `yaml:"otlp_endpoint"`
+	// grpc or http/protobuf, grpc is the default unlike the spec, for existing deployments
+	Protocol string            `yaml:"protocol"`
+	Headers  map[string]string `yaml:"headers"`
+	// how long an export may take, the exporter's default is used when zero
+	Timeout time.Duration `yaml:"timeout"`
+	// PEM file of the CAs that verify the collector, instead of the system ones
+	Certificate string `yaml:"certificate"`
+	// PEM files of the client certificate and its key for mTLS, they are read again when they
+	// change, like when cert-manager renews them
+	ClientCertificate string `yaml:"client_certificate"`
+	ClientKey         string `yaml:"client_key"`
+	// the name the certificate of the collector is verified against, instead of its host
+	ServerName string `yaml:"server_name"`
+	// gzip or none
+	Compression string `yaml:"compression"`
+	// don't use TLS for an endpoint without a scheme. On by default for the exporter unlike the
+	// spec, since the collector usually is a sidecar, the destinations follow the spec.
+	Insecure bool `yaml:"insecure"`
+}
+
+type ExporterDestination struct {
+	// the name the routes use
+	Name string `yaml:"name"`
+	OTLP `yaml:",inline"`
+}
+
+// ExporterRoute matches a run when it matches a pattern (of path.Match) of every list that is set.
+type ExporterRoute struct {
+	Orgs []string `yaml:"orgs"`
+	// 'owner/repo'
+	Repos     []string `yaml:"repos"`
+	Workflows []string `yaml:"workflows"`
+	// the names of the destinations the runs are sent to, including 'default'
+	Destinations []string `yaml:"destinations"`
+}
+
+// ExporterBatch follows the OTEL_BSP_* environment variables. The trace of a run is always exported
+// when its root span ends, the interval only delays the spans of the service itself.
+type ExporterBatch struct {
+	// spans that end while the queue is full are dropped
+	QueueSize int `yaml:"queue_size"`
+	// the most spans that are exported at once
+	BatchSize     int           `yaml:"batch_size"`
+	ExportTimeout time.Duration `yaml:"export_timeout"`
+	Interval      time.Duration `yaml:"interval"`
+}
+
+// ExporterBuffer keeps the batches of each OTLP destination in a directory named after it, they
+// are exported again in order once the collector is back.
+type ExporterBuffer struct {
+	// the batches aren't kept when empty
+	Dir string `yaml:"dir"`
+	// the oldest batches are dropped when the batches of a destination take more, 0 doesn't limit them
+	MaxBytes int64 `yaml:"max_bytes"`
+	// batches are dropped when they are older, 0 keeps them until they are exported
+	MaxAge time.Duration `yaml:"max_age"`
+	// the longest wait between retries, the wait doubles from a second
+	MaxBackoff time.Duration `yaml:"max_backoff"`
+}
+
+// ExporterZipkin follows the OTEL_EXPORTER_ZIPKIN_* environment variables. The batches Zipkin
+// doesn't accept aren't buffered.
+type ExporterZipkin struct {
+	// the url the spans are posted to, like 'http://localhost:9411/api/v2/spans'
+	Endpoint string        `yaml:"endpoint"`
+	Timeout  time.Duration `yaml:"timeout"`
+}
+
+// ExporterResource templates the resource of the traces of each run, with ${repo} ('owner/repo'),
+// ${owner}, ${repo_name}, ${workflow} and ${custom_properties.<name>}.
+type ExporterResource struct {
+	// the service.name, 'trace-workflow-run' when empty or when it expands to nothing
+	ServiceName string `yaml:"service_name"`
+	// attributes that expand to nothing are left out
+	Attributes map[string]string `yaml:"attributes"`
+	// the tracer provider of a resource is dropped once it wasn't used for this long
+	IdleTimeout time.Duration `yaml:"idle_timeout"`
+	// describe where the service runs in the resources of the runs and the service, of host, os,
+	// process and container
+	Detectors []string `yaml:"detectors"`
+}
+
+type ExporterFile struct {
+	Dir string `yaml:"dir"`
+	// 'run' writes a file per workflow run attempt, 'size' starts a new file after MaxBytes
+	Split    string `yaml:"split"`
+	MaxBytes int64  `yaml:"max_bytes"`
+}
+
+type Handler struct {
+	Mode string `yaml:"mode"`
+	// runs that never complete are dropped after this long
+	StateTTL      time.Duration `yaml:"state_ttl"`
+	SweepInterval time.Duration `yaml:"sweep_interval"`
+	SweepGrace    time.Duration `yaml:"sweep_grace"`
+}
+
+type Cache struct {
+	TTL             time.Duration `yaml:"ttl"`
+	RefreshInterval time.Duration `yaml:"refresh_interval"`
+}
+
+type Poll struct {
+	Repos    []string      `yaml:"repos"`
+	Interval time.Duration `yaml:"interval"`
+	Cursor   string        `yaml:"cursor"`
+	Lookback time.Duration `yaml:"lookback"`
+}
+
+// Filters decide which webhooks are handled, the patterns are matched with path.Match.
+type Filters struct {
+	// only these repos ('owner/repo') are handled, every repo when empty
+	IncludeRepos     []string `yaml:"include_repos"`
+	ExcludeRepos     []string `yaml:"exclude_repos"`
+	ExcludeWorkflows []string `yaml:"exclude_workflows"`
+}
+
+// Allows reports whether the runs of the workflow in the repo should be exported.
+func (f Filters) Allows(repo string, workflow string) bool {
+	if len(f.IncludeRepos) > 0 && !matchesAny(f.IncludeRepos, repo) {
+		return false
+	}
+	return !matchesAny(f.ExcludeRepos, repo) && !matchesAny(f.ExcludeWorkflows, workflow)
+}
+
+func matchesAny(patterns []string, value string) bool {
+	for _, pattern := range patterns {
+		// the patterns are checked by Validate
+		if ok, _ := path.Match(pattern, value); ok {
+			return true
+		}
+	}
+	return false
+}
+
+type Enrichment struct {
+	// added to the root span of every run
+	Attributes map[string]string `yaml:"attributes"`
+}
+
+// Sampling decides which completed runs are exported, the runs of the export and render commands
+// and the jobs of live mode are always exported. Runs with one of keep_conclusions or that took
+// longer than keep_duration_over are always kept, the rest are kept at the rate of the first rule
+// they match.
+type Sampling struct {
+	// the chance a run that no rule matches is kept, 1 keeps every run
+	Rate float64 `yaml:"rate"`
+	// 0 doesn't keep runs for their duration
+	KeepDurationOver time.Duration  `yaml:"keep_duration_over"`
+	KeepConclusions  []string       `yaml:"keep_conclusions"`
+	Rules            []SamplingRule `yaml:"rules"`
+}
+
+// Enabled is false when every run is kept.
+func (s Sampling) Enabled() bool {
+	return s.Rate < 1 || len(s.Rules) > 0
+}
+
+// SamplingRule matches a run when it matches a pattern (of path.Match) of every list that is set.
+type SamplingRule struct {
+	// 'owner/repo'
+	Repos     []string `yaml:"repos"`
+	Workflows []string `yaml:"workflows"`
+	Rate      float64  `yaml:"rate"`
+}
+
+type Features struct {
+	// add the custom properties of the repo to the root span of its runs
+	CustomProperties bool `yaml:"custom_properties"`
+	// check the rate limit of the token on startup, which fails fast on a bad token
+	RateLimitCheck bool `yaml:"rate_limit_check"`
+}
+
+// Admin protects the /debug endpoints, which are disabled without a token.
+type Admin struct {
+	// passed as 'Authorization: Bearer <token>'
+	Token string `yaml:"token"`
+}
+
+// NewConfig returns the default configuration.
+func NewConfig() *Config {
+	return &Config{
+		Server: Server{
+			Addr:         ":8080",
+			ReadTimeout:  time.Second,
+			WriteTimeout: 10 * time.Second,
+			LogLevel:     "info",
+			// the file is only watched when there is one
+			ConfigWatchInterval: 10 * time.Second,
+		},
+		GitHub: GitHub{
+			RateLimitReserve: 500,
+		},
+		Recorder: Recorder{
+			Dir:      "webhooks",
+			MaxBytes: 100 << 20,
+			MaxAge:   24 * time.Hour,
+		},
+		Exporter: Exporter{
+			OTLP: OTLP{
+				Protocol:    myOtel.OTLP_PROTOCOL_GRPC,
+				Compression: "none",
+				Insecure:    true,
+			},
+			File: ExporterFile{
+				Split:    myOtel.FILE_SPLIT_RUN,
+				MaxBytes: 100 << 20,
+			},
+			Zipkin: ExporterZipkin{
+				Timeout: myOtel.DEFAULT_ZIPKIN_TIMEOUT,
+			},
+			Resource: ExporterResource{
+				IdleTimeout: myOtel.DEFAULT_RESOURCE_IDLE_TIMEOUT,
+				Detectors: []string{
+					myOtel.RESOURCE_DETECTOR_HOST,
+					myOtel.RESOURCE_DETECTOR_OS,
+					myOtel.RESOURCE_DETECTOR_PROCESS,
+					myOtel.RESOURCE_DETECTOR_CONTAINER,
+				},
+			},
+			Batch: ExporterBatch{
+				QueueSize:     myOtel.DEFAULT_BATCH_QUEUE_SIZE,
+				BatchSize:     myOtel.DEFAULT_BATCH_SIZE,
+				ExportTimeout: myOtel.DEFAULT_BATCH_EXPORT_TIMEOUT,
+				Interval:      myOtel.DEFAULT_BATCH_INTERVAL,
+			},
+			Buffer: ExporterBuffer{
+				MaxBytes:   100 << 20,
+				MaxAge:     24 * time.Hour,
+				MaxBackoff: 5 * time.Minute,
+			},
+		},
+		Handler: Handler{
+			Mode:          "completed",
+			StateTTL:      24 * time.Hour,
+			SweepInterval: 30 * time.Second,
+			SweepGrace:    5 * time.Minute,
+		},
+		Cache: Cache{
+			TTL:             12 * time.Hour,
+			RefreshInterval: time.Hour,
+		},
+		Poll: Poll{
+			Interval: 5 * time.Minute,
+			Cursor:   "poll-cursor.json",
+			Lookback: time.Hour,
+		},
+		Sampling: Sampling{
+			Rate:            1,
+			KeepConclusions: slices.Clone(sampling.DEFAULT_KEEP_CONCLUSIONS),
+		},
+		Features: Features{
+			CustomProperties: true,
+			RateLimitCheck:   true,
+		},
+	}
+}
+
+// Load reads the YAML file over the defaults, then applies the environment variables of every
+// Field. An empty path only applies the environment. The result still needs to be validated.
+func Load(configPath string, lookupEnv func(string) (string, bool)) (*Config, error) {
+	c := NewConfig()
+
+	if configPath != "" {
+		data, err := os.ReadFile(configPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read config file '%s': %w", configPath, err)
+		}
+
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		err = dec.Decode(c)
+		if err != nil && !errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("failed to parse config file '%s': %w", configPath, err)
+		}
+
+		// the destinations only exist in the file, so they don't start out with the defaults
+		for i := range c.Exporter.Destinations {
+			destination := &c.Exporter.Destinations[i]
+			if destination.Protocol == "" {
+				destination.Protocol = myOtel.OTLP_PROTOCOL_GRPC
+			}
+			if destination.Compression == "" {
+				destination.Compression = "none"
+			}
+		}
+	}
+
+	var errs error
+	for _, field := range c.Fields() {
+		value, ok := lookupEnv(field.EnvKey)
+		if !ok || value == "" {
+			continue
+		}
+		err := field.Value.Set(value)
+		if err != nil {
+			errs = errors.Join(errs, fmt.Errorf("invalid %s '%s': %w", field.EnvKey, value, err))
+		}
+	}
+	if errs != nil {
+		return nil, errs
+	}
+
+	return c, nil
+}
+
+// Validate returns every problem with the configuration, named by their YAML path.
+func (c *Config) Validate() error {
+	var errs []error
+	invalid := func(name string, format string, args ...any) {
+		errs = append(errs, fmt.Errorf("%s: %s", name, fmt.Sprintf(format, args...)))
+	}
+	positive := func(name string, d time.Duration) {
+		if d <= 0 {
+			invalid(name, "must be a positive duration, got '%s'", d)
+		}
+	}
+
+	if c.Server.Addr == "" {
+		invalid("server.addr", "must not be empty")
+	}
+	positive("server.read_timeout", c.Server.ReadTimeout)
+	positive("server.write_timeout", c.Server.WriteTimeout)
+	if c.Server.ConfigWatchInterval < 0 {
+		invalid("server.config_watch_interval", "must not be negative, got '%s'", c.Server.ConfigWatchInterval)
+	}
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(c.Server.LogLevel)); err != nil {
+		invalid("server.log_level", "must be one of debug, info, warn or error, got '%s'", c.Server.LogLevel)
+	}
+
+	if c.GitHub.App.Enabled() {
+		if c.GitHub.App.InstallationID == 0 {
+			invalid("github.app.installation_id", "is required when github.app.id is set")
+		}
+		if (c.GitHub.App.PrivateKeyPath == "") == (c.GitHub.App.PrivateKey == "") {
+			invalid("github.app", "exactly one of private_key_path or private_key is required when github.app.id is set")
+		}
+	}
+	if c.GitHub.RateLimitReserve < 0 {
+		invalid("github.rate_limit_reserve", "must not be negative, got %d", c.GitHub.RateLimitReserve)
+	}
+
+	for i, secret := range c.Webhook.Secrets {
+		if secret == "" {
+			invalid(fmt.Sprintf("webhook.secrets[%d]", i), "must not be empty")
+		}
+	}
+
+	if c.Recorder.Enabled {
+		if c.Recorder.Dir == "" {
+			invalid("recorder.dir", "is required when the recorder is enabled")
+		}
+		if c.Recorder.MaxBytes < 0 {
+			invalid("recorder.max_bytes", "must not be negative, got %d", c.Recorder.MaxBytes)
+		}
+		if c.Recorder.MaxAge < 0 {
+			invalid("recorder.max_age", "must not be negative, got '%s'", c.Recorder.MaxAge)
+		}
+		for i, path := range c.Recorder.Redact {
+			if path == "" || strings.Contains(path, "..") || strings.HasPrefix(path, ".") || strings.HasSuffix(path, ".") {
+				invalid(fmt.Sprintf("recorder.redact[%d]", i), "must be a dotted path like 'sender.email', got '%s'", path)
+			}
+		}
+	}
+
+	// name is the YAML path of the settings, like 'exporter'
+	checkOTLP := func(name string, o OTLP) {
+		if o.Protocol != myOtel.OTLP_PROTOCOL_GRPC && o.Protocol != myOtel.OTLP_PROTOCOL_HTTP {
+			invalid(name+".protocol", "must be one of %s or %s, got '%s'", myOtel.OTLP_PROTOCOL_GRPC, myOtel.OTLP_PROTOCOL_HTTP, o.Protocol)
+		}
+		if (o.ClientCertificate == "") != (o.ClientKey == "") {
+			invalid(name+".client_certificate", "must be set together with %s.client_key", name)
+		}
+		if o.Compression != "gzip" && o.Compression != "none" {
+			invalid(name+".compression", "must be one of gzip or none, got '%s'", o.Compression)
+		}
+		if o.Timeout < 0 {
+			invalid(name+".timeout", "must not be negative, got '%s'", o.Timeout)
+		}
+		for key := range o.Headers {
+			if key == "" {
+				invalid(name+".headers", "keys must not be empty")
+			}
+		}
+	}
+	checkOTLP("exporter", c.Exporter.OTLP)
+	if c.Exporter.Batch.QueueSize <= 0 {
+		invalid("exporter.batch.queue_size", "must be positive, got %d", c.Exporter.Batch.QueueSize)
+	}
+	if c.Exporter.Batch.BatchSize <= 0 || c.Exporter.Batch.BatchSize > c.Exporter.Batch.QueueSize {
+		invalid("exporter.batch.batch_size", "must be positive and at most the queue size of %d, got %d", c.Exporter.Batch.QueueSize, c.Exporter.Batch.BatchSize)
+	}
+	positive("exporter.batch.export_timeout", c.Exporter.Batch.ExportTimeout)
+	positive("exporter.batch.interval", c.Exporter.Batch.Interval)
+	if c.Exporter.Buffer.Dir != "" {
+		if c.Exporter.Buffer.MaxBytes < 0 {
+			invalid("exporter.buffer.max_bytes", "must not be negative, got %d", c.Exporter.Buffer.MaxBytes)
+		}
+		if c.Exporter.Buffer.MaxAge < 0 {
+			invalid("exporter.buffer.max_age", "must not be negative, got '%s'", c.Exporter.Buffer.MaxAge)
+		}
+		positive("exporter.buffer.max_backoff", c.Exporter.Buffer.MaxBackoff)
+	}
+
+	if c.Exporter.File.Dir != "" {
+		if c.Exporter.File.Split != myOtel.FILE_SPLIT_RUN && c.Exporter.File.Split != myOtel.FILE_SPLIT_SIZE {
+			invalid("exporter.file.split", "must be one of run or size, got '%s'", c.Exporter.File.Split)
+		}
+		if c.Exporter.File.MaxBytes < 0 {
+			invalid("exporter.file.max_bytes", "must not be negative, got %d", c.Exporter.File.MaxBytes)
+		}
+	}
+
+	if c.Exporter.Zipkin.Endpoint != "" {
+		if u, err := url.Parse(c.Exporter.Zipkin.Endpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			invalid("exporter.zipkin.endpoint", "must be an http or https url, got '%s'", c.Exporter.Zipkin.Endpoint)
+		}
+		positive("exporter.zipkin.timeout", c.Exporter.Zipkin.Timeout)
+	}
+
+	checkTemplate := func(name string, template string) {
+		err := myOtel.CheckResourceTemplate(template)
+		if err != nil {
+			invalid(name, "%s", err)
+		} else if strings.Contains(template, "custom_properties.") && !c.Features.CustomProperties {
+			invalid(name, "uses custom properties, which are only fetched with features.custom_properties")
+		}
+	}
+	checkTemplate("exporter.resource.service_name", c.Exporter.Resource.ServiceName)
+	for _, key := range slices.Sorted(maps.Keys(c.Exporter.Resource.Attributes)) {
+		checkTemplate("exporter.resource.attributes."+key, c.Exporter.Resource.Attributes[key])
+	}
+	positive("exporter.resource.idle_timeout", c.Exporter.Resource.IdleTimeout)
+	for i, detector := range c.Exporter.Resource.Detectors {
+		if err := myOtel.CheckResourceDetector(detector); err != nil {
+			invalid(fmt.Sprintf("exporter.resource.detectors[%d]", i), "%s", err)
+		}
+	}
+
+	switch c.Handler.Mode {
+	case "completed", "live", "job_events":
+	default:
+		invalid("handler.mode", "must be one of completed, live or job_events, got '%s'", c.Handler.Mode)
+	}
+	positive("handler.state_ttl", c.Handler.StateTTL)
+	positive("handler.sweep_interval", c.Handler.SweepInterval)
+	positive("handler.sweep_grace", c.Handler.SweepGrace)
+
+	positive("cache.ttl", c.Cache.TTL)
+	positive("cache.refresh_interval", c.Cache.RefreshInterval)
+
+	for i, repo := range c.Poll.Repos {
+		if !isRepo(repo) {
+			invalid(fmt.Sprintf("poll.repos[%d]", i), "must be formatted as 'owner/repo', got '%s'", repo)
+		}
+	}
+	if len(c.Poll.Repos) > 0 {
+		positive("poll.interval", c.Poll.Interval)
+		if c.Poll.Lookback < 0 {
+			invalid("poll.lookback", "must not be negative, got '%s'", c.Poll.Lookback)
+		}
+	}
+
+	checkPatterns := func(name string, patterns []string) {
+		for i, pattern := range patterns {
+			if _, err := path.Match(pattern, ""); err != nil {
+				invalid(fmt.Sprintf("%s[%d]", name, i), "invalid pattern '%s': %s", pattern, err)
+			}
+		}
+	}
+	checkPatterns("filters.include_repos", c.Filters.IncludeRepos)
+	checkPatterns("filters.exclude_repos", c.Filters.ExcludeRepos)
+	checkPatterns("filters.exclude_workflows", c.Filters.ExcludeWorkflows)
+
+	destinations := map[string]bool{myOtel.DEFAULT_DESTINATION: true}
+	for i, destination := range c.Exporter.Destinations {
+		name := fmt.Sprintf("exporter.destinations[%d]", i)
+		if destination.Name == "" || destinations[destination.Name] {
+			invalid(name+".name", "must be set and unique, and not '%s', got '%s'", myOtel.DEFAULT_DESTINATION, destination.Name)
+		}
+		destinations[destination.Name] = true
+		if destination.OTLPEndpoint == "" {
+			invalid(name+".otlp_endpoint", "is required")
+		}
+		checkOTLP(name, destination.OTLP)
+	}
+	for i, route := range c.Exporter.Routes {
+		name := fmt.Sprintf("exporter.routes[%d]", i)
+		if len(route.Orgs) == 0 && len(route.Repos) == 0 && len(route.Workflows) == 0 {
+			invalid(name, "must match on orgs, repos or workflows")
+		}
+		checkPatterns(name+".orgs", route.Orgs)
+		checkPatterns(name+".repos", route.Repos)
+		checkPatterns(name+".workflows", route.Workflows)
+		if len(route.Destinations) == 0 {
+			invalid(name+".destinations", "is required")
+		}
+		for j, destination := range route.Destinations {
+			if !destinations[destination] {
+				invalid(fmt.Sprintf("%s.destinations[%d]", name, j), "unknown destination '%s'", destination)
+			}
+		}
+	}
+
+	for key := range c.Enrichment.Attributes {
+		if key == "" {
+			invalid("enrichment.attributes", "keys must not be empty")
+		}
+	}
+
+	checkRate := func(name string, rate float64) {
+		if rate < 0 || rate > 1 {
+			invalid(name, "must be between 0 and 1, got %g", rate)
+		}
+	}
+	checkRate("sampling.rate", c.Sampling.Rate)
+	if c.Sampling.KeepDurationOver < 0 {
+		invalid("sampling.keep_duration_over", "must not be negative, got '%s'", c.Sampling.KeepDurationOver)
+	}
+	for i, rule := range c.Sampling.Rules {
+		name := fmt.Sprintf("sampling.rules[%d]", i)
+		if len(rule.Repos) == 0 && len(rule.Workflows) == 0 {
+			invalid(name, "must match on repos or workflows")
+		}
+		checkPatterns(name+".repos", rule.Repos)
+		checkPatterns(name+".workflows", rule.Workflows)
+		checkRate(name+".rate", rule.Rate)
+	}
+
+	return errors.Join(errs...)
 }
 
-func NewConfig() {
+func isRepo(repo string) bool {
+	owner, name, ok := strings.Cut(repo, "/")
+	return ok && owner != "" && name != "" && !strings.Contains(name, "/")
 }
@@ -0,0 +1,256 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoad(t *testing.T) {
+	// Arrange
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	err := os.WriteFile(configPath, []byte(`
+server:
+  addr: ":9090"
+handler:
+  mode: job_events
+cache:
+  ttl: 6h
+poll:
+  repos: [octo/one, octo/two]
+enrichment:
+  attributes:
+    team: platform
+`), 0o644)
+	assert.NoError(t, err)
+	env := map[string]string{
+		"TRACE_EXPORT_ADDR":       ":7070",
+		"TRACE_EXPORT_POLL_REPOS": "octo/three",
+	}
+
+	// Act
+	cfg, err := Load(configPath, func(key string) (string, bool) {
+		value, ok := env[key]
+		return value, ok
+	})
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, ":7070", cfg.Server.Addr, "the environment should override the file")
+	assert.Equal(t, "job_events", cfg.Handler.Mode)
+	assert.Equal(t, 6*time.Hour, cfg.Cache.TTL)
+	assert.Equal(t, time.Hour, cfg.Cache.RefreshInterval, "settings missing from the file should keep their default")
+	assert.Equal(t, []string{"octo/three"}, cfg.Poll.Repos, "a list in the environment should replace the list in the file")
+	assert.Equal(t, map[string]string{"team": "platform"}, cfg.Enrichment.Attributes)
+	assert.NoError(t, cfg.Validate())
+}
+
+func TestLoadOTLPEnvironment(t *testing.T) {
+	// Arrange
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	err := os.WriteFile(configPath, []byte(`
+exporter:
+  headers:
+    x-from-file: "1"
+`), 0o644)
+	assert.NoError(t, err)
+	env := map[string]string{
+		"OTEL_EXPORTER_OTLP_PROTOCOL":    "http/protobuf",
+		"OTEL_EXPORTER_OTLP_HEADERS":     "x-honeycomb-team=abc%3D%3D, x-honeycomb-dataset=ci",
+		"OTEL_EXPORTER_OTLP_TIMEOUT":     "2500",
+		"OTEL_EXPORTER_OTLP_COMPRESSION": "gzip",
+	}
+
+	// Act
+	cfg, err := Load(configPath, func(key string) (string, bool) {
+		value, ok := env[key]
+		return value, ok
+	})
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, "http/protobuf", cfg.Exporter.Protocol)
+	assert.Equal(t, map[string]string{"x-honeycomb-team": "abc==", "x-honeycomb-dataset": "ci"}, cfg.Exporter.Headers, "the headers in the environment should replace the ones in the file")
+	assert.Equal(t, 2500*time.Millisecond, cfg.Exporter.Timeout, "the timeout should be in milliseconds")
+	assert.Equal(t, "gzip", cfg.Exporter.Compression)
+	assert.NoError(t, cfg.Validate())
+}
+
+func TestLoadDestinations(t *testing.T) {
+	// Arrange
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	err := os.WriteFile(configPath, []byte(`
+exporter:
+  otlp_endpoint: localhost:4317
+  destinations:
+    - name: tempo
+      otlp_endpoint: https://tempo.internal:4318
+      protocol: http/protobuf
+      headers:
+        x-scope-orgid: ci
+  routes:
+    - orgs: [platform]
+      destinations: [tempo]
+`), 0o644)
+	assert.NoError(t, err)
+
+	// Act
+	cfg, err := Load(configPath, func(string) (string, bool) { return "", false })
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, "localhost:4317", cfg.Exporter.OTLPEndpoint)
+	assert.Equal(t, []ExporterDestination{{
+		Name: "tempo",
+		OTLP: OTLP{
+			OTLPEndpoint: "https://tempo.internal:4318",
+			Protocol:     "http/protobuf",
+			Headers:      map[string]string{"x-scope-orgid": "ci"},
+			Compression:  "none",
+		},
+	}}, cfg.Exporter.Destinations, "the destinations should get the defaults that aren't set")
+	assert.Equal(t, []ExporterRoute{{Orgs: []string{"platform"}, Destinations: []string{"tempo"}}}, cfg.Exporter.Routes)
+	assert.NoError(t, cfg.Validate())
+}
+
+func TestLoadRejectsUnknownFields(t *testing.T) {
+	// Arrange
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	err := os.WriteFile(configPath, []byte("server:\n  adress: \":9090\"\n"), 0o644)
+	assert.NoError(t, err)
+
+	// Act
+	_, err = Load(configPath, func(string) (string, bool) { return "", false })
+
+	// Assert
+	assert.ErrorContains(t, err, "adress")
+}
+
+func TestValidate(t *testing.T) {
+	tests := map[string]struct {
+		givenChange   func(c *Config)
+		expectedError string
+	}{
+		"defaults are valid": {
+			givenChange: func(c *Config) {},
+		},
+		"unknown mode": {
+			givenChange:   func(c *Config) { c.Handler.Mode = "eventually" },
+			expectedError: "handler.mode: must be one of completed, live or job_events, got 'eventually'",
+		},
+		"app without a key": {
+			givenChange: func(c *Config) {
+				c.GitHub.App.ID = 1
+				c.GitHub.App.InstallationID = 2
+			},
+			expectedError: "github.app: exactly one of private_key_path or private_key is required when github.app.id is set",
+		},
+		"poll repo without an owner": {
+			givenChange:   func(c *Config) { c.Poll.Repos = []string{"repo"} },
+			expectedError: "poll.repos[0]: must be formatted as 'owner/repo', got 'repo'",
+		},
+		"bad filter pattern": {
+			givenChange:   func(c *Config) { c.Filters.ExcludeRepos = []string{"octo/[a"} },
+			expectedError: "filters.exclude_repos[0]: invalid pattern 'octo/[a': syntax error in pattern",
+		},
+		"unknown trace file split": {
+			givenChange: func(c *Config) {
+				c.Exporter.File.Dir = "traces"
+				c.Exporter.File.Split = "day"
+			},
+			expectedError: "exporter.file.split: must be one of run or size, got 'day'",
+		},
+		"zipkin endpoint without a scheme": {
+			givenChange:   func(c *Config) { c.Exporter.Zipkin.Endpoint = "zipkin:9411" },
+			expectedError: "exporter.zipkin.endpoint: must be an http or https url, got 'zipkin:9411'",
+		},
+		"unknown resource template variable": {
+			givenChange:   func(c *Config) { c.Exporter.Resource.ServiceName = "${repository}" },
+			expectedError: "exporter.resource.service_name: unknown variable 'repository', expected repo, owner, repo_name, workflow or custom_properties.<name>",
+		},
+		"resource template of a custom property without them": {
+			givenChange: func(c *Config) {
+				c.Features.CustomProperties = false
+				c.Exporter.Resource.Attributes = map[string]string{"team": "${custom_properties.team}"}
+			},
+			expectedError: "exporter.resource.attributes.team: uses custom properties, which are only fetched with features.custom_properties",
+		},
+		"unknown resource detector": {
+			givenChange:   func(c *Config) { c.Exporter.Resource.Detectors = []string{"host", "kubernetes"} },
+			expectedError: "exporter.resource.detectors[1]: unknown resource detector 'kubernetes', expected host, os, process or container",
+		},
+		"sampling rate over 1": {
+			givenChange:   func(c *Config) { c.Sampling.Rate = 10 },
+			expectedError: "sampling.rate: must be between 0 and 1, got 10",
+		},
+		"sampling rule without a selector": {
+			givenChange:   func(c *Config) { c.Sampling.Rules = []SamplingRule{{Rate: 0.1}} },
+			expectedError: "sampling.rules[0]: must match on repos or workflows",
+		},
+		"unknown OTLP protocol": {
+			givenChange:   func(c *Config) { c.Exporter.Protocol = "http/json" },
+			expectedError: "exporter.protocol: must be one of grpc or http/protobuf, got 'http/json'",
+		},
+		"batch larger than the queue": {
+			givenChange: func(c *Config) {
+				c.Exporter.Batch.QueueSize = 100
+				c.Exporter.Batch.BatchSize = 200
+			},
+			expectedError: "exporter.batch.batch_size: must be positive and at most the queue size of 100, got 200",
+		},
+		"route to an unknown destination": {
+			givenChange: func(c *Config) {
+				c.Exporter.Routes = []ExporterRoute{{Repos: []string{"octo/*"}, Destinations: []string{"honeycomb"}}}
+			},
+			expectedError: "exporter.routes[0].destinations[0]: unknown destination 'honeycomb'",
+		},
+		"destination named default": {
+			givenChange: func(c *Config) {
+				c.Exporter.Destinations = []ExporterDestination{{Name: "default", OTLP: OTLP{OTLPEndpoint: "tempo:4317", Protocol: "grpc", Compression: "none"}}}
+			},
+			expectedError: "exporter.destinations[0].name: must be set and unique, and not 'default', got 'default'",
+		},
+		"negative duration": {
+			givenChange:   func(c *Config) { c.Cache.TTL = -time.Hour },
+			expectedError: "cache.ttl: must be a positive duration, got '-1h0m0s'",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			// Arrange
+			cfg := NewConfig()
+			test.givenChange(cfg)
+
+			// Act
+			err := cfg.Validate()
+
+			// Assert
+			if test.expectedError == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, test.expectedError)
+			}
+		})
+	}
+}
+
+func TestFiltersAllows(t *testing.T) {
+	// Arrange
+	filters := Filters{
+		IncludeRepos:     []string{"octo/*"},
+		ExcludeRepos:     []string{"octo/secret-*"},
+		ExcludeWorkflows: []string{"Dependabot*"},
+	}
+
+	// Act & Assert
+	assert.True(t, filters.Allows("octo/app", "ci"))
+	assert.False(t, filters.Allows("other/app", "ci"), "repos that aren't included should be skipped")
+	assert.False(t, filters.Allows("octo/secret-app", "ci"))
+	assert.False(t, filters.Allows("octo/app", "Dependabot Updates"))
+}
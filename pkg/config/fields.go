@@ -0,0 +1,288 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const OTEL_EXPORTER_OTLP_ENDPOINT_KEY string = "OTEL_EXPORTER_OTLP_ENDPOINT"
+const OTEL_EXPORTER_OTLP_PROTOCOL_KEY string = "OTEL_EXPORTER_OTLP_PROTOCOL"
+const OTEL_EXPORTER_OTLP_HEADERS_KEY string = "OTEL_EXPORTER_OTLP_HEADERS"
+const OTEL_EXPORTER_OTLP_TIMEOUT_KEY string = "OTEL_EXPORTER_OTLP_TIMEOUT"
+const OTEL_EXPORTER_OTLP_CERTIFICATE_KEY string = "OTEL_EXPORTER_OTLP_CERTIFICATE"
+const OTEL_EXPORTER_OTLP_CLIENT_CERTIFICATE_KEY string = "OTEL_EXPORTER_OTLP_CLIENT_CERTIFICATE"
+const OTEL_EXPORTER_OTLP_CLIENT_KEY_KEY string = "OTEL_EXPORTER_OTLP_CLIENT_KEY"
+const OTEL_EXPORTER_OTLP_COMPRESSION_KEY string = "OTEL_EXPORTER_OTLP_COMPRESSION"
+const OTEL_EXPORTER_OTLP_INSECURE_KEY string = "OTEL_EXPORTER_OTLP_INSECURE"
+const OTEL_EXPORTER_ZIPKIN_ENDPOINT_KEY string = "OTEL_EXPORTER_ZIPKIN_ENDPOINT"
+const OTEL_EXPORTER_ZIPKIN_TIMEOUT_KEY string = "OTEL_EXPORTER_ZIPKIN_TIMEOUT"
+const OTEL_BSP_MAX_QUEUE_SIZE_KEY string = "OTEL_BSP_MAX_QUEUE_SIZE"
+const OTEL_BSP_MAX_EXPORT_BATCH_SIZE_KEY string = "OTEL_BSP_MAX_EXPORT_BATCH_SIZE"
+const OTEL_BSP_EXPORT_TIMEOUT_KEY string = "OTEL_BSP_EXPORT_TIMEOUT"
+const OTEL_BSP_SCHEDULE_DELAY_KEY string = "OTEL_BSP_SCHEDULE_DELAY"
+const GITHUB_TOKEN_KEY string = "GITHUB_TOKEN"
+const GITHUB_API_URL_KEY string = "GITHUB_API_URL"
+const TRACE_EXPORT_CONFIG_KEY string = "TRACE_EXPORT_CONFIG"
+
+// Field is a setting that can be overridden by an environment variable and a flag. The value sets
+// the field of the Config it was returned from.
+type Field struct {
+	// the flag of the setting, without the leading dash
+	Flag   string
+	EnvKey string
+	Usage  string
+	Value  flag.Value
+	// fields that are used by every command, the rest only apply to the server
+	Common bool
+}
+
+// Fields returns the settings of c that can be overridden, maps (like the enrichment attributes)
+// can only be set in the file, except for the exporter headers.
+func (c *Config) Fields() []Field {
+	return []Field{
+		{"otlp-endpoint", OTEL_EXPORTER_OTLP_ENDPOINT_KEY, "OTLP endpoint the traces are exported to, as 'host:port' or a url", (*stringValue)(&c.Exporter.OTLPEndpoint), true},
+		{"otlp-protocol", OTEL_EXPORTER_OTLP_PROTOCOL_KEY, "one of grpc or http/protobuf", (*stringValue)(&c.Exporter.Protocol), true},
+		{"otlp-header", OTEL_EXPORTER_OTLP_HEADERS_KEY, "header sent with every export as 'key=value', can be passed more than once or comma separated", newHeadersValue(&c.Exporter.Headers), true},
+		{"otlp-timeout", OTEL_EXPORTER_OTLP_TIMEOUT_KEY, "how long an export may take, in milliseconds or as a duration", (*millisecondsValue)(&c.Exporter.Timeout), true},
+		{"otlp-certificate", OTEL_EXPORTER_OTLP_CERTIFICATE_KEY, "PEM file of the CAs that verify the collector", (*stringValue)(&c.Exporter.Certificate), true},
+		{"otlp-client-certificate", OTEL_EXPORTER_OTLP_CLIENT_CERTIFICATE_KEY, "PEM file of the client certificate for mTLS, read again when it changes", (*stringValue)(&c.Exporter.ClientCertificate), true},
+		{"otlp-client-key", OTEL_EXPORTER_OTLP_CLIENT_KEY_KEY, "PEM file of the key of the client certificate", (*stringValue)(&c.Exporter.ClientKey), true},
+		{"otlp-server-name", "TRACE_EXPORT_OTLP_SERVER_NAME", "name the certificate of the collector is verified against, instead of its host", (*stringValue)(&c.Exporter.ServerName), true},
+		{"otlp-compression", OTEL_EXPORTER_OTLP_COMPRESSION_KEY, "one of gzip or none", (*stringValue)(&c.Exporter.Compression), true},
+		{"otlp-insecure", OTEL_EXPORTER_OTLP_INSECURE_KEY, "don't use TLS for an endpoint without a scheme", (*boolValue)(&c.Exporter.Insecure), true},
+		{"batch-queue-size", OTEL_BSP_MAX_QUEUE_SIZE_KEY, "spans that end while this many are waiting to be exported are dropped", (*intValue)(&c.Exporter.Batch.QueueSize), true},
+		{"batch-size", OTEL_BSP_MAX_EXPORT_BATCH_SIZE_KEY, "the most spans that are exported at once", (*intValue)(&c.Exporter.Batch.BatchSize), true},
+		{"batch-export-timeout", OTEL_BSP_EXPORT_TIMEOUT_KEY, "how long an export of a batch may take, in milliseconds or as a duration", (*millisecondsValue)(&c.Exporter.Batch.ExportTimeout), true},
+		{"batch-interval", OTEL_BSP_SCHEDULE_DELAY_KEY, "how long spans wait before they are exported, in milliseconds or as a duration. The trace of a run is exported when it ends", (*millisecondsValue)(&c.Exporter.Batch.Interval), true},
+		{"buffer-dir", "TRACE_EXPORT_BUFFER_DIR", "keep the batches the collector didn't accept in the directory, and export them again later", (*stringValue)(&c.Exporter.Buffer.Dir), true},
+		{"buffer-max-bytes", "TRACE_EXPORT_BUFFER_MAX_BYTES", "drop the oldest batches when the buffer of a destination grows larger, 0 doesn't limit it", (*int64Value)(&c.Exporter.Buffer.MaxBytes), true},
+		{"buffer-max-age", "TRACE_EXPORT_BUFFER_MAX_AGE", "drop the batches that are older, 0 keeps them", (*durationValue)(&c.Exporter.Buffer.MaxAge), true},
+		{"buffer-max-backoff", "TRACE_EXPORT_BUFFER_MAX_BACKOFF", "the longest wait between retries of the buffer", (*durationValue)(&c.Exporter.Buffer.MaxBackoff), true},
+		{"trace-file-dir", "TRACE_EXPORT_TRACE_FILE_DIR", "write the traces to OTLP/JSON files in the directory, instead of exporting them", (*stringValue)(&c.Exporter.File.Dir), true},
+		{"trace-file-split", "TRACE_EXPORT_TRACE_FILE_SPLIT", "one of run, for a file per workflow run attempt, or size", (*stringValue)(&c.Exporter.File.Split), true},
+		{"trace-file-max-bytes", "TRACE_EXPORT_TRACE_FILE_MAX_BYTES", "start a new trace file after this many bytes when they are split by size, 0 doesn't rotate", (*int64Value)(&c.Exporter.File.MaxBytes), true},
+		{"zipkin-endpoint", OTEL_EXPORTER_ZIPKIN_ENDPOINT_KEY, "post the traces as Zipkin v2 JSON to the url, instead of exporting them over OTLP", (*stringValue)(&c.Exporter.Zipkin.Endpoint), true},
+		{"zipkin-timeout", OTEL_EXPORTER_ZIPKIN_TIMEOUT_KEY, "how long a post to Zipkin may take, in milliseconds or as a duration", (*millisecondsValue)(&c.Exporter.Zipkin.Timeout), true},
+		{"resource-service-name", "TRACE_EXPORT_RESOURCE_SERVICE_NAME", "service.name of the traces of runs, like '${repo_name}' or '${custom_properties.team}'", (*stringValue)(&c.Exporter.Resource.ServiceName), true},
+		{"resource-idle-timeout", "TRACE_EXPORT_RESOURCE_IDLE_TIMEOUT", "the tracer provider of a resource of runs is dropped once it wasn't used for this long", (*durationValue)(&c.Exporter.Resource.IdleTimeout), true},
+		{"resource-detector", "TRACE_EXPORT_RESOURCE_DETECTORS", "one of host, os, process or container, which describe where the service runs in the resources, can be passed more than once or comma separated", newListValue(&c.Exporter.Resource.Detectors), true},
+		{"sampling-rate", "TRACE_EXPORT_SAMPLING_RATE", "the chance a completed run that isn't always kept and that no sampling rule matches is exported, 1 exports every run", (*float64Value)(&c.Sampling.Rate), true},
+		{"sampling-keep-duration-over", "TRACE_EXPORT_SAMPLING_KEEP_DURATION_OVER", "always export the runs that took longer, 0 doesn't keep runs for their duration", (*durationValue)(&c.Sampling.KeepDurationOver), true},
+		{"sampling-keep-conclusion", "TRACE_EXPORT_SAMPLING_KEEP_CONCLUSIONS", "always export the runs with the conclusion, can be passed more than once or comma separated", newListValue(&c.Sampling.KeepConclusions), true},
+		{"log-level", "TRACE_EXPORT_LOG_LEVEL", "one of debug, info, warn or error", (*stringValue)(&c.Server.LogLevel), true},
+		{"github-token", GITHUB_TOKEN_KEY, "token used to call the GitHub api", (*stringValue)(&c.GitHub.Token), true},
+		{"github-api-url", GITHUB_API_URL_KEY, "api url of GitHub Enterprise Server", (*stringValue)(&c.GitHub.APIURL), true},
+		{"github-app-id", "TRACE_EXPORT_GITHUB_APP_ID", "id of the GitHub App used to call the api, instead of the token", (*int64Value)(&c.GitHub.App.ID), true},
+		{"github-app-installation-id", "TRACE_EXPORT_GITHUB_APP_INSTALLATION_ID", "installation id of the GitHub App", (*int64Value)(&c.GitHub.App.InstallationID), true},
+		{"github-app-private-key-path", "TRACE_EXPORT_GITHUB_APP_PRIVATE_KEY_PATH", "file with the PEM encoded private key of the GitHub App", (*stringValue)(&c.GitHub.App.PrivateKeyPath), true},
+		{"github-app-private-key", "TRACE_EXPORT_GITHUB_APP_PRIVATE_KEY", "PEM encoded private key of the GitHub App", (*stringValue)(&c.GitHub.App.PrivateKey), true},
+		{"rate-limit-reserve", "TRACE_EXPORT_RATE_LIMIT_RESERVE", "stop making requests when this many are left in the rate limit, until it resets", (*intValue)(&c.GitHub.RateLimitReserve), true},
+
+		{"addr", "TRACE_EXPORT_ADDR", "address the server listens on", (*stringValue)(&c.Server.Addr), false},
+		{"read-timeout", "TRACE_EXPORT_READ_TIMEOUT", "maximum duration for reading a request", (*durationValue)(&c.Server.ReadTimeout), false},
+		{"write-timeout", "TRACE_EXPORT_WRITE_TIMEOUT", "maximum duration for writing a response", (*durationValue)(&c.Server.WriteTimeout), false},
+		{"config-watch-interval", "TRACE_EXPORT_CONFIG_WATCH_INTERVAL", "how often the config file is checked for changes, 0 only reloads on SIGHUP", (*durationValue)(&c.Server.ConfigWatchInterval), false},
+		{"webhook-secret", "TRACE_EXPORT_WEBHOOK_SECRETS", "secret the webhook payloads are signed with, can be passed more than once or comma separated", newListValue(&c.Webhook.Secrets), false},
+		{"record", "TRACE_EXPORT_RECORD", "write the received webhooks to gzip compressed JSONL files for the replay command", (*boolValue)(&c.Recorder.Enabled), false},
+		{"record-dir", "TRACE_EXPORT_RECORD_DIR", "directory the recorded webhooks are written to", (*stringValue)(&c.Recorder.Dir), false},
+		{"record-max-bytes", "TRACE_EXPORT_RECORD_MAX_BYTES", "start a new file after this many bytes of uncompressed records, 0 doesn't rotate on size", (*int64Value)(&c.Recorder.MaxBytes), false},
+		{"record-max-age", "TRACE_EXPORT_RECORD_MAX_AGE", "start a new file once the current one is this old, 0 doesn't rotate on age", (*durationValue)(&c.Recorder.MaxAge), false},
+		{"record-header", "TRACE_EXPORT_RECORD_HEADERS", "header that is recorded, can be passed more than once or comma separated", newListValue(&c.Recorder.Headers), false},
+		{"record-redact", "TRACE_EXPORT_RECORD_REDACT", "dotted path of a payload field that is redacted, can be passed more than once or comma separated", newListValue(&c.Recorder.Redact), false},
+		{"mode", "TRACE_EXPORT_MODE", "when traces are exported, one of completed, live or job_events", (*stringValue)(&c.Handler.Mode), false},
+		{"state-ttl", "TRACE_EXPORT_STATE_TTL", "runs that never complete are dropped after this long", (*durationValue)(&c.Handler.StateTTL), false},
+		{"sweep-interval", "TRACE_EXPORT_SWEEP_INTERVAL", "how often completed runs are assembled, in job_events mode", (*durationValue)(&c.Handler.SweepInterval), false},
+		{"sweep-grace", "TRACE_EXPORT_SWEEP_GRACE", "runs are assembled this long after they completed, to wait for late workflow_job events", (*durationValue)(&c.Handler.SweepGrace), false},
+		{"cache-ttl", "TRACE_EXPORT_CACHE_TTL", "custom properties of a repo are refreshed once they are older than this", (*durationValue)(&c.Cache.TTL), false},
+		{"cache-refresh-interval", "TRACE_EXPORT_CACHE_REFRESH_INTERVAL", "how often the custom properties cache is checked for expired repos", (*durationValue)(&c.Cache.RefreshInterval), false},
+		{"poll-repo", "TRACE_EXPORT_POLL_REPOS", "repo to poll for completed runs as 'owner/repo', can be passed more than once or comma separated", newListValue(&c.Poll.Repos), false},
+		{"poll-interval", "TRACE_EXPORT_POLL_INTERVAL", "how often the polled repos are checked", (*durationValue)(&c.Poll.Interval), false},
+		{"poll-cursor", "TRACE_EXPORT_POLL_CURSOR", "file the exported runs of the polled repos are recorded in", (*stringValue)(&c.Poll.Cursor), false},
+		{"poll-lookback", "TRACE_EXPORT_POLL_LOOKBACK", "runs updated this long before the poll cursor are still checked, and runs created this long before it are still listed, set it to more than the longest runs", (*durationValue)(&c.Poll.Lookback), false},
+		{"include-repo", "TRACE_EXPORT_INCLUDE_REPOS", "only handle webhooks of repos matching the pattern, can be passed more than once or comma separated", newListValue(&c.Filters.IncludeRepos), false},
+		{"exclude-repo", "TRACE_EXPORT_EXCLUDE_REPOS", "skip webhooks of repos matching the pattern, can be passed more than once or comma separated", newListValue(&c.Filters.ExcludeRepos), false},
+		{"exclude-workflow", "TRACE_EXPORT_EXCLUDE_WORKFLOWS", "skip webhooks of workflows matching the pattern, can be passed more than once or comma separated", newListValue(&c.Filters.ExcludeWorkflows), false},
+		{"custom-properties", "TRACE_EXPORT_CUSTOM_PROPERTIES", "add the custom properties of the repo to the root span of its runs", (*boolValue)(&c.Features.CustomProperties), false},
+		{"admin-token", "TRACE_EXPORT_ADMIN_TOKEN", "bearer token of the /debug endpoints, which are disabled without one", (*stringValue)(&c.Admin.Token), false},
+		{"rate-limit-check", "TRACE_EXPORT_RATE_LIMIT_CHECK", "check the rate limit of the token on startup", (*boolValue)(&c.Features.RateLimitCheck), false},
+	}
+}
+
+type stringValue string
+
+func (v *stringValue) Set(value string) error {
+	*v = stringValue(value)
+	return nil
+}
+
+func (v *stringValue) String() string { return string(*v) }
+
+type intValue int
+
+func (v *intValue) Set(value string) error {
+	i, err := strconv.Atoi(value)
+	if err != nil {
+		return err
+	}
+	*v = intValue(i)
+	return nil
+}
+
+func (v *intValue) String() string { return strconv.Itoa(int(*v)) }
+
+type int64Value int64
+
+func (v *int64Value) Set(value string) error {
+	i, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return err
+	}
+	*v = int64Value(i)
+	return nil
+}
+
+func (v *int64Value) String() string { return strconv.FormatInt(int64(*v), 10) }
+
+type float64Value float64
+
+func (v *float64Value) Set(value string) error {
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return err
+	}
+	*v = float64Value(f)
+	return nil
+}
+
+func (v *float64Value) String() string { return strconv.FormatFloat(float64(*v), 'g', -1, 64) }
+
+type boolValue bool
+
+func (v *boolValue) Set(value string) error {
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return err
+	}
+	*v = boolValue(b)
+	return nil
+}
+
+func (v *boolValue) String() string { return strconv.FormatBool(bool(*v)) }
+
+// IsBoolFlag lets the flag be passed without a value.
+func (v *boolValue) IsBoolFlag() bool { return true }
+
+type durationValue time.Duration
+
+func (v *durationValue) Set(value string) error {
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return err
+	}
+	*v = durationValue(d)
+	return nil
+}
+
+func (v *durationValue) String() string { return time.Duration(*v).String() }
+
+// millisecondsValue is a duration that is an integer number of milliseconds, like the timeouts of
+// the OTEL_* variables, or a duration string.
+type millisecondsValue time.Duration
+
+func (v *millisecondsValue) Set(value string) error {
+	if ms, err := strconv.ParseInt(value, 10, 64); err == nil {
+		*v = millisecondsValue(time.Duration(ms) * time.Millisecond)
+		return nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return errors.New("expected milliseconds or a duration")
+	}
+	*v = millisecondsValue(d)
+	return nil
+}
+
+func (v *millisecondsValue) String() string { return time.Duration(*v).String() }
+
+// listValue replaces the list on the first Set, and appends comma separated values after that. A
+// flag passed more than once adds to the list instead of the list from the file or environment.
+type listValue struct {
+	values *[]string
+	set    bool
+}
+
+func newListValue(values *[]string) *listValue {
+	return &listValue{values: values}
+}
+
+func (v *listValue) Set(value string) error {
+	if !v.set {
+		*v.values = nil
+		v.set = true
+	}
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			*v.values = append(*v.values, item)
+		}
+	}
+	return nil
+}
+
+func (v *listValue) String() string {
+	if v.values == nil {
+		return ""
+	}
+	return strings.Join(*v.values, ",")
+}
+
+// headersValue is a map in the format of OTEL_EXPORTER_OTLP_HEADERS, comma separated 'key=value'
+// pairs with url encoded values. Like listValue, the first Set replaces the map.
+type headersValue struct {
+	headers *map[string]string
+	set     bool
+}
+
+func newHeadersValue(headers *map[string]string) *headersValue {
+	return &headersValue{headers: headers}
+}
+
+func (v *headersValue) Set(value string) error {
+	if !v.set || *v.headers == nil {
+		*v.headers = make(map[string]string)
+		v.set = true
+	}
+	for _, pair := range strings.Split(value, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		key, encoded, ok := strings.Cut(pair, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return fmt.Errorf("expected 'key=value', got '%s'", pair)
+		}
+		decoded, err := url.PathUnescape(strings.TrimSpace(encoded))
+		if err != nil {
+			return fmt.Errorf("invalid value of '%s': %w", key, err)
+		}
+		(*v.headers)[key] = decoded
+	}
+	return nil
+}
+
+func (v *headersValue) String() string {
+	if v.headers == nil {
+		return ""
+	}
+	pairs := make([]string, 0, len(*v.headers))
+	for key, value := range *v.headers {
+		pairs = append(pairs, key+"="+url.PathEscape(value))
+	}
+	slices.Sort(pairs)
+	return strings.Join(pairs, ",")
+}
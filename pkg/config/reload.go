@@ -0,0 +1,177 @@
+package config
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"io/fs"
+	"log/slog"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	myOtel "github.com/pitoniak32/trace-export/pkg/otel"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	tracer = otel.Tracer(myOtel.SERVICE_TRACER_NAME)
+)
+
+// the settings that are read for every webhook, changes to anything else only apply after a restart.
+var liveSettings = []string{"webhook.", "filters.", "enrichment.", "features.custom_properties", "admin."}
+
+// RequiresRestart reports whether a change to the setting (a YAML path like 'server.addr') only
+// applies after a restart.
+func RequiresRestart(setting string) bool {
+	for _, prefix := range liveSettings {
+		if strings.HasPrefix(setting, prefix) {
+			return false
+		}
+	}
+	return true
+}
+
+// LoadFn loads the config again from the same sources as on startup.
+type LoadFn func() (*Config, error)
+
+// Reloader holds the current config, and swaps in a new one when it is reloaded and valid.
+type Reloader struct {
+	load    LoadFn
+	current atomic.Pointer[Config]
+	// only one reload at a time, so the changes are logged against the config they replace
+	mu sync.Mutex
+}
+
+func NewReloader(initial *Config, load LoadFn) *Reloader {
+	r := &Reloader{load: load}
+	r.current.Store(initial)
+	return r
+}
+
+// Current returns the config to use, callers should hold on to it for the rest of a request.
+func (r *Reloader) Current() *Config {
+	return r.current.Load()
+}
+
+// Reload loads and validates the config, and swaps it in. The current config is kept when the new
+// one fails to load or is invalid. Returns the settings that changed.
+func (r *Reloader) Reload(ctx context.Context, reason string) ([]string, error) {
+	_, span := tracer.Start(ctx, "ReloadConfig", trace.WithAttributes(attribute.String("config.reload.reason", reason)))
+	defer span.End()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	next, err := r.load()
+	if err == nil {
+		err = next.Validate()
+	}
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "invalid config")
+		slog.Error("kept the current config, failed to reload", "reason", reason, "err", err)
+		return nil, err
+	}
+
+	changed := Diff(r.current.Load(), next)
+	var restart []string
+	for _, setting := range changed {
+		if RequiresRestart(setting) {
+			restart = append(restart, setting)
+		}
+	}
+	span.SetAttributes(
+		attribute.StringSlice("config.reload.changed", changed),
+		attribute.StringSlice("config.reload.requires_restart", restart),
+	)
+
+	r.current.Store(next)
+
+	if len(changed) == 0 {
+		slog.Info("reloaded config, nothing changed", "reason", reason)
+		return nil, nil
+	}
+	slog.Info("reloaded config", "reason", reason, "changed", changed)
+	if len(restart) > 0 {
+		slog.Warn("changed settings only apply after a restart", "settings", restart)
+	}
+
+	return changed, nil
+}
+
+// ScheduleWatch reloads the config every time the contents of the file change, checking every
+// interval until the context is cancelled.
+func (r *Reloader) ScheduleWatch(ctx context.Context, configPath string, interval time.Duration) {
+	last, err := fileHash(configPath)
+	if err != nil {
+		slog.Error("failed to read config file, watching it anyway", "config", configPath, "err", err)
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				hash, err := fileHash(configPath)
+				if err != nil {
+					// editors can replace the file, it is checked again on the next tick
+					if !errors.Is(err, fs.ErrNotExist) {
+						slog.Error("failed to read config file", "config", configPath, "err", err)
+					}
+					continue
+				}
+				if hash == last {
+					continue
+				}
+				last = hash
+				_, _ = r.Reload(ctx, "file changed")
+			}
+		}
+	}()
+}
+
+func fileHash(path string) ([sha256.Size]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return [sha256.Size]byte{}, err
+	}
+	return sha256.Sum256(data), nil
+}
+
+// Diff returns the YAML paths of the settings that are different between the configs. Only the
+// paths are returned, so secrets can't end up in the logs.
+func Diff(old *Config, new *Config) []string {
+	var changed []string
+	diffValues("", reflect.ValueOf(*old), reflect.ValueOf(*new), &changed)
+	return changed
+}
+
+func diffValues(path string, old reflect.Value, new reflect.Value, changed *[]string) {
+	if old.Kind() != reflect.Struct {
+		if !reflect.DeepEqual(old.Interface(), new.Interface()) {
+			*changed = append(*changed, path)
+		}
+		return
+	}
+
+	for i := 0; i < old.NumField(); i++ {
+		name, options, _ := strings.Cut(old.Type().Field(i).Tag.Get("yaml"), ",")
+		if options == "inline" {
+			// the fields of an inlined struct are settings of the struct it is in
+			name = path
+		} else if path != "" {
+			name = path + "." + name
+		}
+		diffValues(name, old.Field(i), new.Field(i), changed)
+	}
+}
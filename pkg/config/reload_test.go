@@ -0,0 +1,109 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReload(t *testing.T) {
+	tests := map[string]struct {
+		givenChange     func(c *Config)
+		givenLoadErr    error
+		expectedChanged []string
+		expectedErr     bool
+	}{
+		"valid change is swapped in": {
+			givenChange:     func(c *Config) { c.Filters.ExcludeRepos = []string{"octo/*"} },
+			expectedChanged: []string{"filters.exclude_repos"},
+		},
+		"nothing changed": {
+			givenChange:     func(c *Config) {},
+			expectedChanged: nil,
+		},
+		"invalid config is not swapped in": {
+			givenChange: func(c *Config) { c.Handler.Mode = "eventually" },
+			expectedErr: true,
+		},
+		"failed load is not swapped in": {
+			givenChange:  func(c *Config) {},
+			givenLoadErr: errors.New("failed to read"),
+			expectedErr:  true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			// Arrange
+			initial := NewConfig()
+			reloader := NewReloader(initial, func() (*Config, error) {
+				next := NewConfig()
+				test.givenChange(next)
+				return next, test.givenLoadErr
+			})
+
+			// Act
+			changed, err := reloader.Reload(context.Background(), "test")
+
+			// Assert
+			assert.Equal(t, test.expectedChanged, changed)
+			if test.expectedErr {
+				assert.Error(t, err)
+				assert.Same(t, initial, reloader.Current(), "the current config should be kept")
+			} else {
+				assert.NoError(t, err)
+				assert.NotSame(t, initial, reloader.Current())
+			}
+		})
+	}
+}
+
+func TestDiff(t *testing.T) {
+	// Arrange
+	old := NewConfig()
+	new := NewConfig()
+	new.Server.Addr = ":9090"
+	new.GitHub.App.ID = 1
+	new.Webhook.Secrets = []string{"rotated"}
+	new.Enrichment.Attributes = map[string]string{"team": "platform"}
+	new.Exporter.Protocol = "http/protobuf"
+
+	// Act
+	changed := Diff(old, new)
+
+	// Assert
+	assert.Equal(t, []string{"server.addr", "github.app.id", "webhook.secrets", "exporter.protocol", "enrichment.attributes"}, changed)
+	assert.True(t, RequiresRestart("server.addr"))
+	assert.False(t, RequiresRestart("webhook.secrets"))
+}
+
+func TestScheduleWatch(t *testing.T) {
+	// Arrange
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	assert.NoError(t, os.WriteFile(configPath, []byte("filters:\n  exclude_repos: [octo/one]\n"), 0o644))
+	load := func() (*Config, error) {
+		return Load(configPath, func(string) (string, bool) { return "", false })
+	}
+	initial, err := load()
+	assert.NoError(t, err)
+	reloader := NewReloader(initial, load)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Act
+	reloader.ScheduleWatch(ctx, configPath, 10*time.Millisecond)
+	assert.NoError(t, os.WriteFile(configPath, []byte("filters:\n  exclude_repos: [octo/two]\n"), 0o644))
+
+	// Assert
+	assert.Eventually(t, func() bool {
+		return reloader.Current().Filters.Allows("octo/one", "ci") && !reloader.Current().Filters.Allows("octo/two", "ci")
+	}, time.Second, 10*time.Millisecond)
+}
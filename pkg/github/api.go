@@ -0,0 +1,122 @@
+package github
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	eg "github.com/google/go-github/v66/github"
+	"github.com/pitoniak32/trace-export/pkg/cache"
+)
+
+// ListJobs fetches all the jobs of a workflow run attempt from the Actions API.
+func ListJobs(ctx context.Context, client *eg.Client, budget *RateBudget, owner string, repo string, runId int64, runAttempt int64) (*eg.Jobs, error) {
+	opts := &eg.ListOptions{PerPage: 100}
+	var jobs []*eg.WorkflowJob
+	for {
+		var page *eg.Jobs
+		var res *eg.Response
+		err := budget.Do(ctx, func() (*eg.Response, error) {
+			var err error
+			page, res, err = client.Actions.ListWorkflowJobsAttempt(ctx, owner, repo, runId, normalizeRunAttempt(runAttempt), opts)
+			return res, err
+		})
+		if err != nil {
+			return nil, &WorkflowRunHandlingError{
+				originErr:     err,
+				errMsg:        fmt.Sprintf("Failed to list the jobs of attempt %d", normalizeRunAttempt(runAttempt)),
+				workflowRunID: &runId,
+			}
+		}
+
+		jobs = append(jobs, page.Jobs...)
+		if res.NextPage == 0 {
+			break
+		}
+		opts.Page = res.NextPage
+	}
+
+	totalCount := len(jobs)
+	return &eg.Jobs{TotalCount: &totalCount, Jobs: jobs}, nil
+}
+
+// GetRunAttempt fetches a workflow run attempt and all of its jobs from the Actions API.
+func GetRunAttempt(ctx context.Context, client *eg.Client, budget *RateBudget, owner string, repo string, runId int64, runAttempt int64) (*eg.WorkflowRun, *eg.Jobs, error) {
+	var run *eg.WorkflowRun
+	err := budget.Do(ctx, func() (*eg.Response, error) {
+		var res *eg.Response
+		var err error
+		run, res, err = client.Actions.GetWorkflowRunAttempt(ctx, owner, repo, runId, int(normalizeRunAttempt(runAttempt)), nil)
+		return res, err
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get attempt %d of run %d: %w", normalizeRunAttempt(runAttempt), runId, err)
+	}
+
+	jobs, err := ListJobs(ctx, client, budget, owner, repo, runId, runAttempt)
+	if err != nil {
+		return nil, nil, err
+	}
+	return run, jobs, nil
+}
+
+// SplitRepo splits a repo in the 'owner/repo' format into its owner and name.
+func SplitRepo(repo string) (string, string, error) {
+	owner, name, ok := strings.Cut(repo, "/")
+	if !ok || owner == "" || name == "" || strings.Contains(name, "/") {
+		return "", "", fmt.Errorf("invalid repo '%s', expecting 'owner/repo'", repo)
+	}
+	return owner, name, nil
+}
+
+// RefreshCustomProperties returns a cache refresh function that fetches the custom properties of
+// the repo ('owner/repo') that the cache entry is named after.
+func RefreshCustomProperties(client *eg.Client, budget *RateBudget) cache.EntryRefreshFn {
+	return func(ctx context.Context, name string, entry *cache.CacheEntry) error {
+		owner, repo, err := SplitRepo(name)
+		if err != nil {
+			return err
+		}
+
+		var values []*eg.CustomPropertyValue
+		err = budget.Do(ctx, func() (*eg.Response, error) {
+			var res *eg.Response
+			var err error
+			values, res, err = client.Repositories.GetAllCustomPropertyValues(ctx, owner, repo)
+			return res, err
+		})
+		if err != nil {
+			return fmt.Errorf("failed to get the custom properties of '%s': %w", name, err)
+		}
+
+		props := make(map[string]string, len(values))
+		for _, value := range values {
+			props[value.PropertyName] = customPropertyString(value.Value)
+		}
+
+		entry.Props = props
+		entry.UpdatedAtMillis = time.Now().UnixMilli()
+		return nil
+	}
+}
+
+// customPropertyString formats the value of a custom property, multi select values are joined with commas.
+func customPropertyString(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case []string:
+		return strings.Join(v, ",")
+	case []interface{}:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			values = append(values, fmt.Sprint(item))
+		}
+		return strings.Join(values, ",")
+	default:
+		return fmt.Sprint(v)
+	}
+}
@@ -7,13 +7,14 @@ import (
 	"fmt"
 	"log/slog"
 	"net/http"
+	"slices"
 
 	eg "github.com/google/go-github/v66/github"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/trace"
 )
 
-func HandlePayload(payload eg.WorkflowRunEvent, tracer trace.Tracer) error {
+func HandlePayload(ctx context.Context, payload eg.WorkflowRunEvent, tracer trace.Tracer) error {
 	payloadAction := payload.GetAction()
 	if payloadAction == "" {
 		return errors.New("Webhook Payload.Action was not found.")
@@ -33,7 +34,7 @@ func HandlePayload(payload eg.WorkflowRunEvent, tracer trace.Tracer) error {
 	case "in_progress":
 		return HandleWorkflowRunInProgress(*workflowRun, workflowRunID)
 	case "completed":
-		return HandleWorkflowRunCompleted(*workflowRun, workflowRunID, tracer)
+		return HandleWorkflowRunCompleted(ctx, *workflowRun, workflowRunID, tracer)
 	default:
 		return HandleWorkflowRunUnknown(*workflowRun, workflowRunID)
 	}
@@ -49,55 +50,38 @@ func HandleWorkflowRunInProgress(_w eg.WorkflowRun, runId int64) error {
 	return nil
 }
 
-// func AttributesFromCustomProperties(props []*eg.CustomPropertyValue) []attribute.KeyValue {
-// 	attributes := []attribute.KeyValue{
-// 		attribute.Int64("workflow_run.id", ),
-// 	}
-// 	return attributes
-// }
-
-func HandleWorkflowRunCompleted(w eg.WorkflowRun, runId int64, tracer trace.Tracer) error {
-	// client := github.NewClient(nil).WithAuthToken("")
-	// props, res, err := client.Repositories.GetAllCustomPropertyValues(context.Background(), "", "")
-	// if err != nil {
-	// 	panic("failed to get repo custom properties")
-	// }
-
-	startTime := w.GetRunStartedAt().Time
-	if startTime.IsZero() {
-		return &WorkflowRunHandlingError{
-			errMsg:        "Cannot find 'run_start_time' on the workflow_run event",
-			workflowRunID: &runId,
-		}
+// AttributesFromCustomProperties turns the custom properties of a repo into attributes for the root
+// span of its workflow runs.
+func AttributesFromCustomProperties(props map[string]string) []attribute.KeyValue {
+	names := make([]string, 0, len(props))
+	for name := range props {
+		names = append(names, name)
 	}
+	slices.Sort(names)
 
-	// The time that this workflow run completed (since this is the completed handler)
-	endTime := w.GetUpdatedAt().Time
-	if endTime.IsZero() {
-		return &WorkflowRunHandlingError{
-			errMsg:        "Cannot find 'updated_at' on the workflow_run event",
-			workflowRunID: &runId,
-		}
+	attributes := make([]attribute.KeyValue, 0, len(props))
+	for _, name := range names {
+		attributes = append(attributes, attribute.String("repository.custom_properties."+name, props[name]))
 	}
+	return attributes
+}
 
-	spanName := w.GetName()
-	if spanName == "" {
-		spanName = "UNKNOWN"
-	}
+func HandleWorkflowRunCompleted(ctx context.Context, w eg.WorkflowRun, runId int64, tracer trace.Tracer) error {
+	slog.Debug("handling workflow run", "run.id", runId, "run.status", "completed")
 
-	attributes := []attribute.KeyValue{
-		attribute.Int64("workflow_run.id", runId),
+	jobs, err := FetchJobs(w, runId)
+	if err != nil {
+		return err
 	}
 
-	// Start a new span using the workflow run tracer.
-	ctx, span := tracer.Start(context.Background(), spanName, trace.WithTimestamp(startTime), trace.WithAttributes(attributes...))
-	defer span.End(trace.WithTimestamp(endTime))
-
-	slog.Debug("handling workflow run", "run.id", runId, "run.status", "completed")
+	return TraceWorkflowRun(ctx, w, runId, *jobs, tracer)
+}
 
+// FetchJobs requests the jobs of the workflow run from its jobs_url.
+func FetchJobs(w eg.WorkflowRun, runId int64) (*eg.Jobs, error) {
 	jobsUrl := w.GetJobsURL()
 	if jobsUrl == "" {
-		return &WorkflowRunHandlingError{
+		return nil, &WorkflowRunHandlingError{
 			errMsg:        "Cannot find 'jobs_url' on the workflow event",
 			workflowRunID: &runId,
 		}
@@ -105,26 +89,26 @@ func HandleWorkflowRunCompleted(w eg.WorkflowRun, runId int64, tracer trace.Trac
 
 	res, err := http.Get(jobsUrl)
 	if err != nil {
-		return &WorkflowRunHandlingError{
+		return nil, &WorkflowRunHandlingError{
 			originErr:     err,
 			errMsg:        fmt.Sprintf("Request to '%s' to fetch jobs failed", jobsUrl),
 			workflowRunID: &runId,
 		}
 	}
+	defer res.Body.Close()
 
 	var jobs eg.Jobs
 	dec := json.NewDecoder(res.Body)
 	err = dec.Decode(&jobs)
 	if err != nil {
-		panic("couldn't decode")
-	}
-
-	err = TraceWorkflowJobs(ctx, startTime, jobs, tracer)
-	if err != nil {
-		return err
+		return nil, &WorkflowRunHandlingError{
+			originErr:     err,
+			errMsg:        fmt.Sprintf("Response from '%s' could not be decoded as jobs", jobsUrl),
+			workflowRunID: &runId,
+		}
 	}
 
-	return nil
+	return &jobs, nil
 }
 
 func HandleWorkflowRunUnknown(w eg.WorkflowRun, runId int64) error {
@@ -1,6 +1,7 @@
 package github
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
@@ -65,7 +66,7 @@ func TestHandlePayloadCompleted(t *testing.T) {
 				JobsURL:      jobsUrl,
 			}
 
-			err := HandleWorkflowRunCompleted(workflowRun, 1234, testTracer)
+			err := HandleWorkflowRunCompleted(context.Background(), workflowRun, 1234, testTracer)
 
 			if err != nil {
 				if !strings.Contains(err.Error(), tt.want) {
@@ -0,0 +1,132 @@
+package github
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	eg "github.com/google/go-github/v66/github"
+	myOtel "github.com/pitoniak32/trace-export/pkg/otel"
+	"github.com/pitoniak32/trace-export/pkg/state"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Mode controls when the spans of a workflow run are exported.
+type Mode string
+
+const (
+	// ModeCompleted exports the whole trace once the workflow run has completed.
+	ModeCompleted Mode = "completed"
+	// ModeLive exports the job spans as the jobs complete, and closes the root span once the
+	// workflow run has completed.
+	ModeLive Mode = "live"
+	// ModeJobEvents builds the trace from the steps in the workflow_job events, and only fetches the
+	// jobs from the API when some of them are missing.
+	ModeJobEvents Mode = "job_events"
+)
+
+var (
+	tracer = otel.Tracer(myOtel.SERVICE_TRACER_NAME)
+)
+
+type Handler struct {
+	mode   Mode
+	tracer trace.Tracer
+	// tracks the workflow runs that are in progress, not used by ModeCompleted
+	store state.Store
+	// fetch the jobs that ModeJobEvents didn't receive the events of
+	client *eg.Client
+	budget *RateBudget
+}
+
+func NewHandler(mode Mode, tracer trace.Tracer, store state.Store, client *eg.Client, budget *RateBudget) (*Handler, error) {
+	switch mode {
+	case ModeCompleted:
+	case ModeLive, ModeJobEvents:
+		if store == nil {
+			return nil, fmt.Errorf("mode '%s' requires a state store", mode)
+		}
+		if mode == ModeJobEvents && (client == nil || budget == nil) {
+			return nil, fmt.Errorf("mode '%s' requires a github client", mode)
+		}
+	default:
+		return nil, fmt.Errorf("unknown mode '%s'", mode)
+	}
+
+	return &Handler{
+		mode:   mode,
+		tracer: tracer,
+		store:  store,
+		client: client,
+		budget: budget,
+	}, nil
+}
+
+func (h *Handler) HandleWorkflowRunEvent(ctx context.Context, payload eg.WorkflowRunEvent) error {
+	if h.mode == ModeCompleted {
+		return HandlePayload(ctx, payload, h.tracer)
+	}
+
+	payloadAction := payload.GetAction()
+	if payloadAction == "" {
+		return errors.New("Webhook Payload.Action was not found.")
+	}
+	workflowRun := payload.GetWorkflowRun()
+	if workflowRun == nil {
+		return errors.New("Expecting a workflow_run for all webhook events.")
+	}
+	workflowRunID := workflowRun.GetID()
+	if workflowRunID == 0 {
+		return errors.New("Expecting a workflow_run.id for all webhook events.")
+	}
+
+	switch payloadAction {
+	case "requested", "in_progress":
+		return h.handleLiveWorkflowRunStarted(ctx, *workflowRun, workflowRunID)
+	case "completed":
+		if h.mode == ModeJobEvents {
+			return h.handleJobEventsWorkflowRunCompleted(ctx, *workflowRun, workflowRunID)
+		}
+		return h.handleLiveWorkflowRunCompleted(ctx, *workflowRun, workflowRunID)
+	default:
+		return HandleWorkflowRunUnknown(*workflowRun, workflowRunID)
+	}
+}
+
+func (h *Handler) HandleWorkflowJobEvent(ctx context.Context, payload eg.WorkflowJobEvent) error {
+	if h.mode == ModeCompleted {
+		slog.Debug("skipping workflow job event", "mode", h.mode)
+		return nil
+	}
+
+	payloadAction := payload.GetAction()
+	if payloadAction == "" {
+		return errors.New("Webhook Payload.Action was not found.")
+	}
+	workflowJob := payload.GetWorkflowJob()
+	if workflowJob == nil {
+		return errors.New("Expecting a workflow_job for all webhook events.")
+	}
+	workflowJobID := workflowJob.GetID()
+	if workflowJobID == 0 {
+		return errors.New("Expecting a workflow_job.id for all webhook events.")
+	}
+
+	if h.mode == ModeJobEvents {
+		return h.handleJobEventsWorkflowJob(ctx, workflowJob, workflowJobID)
+	}
+
+	// the spans of the jobs are exported before the run completes, so they are routed by the job
+	ctx = myOtel.ContextWithRun(ctx, payload.GetRepo().GetFullName(), workflowJob.GetWorkflowName())
+	switch payloadAction {
+	case "in_progress":
+		return h.handleLiveWorkflowJobInProgress(ctx, workflowJob, workflowJobID)
+	case "completed":
+		return h.handleLiveWorkflowJobCompleted(ctx, workflowJob, workflowJobID)
+	default:
+		slog.Debug("skipping workflow job", "job.id", workflowJobID, "job.status", payloadAction)
+		return nil
+	}
+}
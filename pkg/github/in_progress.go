@@ -0,0 +1,49 @@
+package github
+
+import (
+	"time"
+
+	eg "github.com/google/go-github/v66/github"
+)
+
+// CloseInProgress prepares a run that hasn't completed yet to be traced, like the run of the job
+// that is tracing it. Whatever is still in progress ends at now (keeping its in_progress status),
+// and the jobs and steps that haven't started yet are left out. The passed run and jobs are not
+// modified.
+func CloseInProgress(w eg.WorkflowRun, jobs eg.Jobs, now time.Time) (eg.WorkflowRun, eg.Jobs) {
+	nowTimestamp := &eg.Timestamp{Time: now}
+
+	if w.GetStatus() != "completed" {
+		w.UpdatedAt = nowTimestamp
+	}
+
+	closedJobs := make([]*eg.WorkflowJob, 0, len(jobs.Jobs))
+	for _, job := range jobs.Jobs {
+		if job.GetStartedAt().Time.IsZero() || job.GetStatus() == "queued" || job.GetStatus() == "waiting" {
+			continue
+		}
+
+		closedJob := *job
+		if closedJob.GetCompletedAt().Time.IsZero() {
+			closedJob.CompletedAt = nowTimestamp
+		}
+
+		closedJob.Steps = make([]*eg.TaskStep, 0, len(job.Steps))
+		for _, step := range job.Steps {
+			if step.GetStartedAt().Time.IsZero() {
+				continue
+			}
+
+			closedStep := *step
+			if closedStep.GetCompletedAt().Time.IsZero() {
+				closedStep.CompletedAt = nowTimestamp
+			}
+			closedJob.Steps = append(closedJob.Steps, &closedStep)
+		}
+
+		closedJobs = append(closedJobs, &closedJob)
+	}
+
+	totalCount := len(closedJobs)
+	return w, eg.Jobs{TotalCount: &totalCount, Jobs: closedJobs}
+}
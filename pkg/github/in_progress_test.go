@@ -0,0 +1,64 @@
+package github
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	eg "github.com/google/go-github/v66/github"
+	"github.com/pitoniak32/trace-export/pkg/internal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCloseInProgress(t *testing.T) {
+	// Arrange
+	start := time.Now().Add(-10 * time.Minute)
+	now := time.Now()
+	workflowRun := eg.WorkflowRun{
+		ID:           eg.Int64(42),
+		Status:       eg.String("in_progress"),
+		RunStartedAt: &eg.Timestamp{Time: start},
+		UpdatedAt:    &eg.Timestamp{Time: start.Add(time.Minute)},
+	}
+	jobs := eg.Jobs{Jobs: []*eg.WorkflowJob{
+		{
+			ID:          eg.Int64(1),
+			Name:        eg.String("build"),
+			Status:      eg.String("completed"),
+			StartedAt:   &eg.Timestamp{Time: start.Add(time.Minute)},
+			CompletedAt: &eg.Timestamp{Time: start.Add(5 * time.Minute)},
+		},
+		{
+			// the job that is tracing the run
+			ID:        eg.Int64(2),
+			Name:      eg.String("trace"),
+			Status:    eg.String("in_progress"),
+			StartedAt: &eg.Timestamp{Time: start.Add(6 * time.Minute)},
+			Steps: []*eg.TaskStep{
+				{Name: eg.String("export"), Number: eg.Int64(1), Status: eg.String("in_progress"), StartedAt: &eg.Timestamp{Time: start.Add(7 * time.Minute)}},
+				{Name: eg.String("cleanup"), Number: eg.Int64(2), Status: eg.String("pending")},
+			},
+		},
+		{
+			ID:     eg.Int64(3),
+			Name:   eg.String("deploy"),
+			Status: eg.String("queued"),
+		},
+	}}
+
+	// Act
+	closedRun, closedJobs := CloseInProgress(workflowRun, jobs, now)
+
+	// Assert
+	assert.Equal(t, now, closedRun.GetUpdatedAt().Time)
+	assert.Equal(t, 2, closedJobs.GetTotalCount(), "the queued job should be left out")
+	assert.Equal(t, start.Add(5*time.Minute), closedJobs.Jobs[0].GetCompletedAt().Time)
+	assert.Equal(t, now, closedJobs.Jobs[1].GetCompletedAt().Time)
+	assert.Equal(t, 1, len(closedJobs.Jobs[1].Steps), "the pending step should be left out")
+	assert.Equal(t, now, closedJobs.Jobs[1].Steps[0].GetCompletedAt().Time)
+	assert.Nil(t, jobs.Jobs[1].CompletedAt, "the passed jobs should not be modified")
+
+	tracer, exporter := internal.NewTestTracerWithExporter()
+	assert.NoError(t, TraceWorkflowRun(context.Background(), closedRun, 42, closedJobs, tracer))
+	assert.Equal(t, 5, len(exporter.GetSpans()), "expected root, queued, two jobs and one step")
+}
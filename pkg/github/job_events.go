@@ -0,0 +1,253 @@
+package github
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"slices"
+	"time"
+
+	eg "github.com/google/go-github/v66/github"
+	"github.com/pitoniak32/trace-export/pkg/state"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// the number of times the trace of a run is assembled before it is dropped, the entry of a run that
+// keeps failing would otherwise never expire since every attempt updates it
+const maxAssemblies = 5
+
+// handleJobEventsWorkflowJob records the job (with its steps) so the trace can be assembled without
+// fetching the jobs from the API once the run has completed.
+func (h *Handler) handleJobEventsWorkflowJob(ctx context.Context, job *eg.WorkflowJob, jobId int64) error {
+	key := state.RunKey{RunID: job.GetRunID(), RunAttempt: normalizeRunAttempt(job.GetRunAttempt())}
+
+	err := h.store.Update(ctx, key, func(run *state.Run) error {
+		if run.Exported {
+			return nil
+		}
+		// webhooks are not guaranteed to arrive in order, don't let an in_progress event replace a completed one.
+		if previous, ok := run.Jobs[jobId]; ok && previous.GetStatus() == "completed" {
+			return nil
+		}
+		run.Jobs[jobId] = job
+		return nil
+	})
+	if err != nil {
+		return &WorkflowJobHandlingError{
+			originErr:     err,
+			errMsg:        "Failed to record the workflow job",
+			workflowJobID: &jobId,
+		}
+	}
+
+	return nil
+}
+
+// handleJobEventsWorkflowRunCompleted records the completed run. Its trace is assembled by the sweep
+// once the grace period has passed, since the events of its jobs can arrive after it.
+func (h *Handler) handleJobEventsWorkflowRunCompleted(ctx context.Context, w eg.WorkflowRun, runId int64) error {
+	key := state.RunKey{RunID: runId, RunAttempt: normalizeRunAttempt(int64(w.GetRunAttempt()))}
+
+	err := h.store.Update(ctx, key, func(run *state.Run) error {
+		if run.Exported {
+			return nil
+		}
+		run.WorkflowRun = &w
+		if run.CompletedAt.IsZero() {
+			run.CompletedAt = time.Now()
+		}
+		return nil
+	})
+	if err != nil {
+		return &WorkflowRunHandlingError{
+			originErr:     err,
+			errMsg:        "Failed to record the completed workflow run",
+			workflowRunID: &runId,
+		}
+	}
+
+	slog.Debug("waiting for workflow job events", "run.id", runId, "run.attempt", key.RunAttempt)
+	return nil
+}
+
+// SweepJobEvents assembles the traces of the runs that completed more than grace ago. Returns the
+// number of runs that were assembled.
+func (h *Handler) SweepJobEvents(ctx context.Context, now time.Time, grace time.Duration) (int, error) {
+	if h.mode != ModeJobEvents {
+		return 0, nil
+	}
+
+	ctx, span := tracer.Start(ctx, "SweepJobEvents", trace.WithAttributes(attribute.Int64("sweep.grace.ms", grace.Milliseconds())))
+	defer span.End()
+
+	runs, err := h.store.List(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	var errs error
+	assembled := 0
+	for _, run := range runs {
+		if run.Exported || run.CompletedAt.IsZero() || now.Sub(run.CompletedAt) < grace {
+			continue
+		}
+		err := h.assembleWorkflowRun(ctx, run.Key)
+		if err != nil {
+			errs = errors.Join(errs, err)
+			continue
+		}
+		assembled += 1
+	}
+
+	span.SetAttributes(attribute.Int("sweep.total.assembled", assembled))
+	return assembled, errs
+}
+
+// ScheduleSweep runs SweepJobEvents every interval until the context is cancelled.
+func (h *Handler) ScheduleSweep(ctx context.Context, interval time.Duration, grace time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				_, err := h.SweepJobEvents(ctx, now, grace)
+				if err != nil {
+					slog.Error("failed to assemble workflow runs", "err", err)
+				}
+			}
+		}
+	}()
+}
+
+// assembleWorkflowRun exports the trace of the run from the recorded jobs. When some jobs are not
+// completed, or none were recorded, the jobs are fetched from the API instead. The run is only marked
+// as exported once its trace was, runs that fail before any of their spans are exported are
+// assembled again by the next sweep, until they failed maxAssemblies times.
+func (h *Handler) assembleWorkflowRun(ctx context.Context, key state.RunKey) error {
+	runId := key.RunID
+
+	// claim the run first, so it is only assembled once when sweeps race each other.
+	var run state.Run
+	claimed := false
+	err := h.store.Update(ctx, key, func(r *state.Run) error {
+		if r.Exported || r.Assembling || r.WorkflowRun == nil {
+			return nil
+		}
+		r.Assembling = true
+		run = *r
+		claimed = true
+		return nil
+	})
+	if err != nil {
+		return &WorkflowRunHandlingError{
+			originErr:     err,
+			errMsg:        "Failed to update the workflow run state",
+			workflowRunID: &runId,
+		}
+	}
+	if !claimed {
+		return nil
+	}
+
+	err = h.traceAssembledRun(ctx, run)
+	var partial *PartialTraceError
+	if errors.As(err, &partial) {
+		// the spans that could be traced were exported, assembling the run again would duplicate them
+		slog.Warn("exported the trace of a workflow run with missing spans", "run.id", runId, "run.attempt", key.RunAttempt, "err", err)
+	} else if err != nil {
+		return errors.Join(err, h.releaseWorkflowRun(ctx, key, err))
+	}
+
+	// the recorded jobs aren't needed anymore, the entry is kept to ignore redelivered events
+	err = h.store.Update(ctx, key, func(r *state.Run) error {
+		r.Assembling = false
+		r.Exported = true
+		r.Jobs = map[int64]*eg.WorkflowJob{}
+		r.WorkflowRun = nil
+		return nil
+	})
+	if err != nil {
+		return &WorkflowRunHandlingError{
+			originErr:     err,
+			errMsg:        "Failed to mark the workflow run as exported",
+			workflowRunID: &runId,
+		}
+	}
+	return nil
+}
+
+func (h *Handler) traceAssembledRun(ctx context.Context, run state.Run) error {
+	runId := run.Key.RunID
+
+	jobs := recordedJobs(run)
+	if !isReadyToAssemble(&run) {
+		slog.Info("falling back to the api for missing workflow jobs", "run.id", runId, "run.attempt", run.Key.RunAttempt, "jobs.recorded", len(run.Jobs))
+		owner, name, err := SplitRepo(run.WorkflowRun.GetRepository().GetFullName())
+		if err != nil {
+			return err
+		}
+		fetched, err := ListJobs(ctx, h.client, h.budget, owner, name, runId, run.Key.RunAttempt)
+		if err != nil {
+			return err
+		}
+		jobs = *fetched
+	}
+
+	return TraceWorkflowRun(ctx, *run.WorkflowRun, runId, jobs, h.tracer)
+}
+
+// releaseWorkflowRun lets the next sweep assemble the run again after it failed, or drops it once
+// it failed too often.
+func (h *Handler) releaseWorkflowRun(ctx context.Context, key state.RunKey, cause error) error {
+	failed := 0
+	err := h.store.Update(ctx, key, func(r *state.Run) error {
+		r.Assembling = false
+		r.FailedAssemblies += 1
+		failed = r.FailedAssemblies
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if failed < maxAssemblies {
+		slog.Warn("failed to assemble workflow run, retrying on the next sweep", "run.id", key.RunID, "run.attempt", key.RunAttempt, "attempts", failed, "err", cause)
+		return nil
+	}
+
+	slog.Error("dropping workflow run that failed to assemble", "run.id", key.RunID, "run.attempt", key.RunAttempt, "attempts", failed, "err", cause)
+	return h.store.Delete(ctx, key)
+}
+
+// isReadyToAssemble reports whether the run has completed and every job that we know about has too.
+// Jobs whose events never arrived can't be known, those are only included by waiting out the grace
+// period before assembling.
+func isReadyToAssemble(run *state.Run) bool {
+	if run.WorkflowRun == nil || len(run.Jobs) == 0 {
+		return false
+	}
+	for _, job := range run.Jobs {
+		if job.GetStatus() != "completed" {
+			return false
+		}
+	}
+	return true
+}
+
+// recordedJobs returns the jobs recorded for the run ordered by when they started, the same order
+// the jobs API returns them in.
+func recordedJobs(run state.Run) eg.Jobs {
+	jobs := make([]*eg.WorkflowJob, 0, len(run.Jobs))
+	for _, job := range run.Jobs {
+		jobs = append(jobs, job)
+	}
+	slices.SortFunc(jobs, func(a, b *eg.WorkflowJob) int {
+		return a.GetStartedAt().Time.Compare(b.GetStartedAt().Time)
+	})
+
+	totalCount := len(jobs)
+	return eg.Jobs{TotalCount: &totalCount, Jobs: jobs}
+}
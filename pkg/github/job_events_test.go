@@ -0,0 +1,303 @@
+package github
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	eg "github.com/google/go-github/v66/github"
+	"github.com/pitoniak32/trace-export/pkg/internal"
+	myOtel "github.com/pitoniak32/trace-export/pkg/otel"
+	"github.com/pitoniak32/trace-export/pkg/state"
+	"github.com/stretchr/testify/assert"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+func testJob(id int64, status string, start time.Time) *eg.WorkflowJob {
+	return &eg.WorkflowJob{
+		ID:          eg.Int64(id),
+		RunID:       eg.Int64(42),
+		Name:        eg.String("job"),
+		Status:      eg.String(status),
+		StartedAt:   &eg.Timestamp{Time: start},
+		CompletedAt: &eg.Timestamp{Time: start.Add(time.Minute)},
+		Steps: []*eg.TaskStep{{
+			Name:        eg.String("step"),
+			Number:      eg.Int64(1),
+			StartedAt:   &eg.Timestamp{Time: start},
+			CompletedAt: &eg.Timestamp{Time: start.Add(time.Minute)},
+		}},
+	}
+}
+
+// newTestJobsClient returns a client for a fake api that serves the jobs of run 42 of 'octo/repo'.
+func newTestJobsClient(t *testing.T, jobs http.HandlerFunc) *eg.Client {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/octo/repo/actions/runs/42/attempts/1/jobs", jobs)
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	client := eg.NewClient(nil)
+	client.BaseURL, _ = url.Parse(server.URL + "/")
+	return client
+}
+
+func TestJobEventsAssemblesWithoutAPI(t *testing.T) {
+	// Arrange
+	tracer, exporter := internal.NewTestTracerWithExporter()
+	handler, err := NewHandler(ModeJobEvents, tracer, state.NewMemoryStore(time.Hour), eg.NewClient(nil), NewRateBudget(0))
+	assert.NoError(t, err)
+
+	ctx := context.Background()
+	start := time.Now().Add(-10 * time.Minute)
+	// no repository, assembling the trace would fail if the api was called
+	workflowRun := &eg.WorkflowRun{
+		ID:           eg.Int64(42),
+		Name:         eg.String("ci"),
+		RunStartedAt: &eg.Timestamp{Time: start},
+		UpdatedAt:    &eg.Timestamp{Time: start.Add(5 * time.Minute)},
+	}
+
+	// Act
+	assert.NoError(t, handler.HandleWorkflowJobEvent(ctx, eg.WorkflowJobEvent{Action: eg.String("completed"), WorkflowJob: testJob(2, "completed", start)}))
+	assert.NoError(t, handler.HandleWorkflowRunEvent(ctx, eg.WorkflowRunEvent{Action: eg.String("completed"), WorkflowRun: workflowRun}))
+	early, err := handler.SweepJobEvents(ctx, time.Now(), time.Hour)
+	assert.NoError(t, err)
+
+	// Assert
+	assert.Equal(t, 0, early, "should wait out the grace period for jobs whose events are late")
+	assert.Equal(t, 0, len(exporter.GetSpans()))
+
+	// Act
+	// the event of a job arrives after the run completed
+	assert.NoError(t, handler.HandleWorkflowJobEvent(ctx, eg.WorkflowJobEvent{Action: eg.String("completed"), WorkflowJob: testJob(1, "completed", start.Add(time.Minute))}))
+	late, err := handler.SweepJobEvents(ctx, time.Now().Add(2*time.Hour), time.Hour)
+	assert.NoError(t, err)
+
+	// Assert
+	assert.Equal(t, 1, late)
+	spans := exporter.GetSpans()
+	assert.Equal(t, 6, len(spans), "expected root, queued, and two jobs with one step each")
+	for _, span := range spans {
+		assert.Equal(t, RunTraceID(42, 1), span.SpanContext.TraceID())
+	}
+
+	// Act
+	// a redelivered webhook should not export the run twice
+	assert.NoError(t, handler.HandleWorkflowRunEvent(ctx, eg.WorkflowRunEvent{Action: eg.String("completed"), WorkflowRun: workflowRun}))
+	again, err := handler.SweepJobEvents(ctx, time.Now().Add(4*time.Hour), time.Hour)
+	assert.NoError(t, err)
+
+	// Assert
+	assert.Equal(t, 0, again)
+	assert.Equal(t, 6, len(exporter.GetSpans()))
+}
+
+func TestJobEventsSweepFallsBackToAPI(t *testing.T) {
+	// Arrange
+	requests := 0
+	client := newTestJobsClient(t, func(w http.ResponseWriter, r *http.Request) {
+		requests += 1
+		assert.Equal(t, "Bearer token", r.Header.Get("Authorization"), "the jobs should be fetched with the client's token")
+		_, err := w.Write([]byte(`{"total_count": 1, "jobs": [{"id": 1, "name": "job", "started_at": "2024-01-01T00:01:00Z", "completed_at": "2024-01-01T00:02:00Z"}]}`))
+		if err != nil {
+			t.Fatalf("writing response from jobs mock failed.")
+		}
+	})
+	client = client.WithAuthToken("token")
+
+	tracer, exporter := internal.NewTestTracerWithExporter()
+	handler, err := NewHandler(ModeJobEvents, tracer, state.NewMemoryStore(time.Hour), client, NewRateBudget(0))
+	assert.NoError(t, err)
+
+	ctx := context.Background()
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	workflowRun := &eg.WorkflowRun{
+		ID:           eg.Int64(42),
+		Name:         eg.String("ci"),
+		RunStartedAt: &eg.Timestamp{Time: start},
+		UpdatedAt:    &eg.Timestamp{Time: start.Add(5 * time.Minute)},
+		Repository:   &eg.Repository{FullName: eg.String("octo/repo")},
+	}
+	assert.NoError(t, handler.HandleWorkflowRunEvent(ctx, eg.WorkflowRunEvent{Action: eg.String("completed"), WorkflowRun: workflowRun}))
+
+	// Act
+	early, err := handler.SweepJobEvents(ctx, time.Now(), time.Hour)
+	assert.NoError(t, err)
+	late, err := handler.SweepJobEvents(ctx, time.Now().Add(2*time.Hour), time.Hour)
+	assert.NoError(t, err)
+
+	// Assert
+	assert.Equal(t, 0, early, "should not assemble before the grace timeout")
+	assert.Equal(t, 1, late)
+	assert.Equal(t, 1, requests)
+	assert.Equal(t, 3, len(exporter.GetSpans()), "expected root, queued, and one job")
+}
+
+func TestJobEventsRetriesFailedRuns(t *testing.T) {
+	// Arrange
+	requests := 0
+	client := newTestJobsClient(t, func(w http.ResponseWriter, r *http.Request) {
+		requests += 1
+		if requests == 1 {
+			// not decoded as an empty list of jobs
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"message": "Not Found"}`))
+			return
+		}
+		_, err := w.Write([]byte(`{"total_count": 1, "jobs": [{"id": 1, "name": "job", "started_at": "2024-01-01T00:01:00Z", "completed_at": "2024-01-01T00:02:00Z"}]}`))
+		if err != nil {
+			t.Fatalf("writing response from jobs mock failed.")
+		}
+	})
+
+	tracer, exporter := internal.NewTestTracerWithExporter()
+	store := state.NewMemoryStore(time.Hour)
+	handler, err := NewHandler(ModeJobEvents, tracer, store, client, NewRateBudget(0))
+	assert.NoError(t, err)
+
+	ctx := context.Background()
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	workflowRun := &eg.WorkflowRun{
+		ID:           eg.Int64(42),
+		Name:         eg.String("ci"),
+		RunStartedAt: &eg.Timestamp{Time: start},
+		UpdatedAt:    &eg.Timestamp{Time: start.Add(5 * time.Minute)},
+		Repository:   &eg.Repository{FullName: eg.String("octo/repo")},
+	}
+	assert.NoError(t, handler.HandleWorkflowRunEvent(ctx, eg.WorkflowRunEvent{Action: eg.String("completed"), WorkflowRun: workflowRun}))
+
+	// Act
+	failed, err := handler.SweepJobEvents(ctx, time.Now().Add(2*time.Hour), time.Hour)
+
+	// Assert
+	assert.Error(t, err)
+	assert.Equal(t, 0, failed)
+	run, ok, _ := store.Get(ctx, state.RunKey{RunID: 42, RunAttempt: 1})
+	assert.True(t, ok, "the run should be kept to be assembled again")
+	assert.False(t, run.Exported)
+	assert.False(t, run.Assembling)
+	assert.Equal(t, 1, run.FailedAssemblies)
+
+	// Act
+	retried, err := handler.SweepJobEvents(ctx, time.Now().Add(2*time.Hour), time.Hour)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, 1, retried)
+	assert.Equal(t, 2, requests)
+	assert.Equal(t, 3, len(exporter.GetSpans()), "expected root, queued, and one job")
+	run, _, _ = store.Get(ctx, state.RunKey{RunID: 42, RunAttempt: 1})
+	assert.True(t, run.Exported)
+}
+
+func TestJobEventsDropsRunsThatKeepFailing(t *testing.T) {
+	// Arrange
+	tracer, _ := internal.NewTestTracerWithExporter()
+	store := state.NewMemoryStore(time.Hour)
+	handler, err := NewHandler(ModeJobEvents, tracer, store, eg.NewClient(nil), NewRateBudget(0))
+	assert.NoError(t, err)
+
+	ctx := context.Background()
+	start := time.Now().Add(-10 * time.Minute)
+	// no jobs were recorded and there is no repository to fetch them from
+	workflowRun := &eg.WorkflowRun{
+		ID:           eg.Int64(42),
+		Name:         eg.String("ci"),
+		RunStartedAt: &eg.Timestamp{Time: start},
+		UpdatedAt:    &eg.Timestamp{Time: start.Add(5 * time.Minute)},
+	}
+	assert.NoError(t, handler.HandleWorkflowRunEvent(ctx, eg.WorkflowRunEvent{Action: eg.String("completed"), WorkflowRun: workflowRun}))
+
+	// Act
+	for range maxAssemblies {
+		_, err := handler.SweepJobEvents(ctx, time.Now().Add(2*time.Hour), time.Hour)
+		assert.Error(t, err)
+	}
+
+	// Assert
+	_, ok, _ := store.Get(ctx, state.RunKey{RunID: 42, RunAttempt: 1})
+	assert.False(t, ok, "the run should be dropped once it failed too often")
+}
+
+func TestJobEventsDoesNotRetryPartiallyExportedRuns(t *testing.T) {
+	// Arrange
+	tracer, exporter := internal.NewTestTracerWithExporter()
+	store := state.NewMemoryStore(time.Hour)
+	handler, err := NewHandler(ModeJobEvents, tracer, store, eg.NewClient(nil), NewRateBudget(0))
+	assert.NoError(t, err)
+
+	ctx := context.Background()
+	start := time.Now().Add(-10 * time.Minute)
+	broken := testJob(2, "completed", start)
+	broken.CompletedAt = nil
+	workflowRun := &eg.WorkflowRun{
+		ID:           eg.Int64(42),
+		Name:         eg.String("ci"),
+		RunStartedAt: &eg.Timestamp{Time: start},
+		UpdatedAt:    &eg.Timestamp{Time: start.Add(5 * time.Minute)},
+	}
+	assert.NoError(t, handler.HandleWorkflowJobEvent(ctx, eg.WorkflowJobEvent{Action: eg.String("completed"), WorkflowJob: testJob(1, "completed", start)}))
+	assert.NoError(t, handler.HandleWorkflowJobEvent(ctx, eg.WorkflowJobEvent{Action: eg.String("completed"), WorkflowJob: broken}))
+	assert.NoError(t, handler.HandleWorkflowRunEvent(ctx, eg.WorkflowRunEvent{Action: eg.String("completed"), WorkflowRun: workflowRun}))
+
+	// Act
+	assembled, err := handler.SweepJobEvents(ctx, time.Now().Add(2*time.Hour), time.Hour)
+	assert.NoError(t, err)
+	exported := len(exporter.GetSpans())
+	again, err := handler.SweepJobEvents(ctx, time.Now().Add(2*time.Hour), time.Hour)
+	assert.NoError(t, err)
+
+	// Assert
+	assert.Equal(t, 1, assembled)
+	assert.Equal(t, 0, again)
+	assert.Equal(t, 4, exported, "expected root, queued, and the job that could be traced with its step")
+	assert.Equal(t, exported, len(exporter.GetSpans()), "the spans should not be exported twice")
+	run, _, _ := store.Get(ctx, state.RunKey{RunID: 42, RunAttempt: 1})
+	assert.True(t, run.Exported)
+	assert.Equal(t, 0, run.FailedAssemblies)
+}
+
+// failingExporter fails every export.
+type failingExporter struct{}
+
+func (failingExporter) ExportSpans(context.Context, []sdktrace.ReadOnlySpan) error {
+	return errors.New("collector unavailable")
+}
+
+func (failingExporter) Shutdown(context.Context) error { return nil }
+
+func TestJobEventsRetriesRunsWhoseTraceFailedToExport(t *testing.T) {
+	// Arrange
+	processor := myOtel.NewBatchProcessor(failingExporter{}, myOtel.BatchOptions{Interval: time.Hour, FlushOnRootEnd: true})
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(processor))
+	t.Cleanup(func() { _ = provider.Shutdown(context.Background()) })
+	store := state.NewMemoryStore(time.Hour)
+	handler, err := NewHandler(ModeJobEvents, provider.Tracer("test"), store, eg.NewClient(nil), NewRateBudget(0))
+	assert.NoError(t, err)
+
+	ctx := context.Background()
+	start := time.Now().Add(-10 * time.Minute)
+	workflowRun := &eg.WorkflowRun{
+		ID:           eg.Int64(42),
+		Name:         eg.String("ci"),
+		RunStartedAt: &eg.Timestamp{Time: start},
+		UpdatedAt:    &eg.Timestamp{Time: start.Add(5 * time.Minute)},
+	}
+	assert.NoError(t, handler.HandleWorkflowJobEvent(ctx, eg.WorkflowJobEvent{Action: eg.String("completed"), WorkflowJob: testJob(1, "completed", start)}))
+	assert.NoError(t, handler.HandleWorkflowRunEvent(ctx, eg.WorkflowRunEvent{Action: eg.String("completed"), WorkflowRun: workflowRun}))
+
+	// Act
+	assembled, err := handler.SweepJobEvents(ctx, time.Now().Add(2*time.Hour), time.Hour)
+
+	// Assert
+	assert.ErrorContains(t, err, "collector unavailable")
+	assert.Equal(t, 0, assembled)
+	run, _, _ := store.Get(ctx, state.RunKey{RunID: 42, RunAttempt: 1})
+	assert.False(t, run.Exported, "the run should be assembled again by the next sweep")
+	assert.Equal(t, 1, run.FailedAssemblies)
+}
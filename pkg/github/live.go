@@ -0,0 +1,154 @@
+package github
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	eg "github.com/google/go-github/v66/github"
+	"github.com/pitoniak32/trace-export/pkg/state"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// handleLiveWorkflowRunStarted records when the run started, so the queued time can be traced once
+// the first job is picked up by a runner.
+func (h *Handler) handleLiveWorkflowRunStarted(ctx context.Context, w eg.WorkflowRun, runId int64) error {
+	startTime := w.GetRunStartedAt().Time
+	if startTime.IsZero() {
+		return &WorkflowRunHandlingError{
+			errMsg:        "Cannot find 'run_start_time' on the workflow_run event",
+			workflowRunID: &runId,
+		}
+	}
+
+	key := state.RunKey{RunID: runId, RunAttempt: normalizeRunAttempt(int64(w.GetRunAttempt()))}
+	err := h.store.Update(ctx, key, func(run *state.Run) error {
+		if run.StartedAt.IsZero() {
+			run.StartedAt = startTime
+		}
+		return nil
+	})
+	if err != nil {
+		return &WorkflowRunHandlingError{
+			originErr:     err,
+			errMsg:        "Failed to record the workflow run start",
+			workflowRunID: &runId,
+		}
+	}
+
+	slog.Debug("recorded workflow run start", "run.id", runId, "run.attempt", key.RunAttempt)
+	return nil
+}
+
+// handleLiveWorkflowRunCompleted closes the root span, the spans of the jobs have already been
+// exported as their workflow_job events arrived and will be stitched into it by their ids.
+func (h *Handler) handleLiveWorkflowRunCompleted(ctx context.Context, w eg.WorkflowRun, runId int64) error {
+	key := state.RunKey{RunID: runId, RunAttempt: normalizeRunAttempt(int64(w.GetRunAttempt()))}
+
+	startTime := w.GetRunStartedAt().Time
+	if startTime.IsZero() {
+		run, ok, err := h.store.Get(ctx, key)
+		if err != nil {
+			return &WorkflowRunHandlingError{
+				originErr:     err,
+				errMsg:        "Failed to look up the workflow run start",
+				workflowRunID: &runId,
+			}
+		}
+		if ok {
+			startTime = run.StartedAt
+		}
+	}
+	if startTime.IsZero() {
+		return &WorkflowRunHandlingError{
+			errMsg:        "Cannot find 'run_start_time' on the workflow_run event",
+			workflowRunID: &runId,
+		}
+	}
+
+	endTime := w.GetUpdatedAt().Time
+	if endTime.IsZero() {
+		return &WorkflowRunHandlingError{
+			errMsg:        "Cannot find 'updated_at' on the workflow_run event",
+			workflowRunID: &runId,
+		}
+	}
+
+	_, span := startWorkflowRunSpan(ctx, w, runId, startTime, h.tracer)
+	span.End(trace.WithTimestamp(endTime))
+
+	slog.Debug("handling workflow run", "run.id", runId, "run.status", "completed", "mode", h.mode)
+
+	err := h.store.Delete(ctx, key)
+	if err != nil {
+		return &WorkflowRunHandlingError{
+			originErr:     err,
+			errMsg:        "Failed to remove the workflow run state",
+			workflowRunID: &runId,
+		}
+	}
+
+	return nil
+}
+
+// handleLiveWorkflowJobInProgress traces how long the run was queued when its first job starts.
+func (h *Handler) handleLiveWorkflowJobInProgress(ctx context.Context, job *eg.WorkflowJob, jobId int64) error {
+	jobStartTime := job.GetStartedAt().Time
+	if jobStartTime.IsZero() {
+		return &WorkflowJobHandlingError{
+			errMsg:        "Cannot find 'started_at' on the workflow_job event",
+			workflowJobID: &jobId,
+		}
+	}
+
+	key := state.RunKey{RunID: job.GetRunID(), RunAttempt: normalizeRunAttempt(job.GetRunAttempt())}
+
+	var runStartTime time.Time
+	err := h.store.Update(ctx, key, func(run *state.Run) error {
+		if run.QueuedTraced || run.StartedAt.IsZero() {
+			return nil
+		}
+		run.QueuedTraced = true
+		runStartTime = run.StartedAt
+		return nil
+	})
+	if err != nil {
+		return &WorkflowJobHandlingError{
+			originErr:     err,
+			errMsg:        "Failed to update the workflow run state",
+			workflowJobID: &jobId,
+		}
+	}
+
+	if !runStartTime.IsZero() {
+		TraceQueued(runParentContext(ctx, key.RunID, key.RunAttempt), runStartTime, jobStartTime, h.tracer)
+	}
+
+	return nil
+}
+
+// handleLiveWorkflowJobCompleted exports the job and its steps as children of the run's root span.
+func (h *Handler) handleLiveWorkflowJobCompleted(ctx context.Context, job *eg.WorkflowJob, jobId int64) error {
+	key := state.RunKey{RunID: job.GetRunID(), RunAttempt: normalizeRunAttempt(job.GetRunAttempt())}
+
+	// claim the job first, so a redelivered webhook doesn't export it twice.
+	alreadyTraced := false
+	err := h.store.Update(ctx, key, func(run *state.Run) error {
+		alreadyTraced = run.TracedJobs[jobId]
+		run.TracedJobs[jobId] = true
+		return nil
+	})
+	if err != nil {
+		return &WorkflowJobHandlingError{
+			originErr:     err,
+			errMsg:        "Failed to update the workflow run state",
+			workflowJobID: &jobId,
+		}
+	}
+	if alreadyTraced {
+		slog.Debug("skipping workflow job that was already traced", "job.id", jobId)
+		return nil
+	}
+
+	return TraceWorkflowJob(runParentContext(ctx, key.RunID, key.RunAttempt), job, h.tracer)
+}
@@ -0,0 +1,124 @@
+package github
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	eg "github.com/google/go-github/v66/github"
+	"github.com/pitoniak32/trace-export/pkg/internal"
+	"github.com/pitoniak32/trace-export/pkg/state"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestLiveModeStitchesOneTrace(t *testing.T) {
+	// Arrange
+	tracer, exporter := internal.NewTestTracerWithExporter()
+	handler, err := NewHandler(ModeLive, tracer, state.NewMemoryStore(time.Hour), nil, nil)
+	assert.NoError(t, err)
+
+	ctx := context.Background()
+	start := time.Now().Add(-10 * time.Minute)
+	workflowRun := &eg.WorkflowRun{
+		ID:           eg.Int64(42),
+		Name:         eg.String("release"),
+		RunAttempt:   eg.Int(2),
+		RunStartedAt: &eg.Timestamp{Time: start},
+		UpdatedAt:    &eg.Timestamp{Time: start.Add(10 * time.Minute)},
+	}
+	workflowJob := &eg.WorkflowJob{
+		ID:          eg.Int64(7),
+		RunID:       eg.Int64(42),
+		RunAttempt:  eg.Int64(2),
+		Name:        eg.String("build"),
+		StartedAt:   &eg.Timestamp{Time: start.Add(time.Minute)},
+		CompletedAt: &eg.Timestamp{Time: start.Add(9 * time.Minute)},
+		Steps: []*eg.TaskStep{{
+			Name:        eg.String("compile"),
+			Number:      eg.Int64(1),
+			StartedAt:   &eg.Timestamp{Time: start.Add(2 * time.Minute)},
+			CompletedAt: &eg.Timestamp{Time: start.Add(8 * time.Minute)},
+		}},
+	}
+
+	// Act
+	assert.NoError(t, handler.HandleWorkflowRunEvent(ctx, eg.WorkflowRunEvent{Action: eg.String("requested"), WorkflowRun: workflowRun}))
+	assert.NoError(t, handler.HandleWorkflowJobEvent(ctx, eg.WorkflowJobEvent{Action: eg.String("in_progress"), WorkflowJob: workflowJob}))
+	assert.NoError(t, handler.HandleWorkflowJobEvent(ctx, eg.WorkflowJobEvent{Action: eg.String("completed"), WorkflowJob: workflowJob}))
+	// a redelivered webhook should not export the job twice
+	assert.NoError(t, handler.HandleWorkflowJobEvent(ctx, eg.WorkflowJobEvent{Action: eg.String("completed"), WorkflowJob: workflowJob}))
+	assert.NoError(t, handler.HandleWorkflowRunEvent(ctx, eg.WorkflowRunEvent{Action: eg.String("completed"), WorkflowRun: workflowRun}))
+
+	// Assert
+	spans := exporter.GetSpans()
+	assert.Equal(t, 4, len(spans), "expected queued, job, step and root spans")
+
+	byName := map[string]int{}
+	for i, span := range spans {
+		byName[span.Name] = i
+		assert.Equal(t, RunTraceID(42, 2), span.SpanContext.TraceID(), "span '%s' is not in the run's trace", span.Name)
+	}
+
+	root := spans[byName["release"]]
+	assert.Equal(t, RunSpanID(42, 2), root.SpanContext.SpanID())
+	assert.False(t, root.Parent.IsValid())
+	assert.Equal(t, root.SpanContext.SpanID(), spans[byName["Queued"]].Parent.SpanID())
+	assert.Equal(t, root.SpanContext.SpanID(), spans[byName["build"]].Parent.SpanID())
+	assert.Equal(t, spans[byName["build"]].SpanContext.SpanID(), spans[byName["compile"]].Parent.SpanID())
+}
+
+func TestLiveModeStartsTheRunOutsideTheWebhookTrace(t *testing.T) {
+	// Arrange
+	tracer, exporter := internal.NewTestTracerWithExporter()
+	handler, err := NewHandler(ModeLive, tracer, state.NewMemoryStore(time.Hour), nil, nil)
+	assert.NoError(t, err)
+
+	start := time.Now().Add(-10 * time.Minute)
+	workflowRun := &eg.WorkflowRun{
+		ID:           eg.Int64(42),
+		Name:         eg.String("release"),
+		RunAttempt:   eg.Int(1),
+		RunStartedAt: &eg.Timestamp{Time: start},
+		UpdatedAt:    &eg.Timestamp{Time: start.Add(10 * time.Minute)},
+	}
+	workflowJob := &eg.WorkflowJob{
+		ID:          eg.Int64(7),
+		RunID:       eg.Int64(42),
+		RunAttempt:  eg.Int64(1),
+		Name:        eg.String("build"),
+		StartedAt:   &eg.Timestamp{Time: start.Add(time.Minute)},
+		CompletedAt: &eg.Timestamp{Time: start.Add(9 * time.Minute)},
+	}
+
+	// each webhook is handled inside the span of its request
+	handle := func(fn func(ctx context.Context) error) trace.SpanContext {
+		ctx, span := tracer.Start(context.Background(), "github-webhook")
+		defer span.End()
+		assert.NoError(t, fn(ctx))
+		return span.SpanContext()
+	}
+
+	// Act
+	handle(func(ctx context.Context) error {
+		return handler.HandleWorkflowJobEvent(ctx, eg.WorkflowJobEvent{Action: eg.String("completed"), WorkflowJob: workflowJob})
+	})
+	webhook := handle(func(ctx context.Context) error {
+		return handler.HandleWorkflowRunEvent(ctx, eg.WorkflowRunEvent{Action: eg.String("completed"), WorkflowRun: workflowRun})
+	})
+
+	// Assert
+	byName := map[string]tracetest.SpanStub{}
+	for _, span := range exporter.GetSpans() {
+		byName[span.Name] = span
+	}
+
+	root, job := byName["release"], byName["build"]
+	assert.Equal(t, RunTraceID(42, 1), root.SpanContext.TraceID())
+	assert.Equal(t, RunTraceID(42, 1), job.SpanContext.TraceID())
+	assert.Equal(t, root.SpanContext.SpanID(), job.Parent.SpanID())
+	assert.False(t, root.Parent.IsValid())
+	assert.Equal(t, 1, len(root.Links))
+	assert.Equal(t, webhook, root.Links[0].SpanContext)
+}
@@ -0,0 +1,144 @@
+package github
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	eg "github.com/google/go-github/v66/github"
+)
+
+// RateBudget keeps track of the GitHub API rate limit from the responses of the requests made
+// through it, and holds requests back once the remaining budget drops to the reserve.
+type RateBudget struct {
+	mu sync.Mutex
+	// the number of requests that are kept in reserve (for the webhook handler for example)
+	reserve int
+	rate    eg.Rate
+}
+
+// ErrRateLimited is returned instead of waiting for the rate limit to reset, for the requests made
+// with a context from ContextWithoutRateWait.
+var ErrRateLimited = errors.New("the github rate limit is used up")
+
+func NewRateBudget(reserve int) *RateBudget {
+	return &RateBudget{reserve: reserve}
+}
+
+type noRateWaitKey struct{}
+
+// ContextWithoutRateWait returns a context for requests that can't wait for the rate limit to
+// reset, like the ones made while handling a webhook. Those requests can use the reserve, and fail
+// with ErrRateLimited once the limit is used up, or when a rate limit is hit.
+func ContextWithoutRateWait(ctx context.Context) context.Context {
+	return context.WithValue(ctx, noRateWaitKey{}, true)
+}
+
+// Do waits for the budget to allow a request, calls fn and records the rate from its response. When
+// fn fails because a rate limit was hit, it is retried once the limit resets.
+func (b *RateBudget) Do(ctx context.Context, fn func() (*eg.Response, error)) error {
+	noWait, _ := ctx.Value(noRateWaitKey{}).(bool)
+	for {
+		if noWait {
+			if b.exhausted() {
+				return ErrRateLimited
+			}
+		} else if err := b.Wait(ctx); err != nil {
+			return err
+		}
+
+		res, err := fn()
+		if res != nil {
+			b.observe(res.Rate)
+		}
+
+		var rateLimitErr *eg.RateLimitError
+		var abuseErr *eg.AbuseRateLimitError
+		switch {
+		case errors.As(err, &rateLimitErr):
+			b.observe(rateLimitErr.Rate)
+			slog.Warn("hit the github rate limit", "reset", rateLimitErr.Rate.Reset.Time)
+			if noWait {
+				return fmt.Errorf("%w: %w", ErrRateLimited, err)
+			}
+		case errors.As(err, &abuseErr) && noWait:
+			return fmt.Errorf("%w: %w", ErrRateLimited, err)
+		case errors.As(err, &abuseErr):
+			retryAfter := time.Minute
+			if abuseErr.RetryAfter != nil {
+				retryAfter = *abuseErr.RetryAfter
+			}
+			slog.Warn("hit the github secondary rate limit", "retry_after", retryAfter)
+			if err := sleep(ctx, retryAfter); err != nil {
+				return err
+			}
+		default:
+			return err
+		}
+	}
+}
+
+// Wait blocks until the remaining budget is above the reserve, or the rate limit has reset.
+func (b *RateBudget) Wait(ctx context.Context) error {
+	b.mu.Lock()
+	rate := b.rate
+	b.mu.Unlock()
+
+	if rate.Limit == 0 || rate.Remaining > b.reserve {
+		return nil
+	}
+
+	wait := time.Until(rate.Reset.Time)
+	if wait <= 0 {
+		return nil
+	}
+
+	slog.Info("waiting for the github rate limit to reset", "core.remaining", rate.Remaining, "core.reset", rate.Reset.Time)
+	return sleep(ctx, wait)
+}
+
+// exhausted reports whether no requests are left until the rate limit resets, reserve included.
+func (b *RateBudget) exhausted() bool {
+	b.mu.Lock()
+	rate := b.rate
+	b.mu.Unlock()
+
+	return rate.Limit != 0 && rate.Remaining <= 0 && time.Now().Before(rate.Reset.Time)
+}
+
+// Remaining returns the number of requests left before the rate limit resets, as of the last response.
+func (b *RateBudget) Remaining() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.rate.Remaining
+}
+
+func (b *RateBudget) observe(rate eg.Rate) {
+	if rate.Limit == 0 {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	// responses can arrive out of order, keep the one with the least remaining for the current window.
+	if rate.Reset.Time.After(b.rate.Reset.Time) || rate.Remaining < b.rate.Remaining {
+		b.rate = rate
+	}
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,62 @@
+package github
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	eg "github.com/google/go-github/v66/github"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateBudgetWithoutWait(t *testing.T) {
+	tests := map[string]struct {
+		remaining     int
+		err           error
+		expectedCalls int
+		expectedErr   error
+	}{
+		"uses the reserve": {
+			remaining:     5,
+			expectedCalls: 1,
+		},
+		"fails once the limit is used up": {
+			remaining:     0,
+			expectedCalls: 0,
+			expectedErr:   ErrRateLimited,
+		},
+		"doesn't retry when the rate limit is hit": {
+			remaining:     5,
+			err:           &eg.RateLimitError{Rate: eg.Rate{Limit: 5000, Remaining: 0, Reset: eg.Timestamp{Time: time.Now().Add(time.Hour)}}},
+			expectedCalls: 1,
+			expectedErr:   ErrRateLimited,
+		},
+		"doesn't retry when the secondary rate limit is hit": {
+			remaining:     5,
+			err:           &eg.AbuseRateLimitError{},
+			expectedCalls: 1,
+			expectedErr:   ErrRateLimited,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			// Arrange
+			budget := NewRateBudget(10)
+			budget.observe(eg.Rate{Limit: 5000, Remaining: test.remaining, Reset: eg.Timestamp{Time: time.Now().Add(time.Hour)}})
+			ctx, cancel := context.WithTimeout(ContextWithoutRateWait(context.Background()), time.Second)
+			defer cancel()
+
+			// Act
+			calls := 0
+			err := budget.Do(ctx, func() (*eg.Response, error) {
+				calls += 1
+				return nil, test.err
+			})
+
+			// Assert
+			assert.Equal(t, test.expectedCalls, calls)
+			assert.ErrorIs(t, err, test.expectedErr)
+		})
+	}
+}
@@ -0,0 +1,78 @@
+package github
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// RunRef names a workflow run attempt of a repo.
+type RunRef struct {
+	Owner      string
+	Repo       string
+	RunID      int64
+	RunAttempt int64
+}
+
+func (r RunRef) String() string {
+	return fmt.Sprintf("%s/%s run %d attempt %d", r.Owner, r.Repo, r.RunID, r.RunAttempt)
+}
+
+// ParseRunArgs parses a run from the arguments of a command, either the url of the run (on GitHub
+// or GitHub Enterprise Server) or 'owner/repo' followed by 'run_id[/attempt]'. The first attempt is
+// used when none is given.
+func ParseRunArgs(args []string) (RunRef, error) {
+	switch len(args) {
+	case 1:
+		return ParseRunURL(args[0])
+	case 2:
+		return ParseRunID(args[0], args[1])
+	default:
+		return RunRef{}, fmt.Errorf("expected the url of a run, or 'owner/repo run_id[/attempt]', got %d arguments", len(args))
+	}
+}
+
+// ParseRunURL parses the url of a run, like 'https://github.com/owner/repo/actions/runs/123' or
+// '.../actions/runs/123/attempts/2'. Anything after the run (or attempt), like a job, is ignored.
+func ParseRunURL(runURL string) (RunRef, error) {
+	u, err := url.Parse(runURL)
+	if err != nil {
+		return RunRef{}, fmt.Errorf("invalid run url '%s': %w", runURL, err)
+	}
+
+	// owner, repo, 'actions', 'runs', run id, and optionally 'attempts' and the attempt
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	if len(parts) < 5 || parts[2] != "actions" || parts[3] != "runs" {
+		return RunRef{}, fmt.Errorf("invalid run url '%s', expecting '.../owner/repo/actions/runs/run_id'", runURL)
+	}
+
+	id := parts[4]
+	if len(parts) >= 7 && parts[5] == "attempts" {
+		id += "/" + parts[6]
+	}
+	return ParseRunID(parts[0]+"/"+parts[1], id)
+}
+
+// ParseRunID parses 'run_id[/attempt]' of a run of the repo ('owner/repo').
+func ParseRunID(repo string, id string) (RunRef, error) {
+	owner, name, err := SplitRepo(repo)
+	if err != nil {
+		return RunRef{}, err
+	}
+
+	runID, attempt, hasAttempt := strings.Cut(id, "/")
+	ref := RunRef{Owner: owner, Repo: name, RunAttempt: 1}
+	ref.RunID, err = strconv.ParseInt(runID, 10, 64)
+	if err != nil || ref.RunID <= 0 {
+		return RunRef{}, fmt.Errorf("invalid run id '%s'", runID)
+	}
+	if hasAttempt {
+		ref.RunAttempt, err = strconv.ParseInt(attempt, 10, 64)
+		if err != nil || ref.RunAttempt <= 0 {
+			return RunRef{}, fmt.Errorf("invalid run attempt '%s'", attempt)
+		}
+	}
+
+	return ref, nil
+}
@@ -0,0 +1,61 @@
+package github
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRunArgs(t *testing.T) {
+	tests := map[string]struct {
+		givenArgs     []string
+		expectedRef   RunRef
+		expectedError string
+	}{
+		"run url": {
+			givenArgs:   []string{"https://github.com/octo/app/actions/runs/123"},
+			expectedRef: RunRef{Owner: "octo", Repo: "app", RunID: 123, RunAttempt: 1},
+		},
+		"attempt url of a job": {
+			givenArgs:   []string{"https://ghes.example.com/octo/app/actions/runs/123/attempts/2/job/456"},
+			expectedRef: RunRef{Owner: "octo", Repo: "app", RunID: 123, RunAttempt: 2},
+		},
+		"repo and run id": {
+			givenArgs:   []string{"octo/app", "123"},
+			expectedRef: RunRef{Owner: "octo", Repo: "app", RunID: 123, RunAttempt: 1},
+		},
+		"repo and run id with attempt": {
+			givenArgs:   []string{"octo/app", "123/3"},
+			expectedRef: RunRef{Owner: "octo", Repo: "app", RunID: 123, RunAttempt: 3},
+		},
+		"url of something else": {
+			givenArgs:     []string{"https://github.com/octo/app/pull/1"},
+			expectedError: "invalid run url 'https://github.com/octo/app/pull/1', expecting '.../owner/repo/actions/runs/run_id'",
+		},
+		"bad attempt": {
+			givenArgs:     []string{"octo/app", "123/0"},
+			expectedError: "invalid run attempt '0'",
+		},
+		"no arguments": {
+			givenArgs:     nil,
+			expectedError: "expected the url of a run, or 'owner/repo run_id[/attempt]', got 0 arguments",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			// Act
+			ref, err := ParseRunArgs(test.givenArgs)
+
+			// Assert
+			if test.expectedError == "" {
+				assert.NoError(t, err)
+				assert.Equal(t, test.expectedRef, ref)
+			} else {
+				assert.EqualError(t, err, test.expectedError)
+			}
+		})
+	}
+}
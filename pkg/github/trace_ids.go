@@ -0,0 +1,52 @@
+package github
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+
+	myOtel "github.com/pitoniak32/trace-export/pkg/otel"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// RunTraceID derives the trace id of a workflow run attempt, so every span for the attempt can be
+// put into the same trace no matter which event it was created from.
+func RunTraceID(runID int64, runAttempt int64) trace.TraceID {
+	var id trace.TraceID
+	sum := sha256.Sum256([]byte(fmt.Sprintf("workflow_run/%d/%d", runID, normalizeRunAttempt(runAttempt))))
+	copy(id[:], sum[:])
+	return id
+}
+
+// RunSpanID derives the span id of the root span for a workflow run attempt.
+func RunSpanID(runID int64, runAttempt int64) trace.SpanID {
+	var id trace.SpanID
+	sum := sha256.Sum256([]byte(fmt.Sprintf("workflow_run/%d/%d/root", runID, normalizeRunAttempt(runAttempt))))
+	copy(id[:], sum[:])
+	return id
+}
+
+// runRootContext returns a context that makes the next root span use the ids of the workflow run attempt.
+func runRootContext(ctx context.Context, runID int64, runAttempt int64) context.Context {
+	return myOtel.ContextWithRootIDs(ctx, RunTraceID(runID, runAttempt), RunSpanID(runID, runAttempt))
+}
+
+// runParentContext returns a context with the (possibly not yet exported) root span of the workflow
+// run attempt as the parent, used to emit spans for the run before the run itself has completed.
+func runParentContext(ctx context.Context, runID int64, runAttempt int64) context.Context {
+	spanContext := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    RunTraceID(runID, runAttempt),
+		SpanID:     RunSpanID(runID, runAttempt),
+		TraceFlags: trace.FlagsSampled,
+		Remote:     true,
+	})
+	return trace.ContextWithRemoteSpanContext(ctx, spanContext)
+}
+
+// GitHub leaves run_attempt out of some payloads, those are always the first attempt.
+func normalizeRunAttempt(runAttempt int64) int64 {
+	if runAttempt < 1 {
+		return 1
+	}
+	return runAttempt
+}
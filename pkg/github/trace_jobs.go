@@ -12,7 +12,7 @@ import (
 )
 
 func TraceWorkflowJobs(ctx context.Context, workflowStart time.Time, jobs eg.Jobs, tracer trace.Tracer) error {
-	if *jobs.TotalCount < 1 {
+	if jobs.GetTotalCount() < 1 {
 		return errors.New("not enough jobs in workflow to trace")
 	}
 
@@ -20,9 +20,7 @@ func TraceWorkflowJobs(ctx context.Context, workflowStart time.Time, jobs eg.Job
 	if firstJobStartTime.IsZero() {
 		return errors.New("first job did not have a start time")
 	}
-	// track how long the first job was queued before it was picked up by a runner.
-	ctx, span := tracer.Start(ctx, "Queued", trace.WithTimestamp(workflowStart))
-	span.End(trace.WithTimestamp(firstJobStartTime))
+	TraceQueued(ctx, workflowStart, firstJobStartTime, tracer)
 
 	var jobErrors error = nil
 	for _, job := range jobs.Jobs {
@@ -35,6 +33,12 @@ func TraceWorkflowJobs(ctx context.Context, workflowStart time.Time, jobs eg.Job
 	return jobErrors
 }
 
+// TraceQueued tracks how long the first job was queued before it was picked up by a runner.
+func TraceQueued(ctx context.Context, workflowStart time.Time, firstJobStart time.Time, tracer trace.Tracer) {
+	_, span := tracer.Start(ctx, "Queued", trace.WithTimestamp(workflowStart), trace.WithAttributes(sampleRateAttributes(ctx)...))
+	span.End(trace.WithTimestamp(firstJobStart))
+}
+
 func TraceWorkflowJob(ctx context.Context, job *eg.WorkflowJob, tracer trace.Tracer) error {
 	jobId := job.GetID()
 	if jobId == 0 {
@@ -65,7 +69,16 @@ func TraceWorkflowJob(ctx context.Context, job *eg.WorkflowJob, tracer trace.Tra
 
 	attributes := []attribute.KeyValue{
 		attribute.Int64("workflow_job.id", jobId),
+		attribute.String("workflow_job.status", job.GetStatus()),
+		attribute.String("workflow_job.conclusion", job.GetConclusion()),
+		// jobs on the same runner can't overlap, which is how they are laid out in timeline views
+		attribute.String("workflow_job.runner_name", job.GetRunnerName()),
+	}
+	// how long the job waited for a runner, after it was created (once the jobs it needs completed)
+	if createdAt := job.GetCreatedAt().Time; !createdAt.IsZero() && !createdAt.After(startTime) {
+		attributes = append(attributes, attribute.Int64("workflow_job.queued.ms", startTime.Sub(createdAt).Milliseconds()))
 	}
+	attributes = append(attributes, sampleRateAttributes(ctx)...)
 
 	// Start a new span using the workflow run tracer.
 	ctx, span := tracer.Start(ctx, jobSpanName, trace.WithTimestamp(startTime), trace.WithAttributes(attributes...))
@@ -0,0 +1,170 @@
+package github
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"time"
+
+	eg "github.com/google/go-github/v66/github"
+	myOtel "github.com/pitoniak32/trace-export/pkg/otel"
+	"github.com/pitoniak32/trace-export/pkg/sampling"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TraceWorkflowRun exports the trace of a completed workflow run attempt with its jobs and their steps.
+func TraceWorkflowRun(ctx context.Context, w eg.WorkflowRun, runId int64, jobs eg.Jobs, tracer trace.Tracer) error {
+	startTime := w.GetRunStartedAt().Time
+	if startTime.IsZero() {
+		return &WorkflowRunHandlingError{
+			errMsg:        "Cannot find 'run_start_time' on the workflow_run event",
+			workflowRunID: &runId,
+		}
+	}
+
+	// The time that this workflow run completed (since this is the completed handler)
+	endTime := w.GetUpdatedAt().Time
+	if endTime.IsZero() {
+		return &WorkflowRunHandlingError{
+			errMsg:        "Cannot find 'updated_at' on the workflow_run event",
+			workflowRunID: &runId,
+		}
+	}
+
+	if sampler, ok := ctx.Value(samplerKey{}).(*sampling.Sampler); ok {
+		decision := sampler.Sample(sampling.Run{
+			ID:         runId,
+			Repo:       w.GetRepository().GetFullName(),
+			Workflow:   w.GetName(),
+			Conclusion: w.GetConclusion(),
+			Duration:   endTime.Sub(startTime),
+		})
+		if !decision.Keep {
+			slog.Debug("skipping sampled out workflow run", "run.id", runId, "run.attempt", w.GetRunAttempt(), "sampling.rate", decision.Rate)
+			return nil
+		}
+		ctx = context.WithValue(ctx, decisionKey{}, decision)
+	}
+
+	ctx, flushed := myOtel.ContextWithFlushResult(ctx)
+	ctx, span := startWorkflowRunSpan(ctx, w, runId, startTime, tracer)
+	err := TraceWorkflowJobs(ctx, startTime, jobs, tracer)
+	span.End(trace.WithTimestamp(endTime))
+
+	// the processors that flush when the root span ends report whether the trace was exported, a
+	// trace that wasn't can be traced again without duplicating its spans
+	if flushErr := flushed.Err(); flushErr != nil {
+		return &WorkflowRunHandlingError{
+			originErr:     errors.Join(flushErr, err),
+			errMsg:        "Failed to export the trace of the workflow run",
+			workflowRunID: &runId,
+		}
+	}
+	if err != nil {
+		return &PartialTraceError{originErr: err, workflowRunID: runId}
+	}
+
+	return nil
+}
+
+// PartialTraceError is returned once the spans of a run were started, for the jobs and steps that
+// couldn't be traced. The rest of the trace is exported, so tracing the run again would export its
+// spans twice.
+type PartialTraceError struct {
+	originErr     error
+	workflowRunID int64
+}
+
+func (e *PartialTraceError) Error() string {
+	return fmt.Sprintf("the trace of workflow_run 'id = %d' is missing some spans: %s", e.workflowRunID, e.originErr)
+}
+
+func (e *PartialTraceError) Unwrap() error {
+	return e.originErr
+}
+
+type samplerKey struct{}
+
+type decisionKey struct{}
+
+// ContextWithSampler returns a context that only traces the workflow runs the sampler keeps.
+func ContextWithSampler(ctx context.Context, sampler *sampling.Sampler) context.Context {
+	return context.WithValue(ctx, samplerKey{}, sampler)
+}
+
+// sampleRateAttributes records the sample rate of the run on each of its spans, so backends can
+// count the runs that were sampled out. Runs traced without a sampler don't have one.
+func sampleRateAttributes(ctx context.Context) []attribute.KeyValue {
+	decision, ok := ctx.Value(decisionKey{}).(sampling.Decision)
+	if !ok {
+		return nil
+	}
+	return []attribute.KeyValue{attribute.Int64("sampling.sample_rate", decision.SampleRate())}
+}
+
+type runAttributesKey struct{}
+
+// ContextWithRunAttributes returns a context that adds the attributes to the root span of the
+// workflow run traced with it, used to enrich the run with details that aren't in its payload.
+func ContextWithRunAttributes(ctx context.Context, attributes ...attribute.KeyValue) context.Context {
+	existing, _ := ctx.Value(runAttributesKey{}).([]attribute.KeyValue)
+	return context.WithValue(ctx, runAttributesKey{}, append(slices.Clip(existing), attributes...))
+}
+
+// Enricher returns a context with the details of the repo that aren't in the payloads of its runs,
+// like its custom properties.
+type Enricher func(ctx context.Context, repo string) context.Context
+
+type enricherKey struct{}
+
+// ContextWithEnricher returns a context that enriches the workflow runs traced with it, when their
+// root span starts. The backfill, poller and sweep trace runs long after their webhooks were
+// received, so the details are looked up for each run instead of once for the context.
+func ContextWithEnricher(ctx context.Context, enrich Enricher) context.Context {
+	return context.WithValue(ctx, enricherKey{}, enrich)
+}
+
+// startWorkflowRunSpan starts the root span of a workflow run attempt using the workflow run tracer.
+// The span is always a new root, any span in the context (like the one for the webhook request that
+// triggered it) is linked to instead.
+func startWorkflowRunSpan(ctx context.Context, w eg.WorkflowRun, runId int64, startTime time.Time, tracer trace.Tracer) (context.Context, trace.Span) {
+	spanName := w.GetName()
+	if spanName == "" {
+		spanName = "UNKNOWN"
+	}
+
+	if enrich, ok := ctx.Value(enricherKey{}).(Enricher); ok {
+		ctx = enrich(ctx, w.GetRepository().GetFullName())
+	}
+
+	attributes := []attribute.KeyValue{
+		attribute.Int64("workflow_run.id", runId),
+		attribute.Int("workflow_run.attempt", w.GetRunAttempt()),
+		attribute.String("workflow_run.status", w.GetStatus()),
+		attribute.String("workflow_run.conclusion", w.GetConclusion()),
+	}
+
+	if extra, ok := ctx.Value(runAttributesKey{}).([]attribute.KeyValue); ok {
+		attributes = append(attributes, extra...)
+	}
+	if decision, ok := ctx.Value(decisionKey{}).(sampling.Decision); ok {
+		attributes = append(attributes, sampleRateAttributes(ctx)...)
+		attributes = append(attributes, attribute.String("sampling.reason", decision.Reason))
+	}
+
+	opts := []trace.SpanStartOption{
+		trace.WithNewRoot(),
+		trace.WithTimestamp(startTime),
+		trace.WithAttributes(attributes...),
+	}
+	if link := trace.LinkFromContext(ctx); link.SpanContext.IsValid() {
+		opts = append(opts, trace.WithLinks(link))
+	}
+
+	ctx = runRootContext(ctx, runId, int64(w.GetRunAttempt()))
+	ctx = myOtel.ContextWithRun(ctx, w.GetRepository().GetFullName(), w.GetName())
+	return tracer.Start(ctx, spanName, opts...)
+}
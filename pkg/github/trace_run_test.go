@@ -0,0 +1,121 @@
+package github
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	eg "github.com/google/go-github/v66/github"
+	"github.com/pitoniak32/trace-export/pkg/internal"
+	"github.com/pitoniak32/trace-export/pkg/sampling"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+func TestTraceWorkflowRunSampling(t *testing.T) {
+	sampler := sampling.NewSampler(sampling.Options{
+		KeepConclusions: sampling.DEFAULT_KEEP_CONCLUSIONS,
+		Rules:           []sampling.Rule{{Workflows: []string{"ci"}, Rate: 1}},
+	})
+
+	tests := map[string]struct {
+		givenContext       func(ctx context.Context) context.Context
+		givenWorkflow      string
+		givenConclusion    string
+		expectedSpans      int
+		expectedSampleRate *int64
+	}{
+		"run without a sampler": {
+			givenContext:    func(ctx context.Context) context.Context { return ctx },
+			givenWorkflow:   "lint",
+			givenConclusion: "success",
+			expectedSpans:   4,
+		},
+		"sampled out run": {
+			givenContext:    func(ctx context.Context) context.Context { return ContextWithSampler(ctx, sampler) },
+			givenWorkflow:   "lint",
+			givenConclusion: "success",
+			expectedSpans:   0,
+		},
+		"failed run": {
+			givenContext:       func(ctx context.Context) context.Context { return ContextWithSampler(ctx, sampler) },
+			givenWorkflow:      "lint",
+			givenConclusion:    "failure",
+			expectedSpans:      4,
+			expectedSampleRate: eg.Int64(1),
+		},
+		"run kept by a rule": {
+			givenContext:       func(ctx context.Context) context.Context { return ContextWithSampler(ctx, sampler) },
+			givenWorkflow:      "ci",
+			givenConclusion:    "success",
+			expectedSpans:      4,
+			expectedSampleRate: eg.Int64(1),
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			// Arrange
+			tracer, exporter := internal.NewTestTracerWithExporter()
+			start := time.Unix(1700000000, 0)
+			run := eg.WorkflowRun{
+				ID:           eg.Int64(42),
+				Name:         eg.String(test.givenWorkflow),
+				Conclusion:   eg.String(test.givenConclusion),
+				Repository:   &eg.Repository{FullName: eg.String("octo/web")},
+				RunStartedAt: &eg.Timestamp{Time: start},
+				UpdatedAt:    &eg.Timestamp{Time: start.Add(5 * time.Minute)},
+			}
+			jobs := eg.Jobs{TotalCount: eg.Int(1), Jobs: []*eg.WorkflowJob{testJob(1, "completed", start)}}
+
+			// Act
+			err := TraceWorkflowRun(test.givenContext(context.Background()), run, 42, jobs, tracer)
+
+			// Assert
+			assert.NoError(t, err)
+			spans := exporter.GetSpans()
+			// the root, the queued time, the job and its step
+			assert.Len(t, spans, test.expectedSpans)
+			for _, span := range spans {
+				var sampleRate *int64
+				for _, kv := range span.Attributes {
+					if kv.Key == attribute.Key("sampling.sample_rate") {
+						sampleRate = eg.Int64(kv.Value.AsInt64())
+					}
+				}
+				assert.Equal(t, test.expectedSampleRate, sampleRate, span.Name)
+			}
+		})
+	}
+}
+
+func TestTraceWorkflowRunEnrichment(t *testing.T) {
+	// Arrange
+	tracer, exporter := internal.NewTestTracerWithExporter()
+	start := time.Unix(1700000000, 0)
+	run := eg.WorkflowRun{
+		ID:           eg.Int64(42),
+		Name:         eg.String("ci"),
+		Repository:   &eg.Repository{FullName: eg.String("octo/web")},
+		RunStartedAt: &eg.Timestamp{Time: start},
+		UpdatedAt:    &eg.Timestamp{Time: start.Add(5 * time.Minute)},
+	}
+	jobs := eg.Jobs{TotalCount: eg.Int(1), Jobs: []*eg.WorkflowJob{testJob(1, "completed", start)}}
+	ctx := ContextWithEnricher(context.Background(), func(ctx context.Context, repo string) context.Context {
+		return ContextWithRunAttributes(ctx, attribute.String("enriched.repo", repo))
+	})
+
+	// Act
+	err := TraceWorkflowRun(ctx, run, 42, jobs, tracer)
+
+	// Assert
+	assert.NoError(t, err)
+	roots := 0
+	for _, span := range exporter.GetSpans() {
+		if span.Name == "ci" {
+			roots += 1
+			assert.Contains(t, span.Attributes, attribute.String("enriched.repo", "octo/web"))
+		}
+	}
+	assert.Equal(t, 1, roots)
+}
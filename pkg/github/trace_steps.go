@@ -56,7 +56,10 @@ func TraceJobStep(ctx context.Context, step *eg.TaskStep, tracer trace.Tracer) e
 	attributes := []attribute.KeyValue{
 		attribute.String("step.name", stepName),
 		attribute.Int64("step.number", stepNumber),
+		attribute.String("step.status", step.GetStatus()),
+		attribute.String("step.conclusion", step.GetConclusion()),
 	}
+	attributes = append(attributes, sampleRateAttributes(ctx)...)
 
 	// Start a new span using the workflow run tracer.
 	_, span := tracer.Start(ctx, stepName, trace.WithTimestamp(startTime), trace.WithAttributes(attributes...))
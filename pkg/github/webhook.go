@@ -0,0 +1,41 @@
+package github
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	eg "github.com/google/go-github/v66/github"
+)
+
+// ValidateWebhookSignature reads the payload of the webhook, and checks that it was signed with one
+// of the secrets. Every payload is accepted when there are no secrets.
+func ValidateWebhookSignature(r *http.Request, secrets []string) ([]byte, error) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read webhook payload: %w", err)
+	}
+	if len(secrets) == 0 {
+		return body, nil
+	}
+
+	signature := r.Header.Get(eg.SHA256SignatureHeader)
+	if signature == "" {
+		signature = r.Header.Get(eg.SHA1SignatureHeader)
+	}
+	if signature == "" {
+		return nil, errors.New("webhook payload is not signed")
+	}
+
+	contentType := r.Header.Get("Content-Type")
+	for _, secret := range secrets {
+		payload, err := eg.ValidatePayloadFromBody(contentType, bytes.NewReader(body), signature, []byte(secret))
+		if err == nil {
+			return payload, nil
+		}
+	}
+
+	return nil, errors.New("webhook payload signature does not match any of the secrets")
+}
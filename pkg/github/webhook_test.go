@@ -0,0 +1,76 @@
+package github
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http/httptest"
+	"testing"
+
+	eg "github.com/google/go-github/v66/github"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateWebhookSignature(t *testing.T) {
+	payload := []byte(`{"action": "completed"}`)
+	sign := func(secret string) string {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write(payload)
+		return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	}
+
+	tests := map[string]struct {
+		givenSecrets   []string
+		givenSignature string
+		expectedValid  bool
+	}{
+		"no secrets accepts anything": {
+			givenSecrets:  nil,
+			expectedValid: true,
+		},
+		"signed with the secret": {
+			givenSecrets:   []string{"new"},
+			givenSignature: sign("new"),
+			expectedValid:  true,
+		},
+		"signed with the old secret while rotating": {
+			givenSecrets:   []string{"new", "old"},
+			givenSignature: sign("old"),
+			expectedValid:  true,
+		},
+		"signed with another secret": {
+			givenSecrets:   []string{"new"},
+			givenSignature: sign("other"),
+			expectedValid:  false,
+		},
+		"not signed": {
+			givenSecrets:  []string{"new"},
+			expectedValid: false,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			// Arrange
+			r := httptest.NewRequest("POST", "/webhook", bytes.NewReader(payload))
+			r.Header.Set("Content-Type", "application/json")
+			if test.givenSignature != "" {
+				r.Header.Set(eg.SHA256SignatureHeader, test.givenSignature)
+			}
+
+			// Act
+			body, err := ValidateWebhookSignature(r, test.givenSecrets)
+
+			// Assert
+			if test.expectedValid {
+				assert.NoError(t, err)
+				assert.Equal(t, payload, body)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
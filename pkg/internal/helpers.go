@@ -1,18 +1,27 @@
 package internal
 
 import (
+	myOtel "github.com/pitoniak32/trace-export/pkg/otel"
 	"go.opentelemetry.io/otel/sdk/trace"
 	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 	ot "go.opentelemetry.io/otel/trace"
 )
 
 func NewTestTracer() ot.Tracer {
+	tracer, _ := NewTestTracerWithExporter()
+	return tracer
+}
+
+// NewTestTracerWithExporter returns a tracer along with the exporter holding the spans it ended.
+func NewTestTracerWithExporter() (ot.Tracer, *tracetest.InMemoryExporter) {
+	exporter := tracetest.NewInMemoryExporter()
 	traceProvider := trace.NewTracerProvider(
-		trace.WithSyncer(tracetest.NewInMemoryExporter()),
+		trace.WithIDGenerator(myOtel.NewIDGenerator()),
+		trace.WithSyncer(exporter),
 	)
 	if traceProvider == nil {
 		panic("Failed to create TestTracerProvider!")
 	}
 
-	return traceProvider.Tracer("TESTING_TRACER")
+	return traceProvider.Tracer("TESTING_TRACER"), exporter
 }
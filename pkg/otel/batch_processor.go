@@ -0,0 +1,323 @@
+package otel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// the defaults of the OTEL_BSP_* environment variables, used for the options that are zero
+const (
+	DEFAULT_BATCH_QUEUE_SIZE     = 2048
+	DEFAULT_BATCH_SIZE           = 512
+	DEFAULT_BATCH_EXPORT_TIMEOUT = 30 * time.Second
+	DEFAULT_BATCH_INTERVAL       = 5 * time.Second
+)
+
+// BatchOptions are the settings of the OTEL_BSP_* environment variables.
+type BatchOptions struct {
+	// spans that end while the queue is full are dropped
+	QueueSize int
+	// the most spans that are exported at once
+	BatchSize int
+	// how long an export of a batch may take
+	ExportTimeout time.Duration
+	// how long spans wait in the queue before they are exported
+	Interval time.Duration
+	// export the queue when a root span ends, and wait for it. The spans of a run end before its
+	// root span, so the trace of a run has been handed off when its root span ended. A root span
+	// started with ContextWithFlushResult reports the export of its trace to the result.
+	FlushOnRootEnd bool
+}
+
+// BatchStats counts the spans of a batch processor since it was created.
+type BatchStats struct {
+	// spans waiting to be exported
+	Queued   int    `json:"queued"`
+	Exported uint64 `json:"exported"`
+	// spans that ended while the queue was full
+	Dropped uint64 `json:"dropped"`
+	// spans of batches the exporter returned an error for
+	Failed uint64 `json:"failed"`
+	// the batches the exporter keeps on disk, when it does
+	Buffer *BufferStats `json:"buffer,omitempty"`
+}
+
+// BatchProcessor queues the spans that end and exports them in batches, so ending a span doesn't
+// wait on the exporter. Unlike the processor of the sdk, it counts the spans it drops.
+type BatchProcessor struct {
+	exporter sdktrace.SpanExporter
+	opts     BatchOptions
+
+	queue   chan sdktrace.ReadOnlySpan
+	flushes chan chan error
+	// done is closed when the processor is shut down, stopped when the queue was exported for the
+	// last time
+	done    chan struct{}
+	stopped chan struct{}
+	once    sync.Once
+
+	exported atomic.Uint64
+	dropped  atomic.Uint64
+	failed   atomic.Uint64
+	// the drops that were logged
+	reported atomic.Uint64
+
+	// the results of the traces whose root span started with one, until it ends
+	mu      sync.Mutex
+	results map[trace.TraceID]*FlushResult
+}
+
+type flushResultKey struct{}
+
+// FlushResult collects the errors of handing off the trace of a run, when its root span ends.
+type FlushResult struct {
+	mu  sync.Mutex
+	err error
+}
+
+// ContextWithFlushResult returns a context whose root span reports to the result whether its trace
+// was exported, by the processors that flush when it ends.
+func ContextWithFlushResult(ctx context.Context) (context.Context, *FlushResult) {
+	result := &FlushResult{}
+	return context.WithValue(ctx, flushResultKey{}, result), result
+}
+
+// Err returns the errors of exporting the trace, and of its spans that were dropped.
+func (r *FlushResult) Err() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err
+}
+
+func (r *FlushResult) add(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.err = errors.Join(r.err, err)
+}
+
+var _ sdktrace.SpanProcessor = (*BatchProcessor)(nil)
+
+// NewBatchProcessor starts exporting the spans that end, Shutdown must be called to export the last ones.
+func NewBatchProcessor(exporter sdktrace.SpanExporter, opts BatchOptions) *BatchProcessor {
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = DEFAULT_BATCH_QUEUE_SIZE
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = DEFAULT_BATCH_SIZE
+	}
+	opts.BatchSize = min(opts.BatchSize, opts.QueueSize)
+	if opts.ExportTimeout <= 0 {
+		opts.ExportTimeout = DEFAULT_BATCH_EXPORT_TIMEOUT
+	}
+	if opts.Interval <= 0 {
+		opts.Interval = DEFAULT_BATCH_INTERVAL
+	}
+
+	p := &BatchProcessor{
+		exporter: exporter,
+		opts:     opts,
+		queue:    make(chan sdktrace.ReadOnlySpan, opts.QueueSize),
+		flushes:  make(chan chan error),
+		done:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+		results:  map[trace.TraceID]*FlushResult{},
+	}
+	go p.run()
+	return p
+}
+
+// OnStart keeps the flush result of the context of a root span, to report the export of its trace
+// to when it ends.
+func (p *BatchProcessor) OnStart(ctx context.Context, s sdktrace.ReadWriteSpan) {
+	if !p.opts.FlushOnRootEnd || s.Parent().IsValid() {
+		return
+	}
+	if result, ok := ctx.Value(flushResultKey{}).(*FlushResult); ok {
+		p.mu.Lock()
+		p.results[s.SpanContext().TraceID()] = result
+		p.mu.Unlock()
+	}
+}
+
+func (p *BatchProcessor) OnEnd(s sdktrace.ReadOnlySpan) {
+	if !s.SpanContext().IsSampled() {
+		return
+	}
+
+	isRoot := p.opts.FlushOnRootEnd && !s.Parent().IsValid()
+	result := p.result(s.SpanContext().TraceID(), isRoot)
+
+	select {
+	case <-p.done:
+		p.drop(s, result)
+		return
+	default:
+	}
+	select {
+	case p.queue <- s:
+	default:
+		p.drop(s, result)
+	}
+
+	if isRoot {
+		ctx, cancel := context.WithTimeout(context.Background(), p.opts.ExportTimeout)
+		defer cancel()
+		err := p.ForceFlush(ctx)
+		if err != nil {
+			slog.Error("failed to export the trace of a run", "trace.id", s.SpanContext().TraceID(), "err", err)
+			if result != nil {
+				result.add(err)
+			}
+		}
+		p.reportDropped()
+	}
+}
+
+// result returns the flush result of the trace, if its root span started with one. It is forgotten
+// once the root span ended.
+func (p *BatchProcessor) result(traceID trace.TraceID, isRoot bool) *FlushResult {
+	if !p.opts.FlushOnRootEnd {
+		return nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	result := p.results[traceID]
+	if isRoot {
+		delete(p.results, traceID)
+	}
+	return result
+}
+
+func (p *BatchProcessor) drop(s sdktrace.ReadOnlySpan, result *FlushResult) {
+	p.dropped.Add(1)
+	if result != nil {
+		result.add(fmt.Errorf("the span '%s' was dropped, the export queue was full or shut down", s.Name()))
+	}
+}
+
+// ForceFlush exports the spans that ended before it was called.
+func (p *BatchProcessor) ForceFlush(ctx context.Context) error {
+	result := make(chan error, 1)
+	select {
+	case p.flushes <- result:
+	case <-p.stopped:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	select {
+	case err := <-result:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Shutdown exports the queue and shuts the exporter down.
+func (p *BatchProcessor) Shutdown(ctx context.Context) error {
+	var err error
+	p.once.Do(func() {
+		close(p.done)
+		select {
+		case <-p.stopped:
+		case <-ctx.Done():
+			err = ctx.Err()
+		}
+		p.reportDropped()
+		err = errors.Join(err, p.exporter.Shutdown(ctx))
+	})
+	return err
+}
+
+func (p *BatchProcessor) Stats() BatchStats {
+	stats := BatchStats{
+		Queued:   len(p.queue),
+		Exported: p.exported.Load(),
+		Dropped:  p.dropped.Load(),
+		Failed:   p.failed.Load(),
+	}
+	if buffered, ok := p.exporter.(interface{ BufferStats() BufferStats }); ok {
+		buffer := buffered.BufferStats()
+		stats.Buffer = &buffer
+	}
+	return stats
+}
+
+// reportDropped logs the spans that were dropped since it was last called.
+func (p *BatchProcessor) reportDropped() {
+	dropped := p.dropped.Load()
+	if reported := p.reported.Swap(dropped); dropped > reported {
+		slog.Warn("dropped spans because the export queue was full", "dropped", dropped-reported, "dropped.total", dropped, "queue_size", p.opts.QueueSize)
+	}
+}
+
+func (p *BatchProcessor) run() {
+	defer close(p.stopped)
+
+	ticker := time.NewTicker(p.opts.Interval)
+	defer ticker.Stop()
+
+	batch := make([]sdktrace.ReadOnlySpan, 0, p.opts.BatchSize)
+	for {
+		select {
+		case s := <-p.queue:
+			batch = append(batch, s)
+			if len(batch) >= p.opts.BatchSize {
+				_ = p.export(batch)
+				batch = batch[:0]
+			}
+		case <-ticker.C:
+			_ = p.export(batch)
+			batch = batch[:0]
+		case result := <-p.flushes:
+			result <- p.drain(batch)
+			batch = batch[:0]
+		case <-p.done:
+			_ = p.drain(batch)
+			return
+		}
+	}
+}
+
+// drain exports the batch and the spans in the queue.
+func (p *BatchProcessor) drain(batch []sdktrace.ReadOnlySpan) error {
+	var errs error
+	for {
+		select {
+		case s := <-p.queue:
+			batch = append(batch, s)
+			if len(batch) >= p.opts.BatchSize {
+				errs = errors.Join(errs, p.export(batch))
+				batch = batch[:0]
+			}
+		default:
+			return errors.Join(errs, p.export(batch))
+		}
+	}
+}
+
+func (p *BatchProcessor) export(batch []sdktrace.ReadOnlySpan) error {
+	if len(batch) == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), p.opts.ExportTimeout)
+	defer cancel()
+	err := p.exporter.ExportSpans(ctx, batch)
+	if err != nil {
+		p.failed.Add(uint64(len(batch)))
+		slog.Error("failed to export spans", "spans", len(batch), "err", err)
+		return err
+	}
+	p.exported.Add(uint64(len(batch)))
+	return nil
+}
@@ -0,0 +1,174 @@
+package otel
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// blockingExporter waits for release in its first export.
+type blockingExporter struct {
+	*tracetest.InMemoryExporter
+	exporting chan struct{}
+	release   chan struct{}
+}
+
+func (e *blockingExporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	select {
+	case e.exporting <- struct{}{}:
+		<-e.release
+	default:
+	}
+	return e.InMemoryExporter.ExportSpans(ctx, spans)
+}
+
+func TestBatchProcessorFlushesOnRootEnd(t *testing.T) {
+	// Arrange
+	exporter := tracetest.NewInMemoryExporter()
+	processor := NewBatchProcessor(exporter, BatchOptions{Interval: time.Hour, FlushOnRootEnd: true})
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(processor))
+	tracer := provider.Tracer("test")
+
+	ctx, run := tracer.Start(context.Background(), "run")
+	_, job := tracer.Start(ctx, "job")
+	job.End()
+	exportedBeforeRoot := len(exporter.GetSpans())
+
+	// Act
+	run.End()
+
+	// Assert
+	assert.Equal(t, 0, exportedBeforeRoot, "the spans should be queued until the run ends")
+	assert.Len(t, exporter.GetSpans(), 2)
+	assert.Equal(t, BatchStats{Exported: 2}, processor.Stats())
+	assert.NoError(t, provider.Shutdown(context.Background()))
+}
+
+func TestBatchProcessorDropsWhenQueueIsFull(t *testing.T) {
+	// Arrange
+	exporter := &blockingExporter{
+		InMemoryExporter: tracetest.NewInMemoryExporter(),
+		exporting:        make(chan struct{}),
+		release:          make(chan struct{}),
+	}
+	processor := NewBatchProcessor(exporter, BatchOptions{QueueSize: 1, BatchSize: 1, Interval: time.Hour})
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(processor))
+	tracer := provider.Tracer("test")
+
+	// Act
+	_, first := tracer.Start(context.Background(), "first")
+	first.End()
+	<-exporter.exporting
+	for _, name := range []string{"queued", "dropped"} {
+		_, span := tracer.Start(context.Background(), name)
+		span.End()
+	}
+	stats := processor.Stats()
+	close(exporter.release)
+	err := provider.Shutdown(context.Background())
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, BatchStats{Queued: 1, Dropped: 1}, stats)
+	assert.Equal(t, BatchStats{Exported: 2, Dropped: 1}, processor.Stats())
+}
+
+// failingExporter fails every export.
+type failingExporter struct{}
+
+func (failingExporter) ExportSpans(context.Context, []sdktrace.ReadOnlySpan) error {
+	return errors.New("collector unavailable")
+}
+
+func (failingExporter) Shutdown(context.Context) error { return nil }
+
+func TestBatchProcessorReportsTheFlushOfTheTrace(t *testing.T) {
+	tests := map[string]struct {
+		exporter    sdktrace.SpanExporter
+		expectedErr string
+	}{
+		"exported": {
+			exporter: tracetest.NewInMemoryExporter(),
+		},
+		"failed export": {
+			exporter:    failingExporter{},
+			expectedErr: "collector unavailable",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			// Arrange
+			processor := NewBatchProcessor(test.exporter, BatchOptions{Interval: time.Hour, FlushOnRootEnd: true})
+			provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(processor))
+			tracer := provider.Tracer("test")
+
+			// Act
+			ctx, result := ContextWithFlushResult(context.Background())
+			ctx, run := tracer.Start(ctx, "run")
+			_, job := tracer.Start(ctx, "job")
+			job.End()
+			run.End()
+
+			// Assert
+			if test.expectedErr == "" {
+				assert.NoError(t, result.Err())
+			} else {
+				assert.EqualError(t, result.Err(), test.expectedErr)
+			}
+			assert.NoError(t, provider.Shutdown(context.Background()))
+		})
+	}
+}
+
+func TestBatchProcessorReportsTheDroppedSpansOfTheTrace(t *testing.T) {
+	// Arrange
+	exporter := &blockingExporter{
+		InMemoryExporter: tracetest.NewInMemoryExporter(),
+		exporting:        make(chan struct{}),
+		release:          make(chan struct{}),
+	}
+	processor := NewBatchProcessor(exporter, BatchOptions{QueueSize: 1, BatchSize: 1, ExportTimeout: 10 * time.Millisecond, Interval: time.Hour, FlushOnRootEnd: true})
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(processor))
+	tracer := provider.Tracer("test")
+
+	// Act
+	ctx, result := ContextWithFlushResult(context.Background())
+	ctx, run := tracer.Start(ctx, "run")
+	_, exporting := tracer.Start(ctx, "exporting")
+	exporting.End()
+	<-exporter.exporting
+	_, queued := tracer.Start(ctx, "queued")
+	queued.End()
+	run.End()
+	err := result.Err()
+	close(exporter.release)
+
+	// Assert
+	assert.ErrorContains(t, err, "the span 'run' was dropped, the export queue was full or shut down")
+	assert.NoError(t, provider.Shutdown(context.Background()))
+}
+
+func TestRouterReportsTheFlushOfTheTrace(t *testing.T) {
+	// Arrange
+	processor := NewBatchProcessor(failingExporter{}, BatchOptions{Interval: time.Hour, FlushOnRootEnd: true})
+	router, err := NewRouter(map[string]*BatchProcessor{"default": processor}, nil)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(router))
+
+	// Act
+	ctx, result := ContextWithFlushResult(context.Background())
+	_, run := provider.Tracer("test").Start(ctx, "run")
+	run.End()
+
+	// Assert
+	assert.EqualError(t, result.Err(), "collector unavailable")
+	assert.NoError(t, provider.Shutdown(context.Background()))
+}
@@ -0,0 +1,177 @@
+package otel
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.27.0"
+	ot "go.opentelemetry.io/otel/trace"
+)
+
+// how the spans are split into files
+const (
+	// a file per trace, so every attempt of a workflow run gets its own file
+	FILE_SPLIT_RUN = "run"
+	// a file per MaxBytes of spans
+	FILE_SPLIT_SIZE = "size"
+)
+
+// FileExporter writes the spans as OTLP/JSON lines, which the collector's otlpjsonfile receiver
+// can read. Every export is a line with the spans of one ExportTraceServiceRequest.
+type FileExporter struct {
+	dir string
+	// the files are named after the service, so the spans of both tracer providers can share a directory
+	prefix   string
+	split    string
+	maxBytes int64
+
+	mu      sync.Mutex
+	file    *os.File
+	written int64
+	closed  bool
+}
+
+var _ sdktrace.SpanExporter = (*FileExporter)(nil)
+
+// NewFileExporter creates the directory if needed. A zero maxBytes doesn't rotate the files when
+// they are split by size.
+func NewFileExporter(dir string, prefix string, split string, maxBytes int64) (*FileExporter, error) {
+	if split != FILE_SPLIT_RUN && split != FILE_SPLIT_SIZE {
+		return nil, fmt.Errorf("unknown file split '%s', expected %s or %s", split, FILE_SPLIT_RUN, FILE_SPLIT_SIZE)
+	}
+
+	err := os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create trace file directory '%s': %w", dir, err)
+	}
+
+	return &FileExporter{dir: dir, prefix: prefix, split: split, maxBytes: maxBytes}, nil
+}
+
+func (e *FileExporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	if len(spans) == 0 {
+		return nil
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.closed {
+		return errors.New("file exporter is shut down")
+	}
+
+	if e.split == FILE_SPLIT_SIZE {
+		return e.writeRotated(spans)
+	}
+
+	// spans of a run can be exported at different times (in live mode), so its file is appended to
+	var errs error
+	for _, traceSpans := range groupByTrace(spans) {
+		name := filepath.Join(e.dir, fmt.Sprintf("%s-%s.jsonl", e.prefix, traceSpans[0].SpanContext().TraceID()))
+		errs = errors.Join(errs, appendLine(name, traceSpans))
+	}
+	return errs
+}
+
+func (e *FileExporter) Shutdown(ctx context.Context) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.closed = true
+	if e.file == nil {
+		return nil
+	}
+	err := e.file.Close()
+	e.file = nil
+	return err
+}
+
+// writeRotated must be called with the lock held.
+func (e *FileExporter) writeRotated(spans []sdktrace.ReadOnlySpan) error {
+	line, err := encodeLine(spans)
+	if err != nil {
+		return err
+	}
+
+	if e.file != nil && e.maxBytes > 0 && e.written >= e.maxBytes {
+		err = e.file.Close()
+		e.file = nil
+		if err != nil {
+			return fmt.Errorf("failed to close trace file: %w", err)
+		}
+	}
+	if e.file == nil {
+		name := fmt.Sprintf("%s-%s.jsonl", e.prefix, time.Now().UTC().Format("20060102T150405.000000000Z"))
+		e.file, err = os.OpenFile(filepath.Join(e.dir, name), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+		if err != nil {
+			return fmt.Errorf("failed to create trace file: %w", err)
+		}
+		e.written = 0
+	}
+
+	n, err := e.file.Write(line)
+	e.written += int64(n)
+	if err != nil {
+		return fmt.Errorf("failed to write spans to '%s': %w", e.file.Name(), err)
+	}
+	return nil
+}
+
+func appendLine(name string, spans []sdktrace.ReadOnlySpan) error {
+	line, err := encodeLine(spans)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(name, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open trace file: %w", err)
+	}
+	_, err = file.Write(line)
+	err = errors.Join(err, file.Close())
+	if err != nil {
+		return fmt.Errorf("failed to write spans to '%s': %w", name, err)
+	}
+	return nil
+}
+
+func encodeLine(spans []sdktrace.ReadOnlySpan) ([]byte, error) {
+	line, err := json.Marshal(newOTLPTraces(spans))
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode spans: %w", err)
+	}
+	return append(line, '\n'), nil
+}
+
+// groupByTrace keeps the order of the traces and of the spans within them.
+func groupByTrace(spans []sdktrace.ReadOnlySpan) [][]sdktrace.ReadOnlySpan {
+	var groups [][]sdktrace.ReadOnlySpan
+	index := map[ot.TraceID]int{}
+	for _, span := range spans {
+		traceID := span.SpanContext().TraceID()
+		i, ok := index[traceID]
+		if !ok {
+			i = len(groups)
+			index[traceID] = i
+			groups = append(groups, nil)
+		}
+		groups[i] = append(groups[i], span)
+	}
+	return groups
+}
+
+// serviceName is the service.name of the resource, which the files of its spans are named after.
+func serviceName(res resource.Resource) string {
+	if value, ok := res.Set().Value(semconv.ServiceNameKey); ok && value.AsString() != "" {
+		return value.AsString()
+	}
+	return "traces"
+}
@@ -0,0 +1,117 @@
+package otel
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.27.0"
+	ot "go.opentelemetry.io/otel/trace"
+)
+
+func newFileTracerProvider(t *testing.T, dir string, split string, maxBytes int64) *sdktrace.TracerProvider {
+	exporter, err := NewFileExporter(dir, "trace-workflow-run", split, maxBytes)
+	assert.NoError(t, err)
+	return sdktrace.NewTracerProvider(
+		sdktrace.WithSyncer(exporter),
+		sdktrace.WithIDGenerator(NewIDGenerator()),
+		sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceName("trace-workflow-run"))),
+	)
+}
+
+func readLines(t *testing.T, name string) []otlpTraces {
+	file, err := os.Open(name)
+	assert.NoError(t, err)
+	defer file.Close()
+
+	var lines []otlpTraces
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var line otlpTraces
+		assert.NoError(t, json.Unmarshal(scanner.Bytes(), &line))
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func TestFileExporterSplitsByRun(t *testing.T) {
+	// Arrange
+	dir := t.TempDir()
+	provider := newFileTracerProvider(t, dir, FILE_SPLIT_RUN, 0)
+	tracer := provider.Tracer("test")
+	traceID := ot.TraceID{1, 2, 3}
+	start := time.Unix(1700000000, 0)
+
+	// Act
+	ctx, root := tracer.Start(ContextWithRootIDs(context.Background(), traceID, ot.SpanID{}), "ci", ot.WithTimestamp(start))
+	_, job := tracer.Start(ctx, "build", ot.WithTimestamp(start.Add(time.Second)), ot.WithAttributes(
+		attribute.Int64("workflow_job.id", 7),
+		attribute.StringSlice("labels", []string{"ubuntu-latest"}),
+	))
+	job.SetStatus(codes.Error, "failed")
+	job.End(ot.WithTimestamp(start.Add(2 * time.Second)))
+	root.End(ot.WithTimestamp(start.Add(3 * time.Second)))
+	_, other := tracer.Start(context.Background(), "other")
+	other.End()
+	assert.NoError(t, provider.Shutdown(context.Background()))
+
+	// Assert
+	files, _ := filepath.Glob(filepath.Join(dir, "*.jsonl"))
+	assert.Equal(t, 2, len(files), "every trace should get its own file")
+
+	lines := readLines(t, filepath.Join(dir, "trace-workflow-run-"+traceID.String()+".jsonl"))
+	assert.Equal(t, 2, len(lines), "every export should be appended as a line")
+
+	resourceSpans := lines[0].ResourceSpans[0]
+	assert.Equal(t, "service.name", resourceSpans.Resource.Attributes[0].Key)
+	assert.Equal(t, "test", resourceSpans.ScopeSpans[0].Scope.Name)
+
+	span := resourceSpans.ScopeSpans[0].Spans[0]
+	assert.Equal(t, "build", span.Name)
+	assert.Equal(t, traceID.String(), span.TraceID)
+	assert.Equal(t, "1700000001000000000", span.StartTimeUnixNano)
+	assert.Equal(t, otlpStatus{Message: "failed", Code: 2}, span.Status)
+	assert.Equal(t, "7", *span.Attributes[0].Value.IntValue)
+	assert.Equal(t, "ubuntu-latest", *span.Attributes[1].Value.ArrayValue.Values[0].StringValue)
+
+	rootSpan := lines[1].ResourceSpans[0].ScopeSpans[0].Spans[0]
+	assert.Equal(t, "ci", rootSpan.Name)
+	assert.Equal(t, rootSpan.SpanID, span.ParentSpanID)
+	assert.Equal(t, "", rootSpan.ParentSpanID)
+}
+
+func TestFileExporterSplitsBySize(t *testing.T) {
+	// Arrange
+	dir := t.TempDir()
+	provider := newFileTracerProvider(t, dir, FILE_SPLIT_SIZE, 1)
+	tracer := provider.Tracer("test")
+
+	// Act
+	for _, name := range []string{"first", "second"} {
+		_, span := tracer.Start(context.Background(), name)
+		span.End()
+	}
+	assert.NoError(t, provider.Shutdown(context.Background()))
+
+	// Assert
+	files, _ := filepath.Glob(filepath.Join(dir, "trace-workflow-run-*.jsonl"))
+	assert.Equal(t, 2, len(files), "a new file should be started once the limit is reached")
+	assert.Equal(t, "first", readLines(t, files[0])[0].ResourceSpans[0].ScopeSpans[0].Spans[0].Name)
+}
+
+func TestNewFileExporterRejectsUnknownSplit(t *testing.T) {
+	// Act
+	_, err := NewFileExporter(t.TempDir(), "traces", "day", 0)
+
+	// Assert
+	assert.EqualError(t, err, "unknown file split 'day', expected run or size")
+}
@@ -0,0 +1,65 @@
+package otel
+
+import (
+	"context"
+	"encoding/binary"
+	"math/rand/v2"
+
+	ot "go.opentelemetry.io/otel/trace"
+)
+
+type rootIDsKey struct{}
+
+type rootIDs struct {
+	traceID ot.TraceID
+	spanID  ot.SpanID
+}
+
+// ContextWithRootIDs returns a context that makes the next root span started from it use the given
+// trace and span ids. This lets spans of the same workflow run that are exported at different
+// times (and from different webhook deliveries) end up in one trace.
+func ContextWithRootIDs(ctx context.Context, traceID ot.TraceID, spanID ot.SpanID) context.Context {
+	return context.WithValue(ctx, rootIDsKey{}, rootIDs{traceID: traceID, spanID: spanID})
+}
+
+// IDGenerator generates random ids unless the ids of a root span were set with ContextWithRootIDs.
+type IDGenerator struct{}
+
+func NewIDGenerator() *IDGenerator {
+	return &IDGenerator{}
+}
+
+func (g *IDGenerator) NewIDs(ctx context.Context) (ot.TraceID, ot.SpanID) {
+	if ids, ok := ctx.Value(rootIDsKey{}).(rootIDs); ok && ids.traceID.IsValid() {
+		spanID := ids.spanID
+		if !spanID.IsValid() {
+			spanID = randomSpanID()
+		}
+		return ids.traceID, spanID
+	}
+
+	return randomTraceID(), randomSpanID()
+}
+
+// NewSpanID is only used for spans with a parent, those always get a random id because the context
+// holding the root ids is passed on to the children of the root span.
+func (g *IDGenerator) NewSpanID(_ context.Context, _ ot.TraceID) ot.SpanID {
+	return randomSpanID()
+}
+
+func randomTraceID() ot.TraceID {
+	var id ot.TraceID
+	for !id.IsValid() {
+		binary.NativeEndian.PutUint64(id[:8], rand.Uint64())
+		binary.NativeEndian.PutUint64(id[8:], rand.Uint64())
+	}
+	return id
+}
+
+func randomSpanID() ot.SpanID {
+	var id ot.SpanID
+	for !id.IsValid() {
+		binary.NativeEndian.PutUint64(id[:], rand.Uint64())
+	}
+	return id
+}
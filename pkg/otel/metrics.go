@@ -0,0 +1,138 @@
+package otel
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	"go.opentelemetry.io/otel/metric"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/resource"
+	"google.golang.org/grpc/credentials"
+)
+
+// the path the http/protobuf protocol appends to the endpoint for metrics
+const otlpMetricsPath = "/v1/metrics"
+
+// NewMeterProvider exports the metrics of the service to the OTLP endpoint, at the interval of
+// OTEL_METRIC_EXPORT_INTERVAL (a minute by default).
+func NewMeterProvider(ctx context.Context, opts OTLPOptions, res resource.Resource) (*sdkmetric.MeterProvider, error) {
+	exporter, err := newOTLPMetricExporter(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	return sdkmetric.NewMeterProvider(
+		sdkmetric.WithResource(&res),
+		sdkmetric.WithReader(sdkmetric.NewPeriodicReader(exporter)),
+	), nil
+}
+
+// newOTLPMetricExporter creates the exporter of the protocol, with the same settings as the spans.
+func newOTLPMetricExporter(ctx context.Context, opts OTLPOptions) (sdkmetric.Exporter, error) {
+	endpoint, err := opts.endpointURL()
+	if err != nil {
+		return nil, err
+	}
+
+	var tlsConfig *tls.Config
+	if endpoint.Scheme == "https" {
+		tlsConfig, err = opts.tlsConfig()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var exporter sdkmetric.Exporter
+	switch opts.Protocol {
+	case OTLP_PROTOCOL_GRPC, "":
+		options := []otlpmetricgrpc.Option{otlpmetricgrpc.WithEndpointURL(endpoint.String())}
+		if tlsConfig != nil {
+			options = append(options, otlpmetricgrpc.WithTLSCredentials(credentials.NewTLS(tlsConfig)))
+		}
+		if len(opts.Headers) > 0 {
+			options = append(options, otlpmetricgrpc.WithHeaders(opts.Headers))
+		}
+		if opts.Timeout > 0 {
+			options = append(options, otlpmetricgrpc.WithTimeout(opts.Timeout))
+		}
+		if opts.Compression == "gzip" {
+			options = append(options, otlpmetricgrpc.WithCompressor("gzip"))
+		}
+		exporter, err = otlpmetricgrpc.New(ctx, options...)
+
+	case OTLP_PROTOCOL_HTTP:
+		endpoint.Path = strings.TrimSuffix(endpoint.Path, "/") + otlpMetricsPath
+		options := []otlpmetrichttp.Option{otlpmetrichttp.WithEndpointURL(endpoint.String())}
+		if tlsConfig != nil {
+			options = append(options, otlpmetrichttp.WithTLSClientConfig(tlsConfig))
+		}
+		if len(opts.Headers) > 0 {
+			options = append(options, otlpmetrichttp.WithHeaders(opts.Headers))
+		}
+		if opts.Timeout > 0 {
+			options = append(options, otlpmetrichttp.WithTimeout(opts.Timeout))
+		}
+		if opts.Compression == "gzip" {
+			options = append(options, otlpmetrichttp.WithCompression(otlpmetrichttp.GzipCompression))
+		} else {
+			options = append(options, otlpmetrichttp.WithCompression(otlpmetrichttp.NoCompression))
+		}
+		exporter, err = otlpmetrichttp.New(ctx, options...)
+
+	default:
+		return nil, fmt.Errorf("unknown OTLP protocol '%s', expected %s or %s", opts.Protocol, OTLP_PROTOCOL_GRPC, OTLP_PROTOCOL_HTTP)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s OTLP metric exporter: %w", opts.Protocol, err)
+	}
+	return exporter, nil
+}
+
+// registerBufferMetrics observes the stats of the buffer with the global meter provider, named by
+// the destination of the buffer.
+func registerBufferMetrics(b *bufferClient) (metric.Registration, error) {
+	meter := otel.Meter(SERVICE_TRACER_NAME)
+
+	batches, err := meter.Int64ObservableGauge("trace_export.buffer.batches", metric.WithUnit("{batch}"), metric.WithDescription("The batches that wait in the export buffer to be exported again."))
+	if err != nil {
+		return nil, err
+	}
+	size, err := meter.Int64ObservableGauge("trace_export.buffer.size", metric.WithUnit("By"), metric.WithDescription("The size of the batches in the export buffer."))
+	if err != nil {
+		return nil, err
+	}
+	oldestAge, err := meter.Float64ObservableGauge("trace_export.buffer.oldest_age", metric.WithUnit("s"), metric.WithDescription("How long the oldest batch of the export buffer has been waiting."))
+	if err != nil {
+		return nil, err
+	}
+	replayed, err := meter.Int64ObservableCounter("trace_export.buffer.replayed", metric.WithUnit("{batch}"), metric.WithDescription("The batches of the export buffer that were exported."))
+	if err != nil {
+		return nil, err
+	}
+	dropped, err := meter.Int64ObservableCounter("trace_export.buffer.dropped", metric.WithUnit("{batch}"), metric.WithDescription("The batches dropped because the export buffer was full or they were too old."))
+	if err != nil {
+		return nil, err
+	}
+	rejected, err := meter.Int64ObservableCounter("trace_export.buffer.rejected", metric.WithUnit("{batch}"), metric.WithDescription("The batches the collector rejected for good, which aren't kept."))
+	if err != nil {
+		return nil, err
+	}
+
+	destination := metric.WithAttributes(attribute.String("destination", b.opts.destination))
+	return meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		stats := b.Stats()
+		o.ObserveInt64(batches, int64(stats.Batches), destination)
+		o.ObserveInt64(size, stats.Bytes, destination)
+		o.ObserveFloat64(oldestAge, (time.Duration(stats.OldestAgeMs) * time.Millisecond).Seconds(), destination)
+		o.ObserveInt64(replayed, int64(stats.Replayed), destination)
+		o.ObserveInt64(dropped, int64(stats.Dropped), destination)
+		o.ObserveInt64(rejected, int64(stats.Rejected), destination)
+		return nil
+	}, batches, size, oldestAge, replayed, dropped, rejected)
+}
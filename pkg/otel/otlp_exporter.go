@@ -0,0 +1,168 @@
+package otel
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"google.golang.org/grpc/credentials"
+)
+
+// the values of OTEL_EXPORTER_OTLP_PROTOCOL that are supported
+const (
+	OTLP_PROTOCOL_GRPC = "grpc"
+	OTLP_PROTOCOL_HTTP = "http/protobuf"
+)
+
+// the path the http/protobuf protocol appends to the endpoint
+const otlpTracesPath = "/v1/traces"
+
+// OTLPOptions are the settings of the OTEL_EXPORTER_OTLP_* environment variables. Everything is
+// set explicitly, the signal specific variables (like OTEL_EXPORTER_OTLP_TRACES_HEADERS) are only
+// used by the exporters for what isn't.
+type OTLPOptions struct {
+	// 'host:port', or a url where 'http://' doesn't use TLS
+	Endpoint string
+	// OTLP_PROTOCOL_GRPC or OTLP_PROTOCOL_HTTP
+	Protocol string
+	Headers  map[string]string
+	// the exporter's default is used when zero
+	Timeout time.Duration
+	// PEM file of the CAs that verify the collector, instead of the system ones
+	Certificate string
+	// PEM files of the client certificate and its key, for mTLS
+	ClientCertificate string
+	ClientKey         string
+	// the name the certificate of the collector is verified against, instead of its host
+	ServerName string
+	// gzip or none
+	Compression string
+	// don't use TLS for an endpoint without a scheme
+	Insecure bool
+}
+
+// NewOTLPExporter creates the exporter of the protocol.
+func NewOTLPExporter(ctx context.Context, opts OTLPOptions) (sdktrace.SpanExporter, error) {
+	client, err := newOTLPClient(opts)
+	if err != nil {
+		return nil, err
+	}
+	exporter, err := otlptrace.New(ctx, client)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s OTLP trace exporter: %w", opts.Protocol, err)
+	}
+	return exporter, nil
+}
+
+// newOTLPClient creates the client that uploads the spans with the protocol.
+func newOTLPClient(opts OTLPOptions) (otlptrace.Client, error) {
+	endpoint, err := opts.endpointURL()
+	if err != nil {
+		return nil, err
+	}
+
+	var tlsConfig *tls.Config
+	if endpoint.Scheme == "https" {
+		tlsConfig, err = opts.tlsConfig()
+		if err != nil {
+			return nil, err
+		}
+	} else if opts.Certificate != "" || opts.ClientCertificate != "" || opts.ServerName != "" {
+		return nil, fmt.Errorf("the OTLP endpoint '%s' doesn't use TLS, but certificates or a server name are configured. Use an https url, or turn off insecure", opts.Endpoint)
+	}
+
+	switch opts.Protocol {
+	case OTLP_PROTOCOL_GRPC, "":
+		// the path doesn't matter for grpc, the url only sets the host and whether TLS is used
+		options := []otlptracegrpc.Option{otlptracegrpc.WithEndpointURL(endpoint.String())}
+		if tlsConfig != nil {
+			options = append(options, otlptracegrpc.WithTLSCredentials(credentials.NewTLS(tlsConfig)))
+		}
+		if len(opts.Headers) > 0 {
+			options = append(options, otlptracegrpc.WithHeaders(opts.Headers))
+		}
+		if opts.Timeout > 0 {
+			options = append(options, otlptracegrpc.WithTimeout(opts.Timeout))
+		}
+		if opts.Compression == "gzip" {
+			options = append(options, otlptracegrpc.WithCompressor("gzip"))
+		}
+
+		return otlptracegrpc.NewClient(options...), nil
+
+	case OTLP_PROTOCOL_HTTP:
+		endpoint.Path = strings.TrimSuffix(endpoint.Path, "/") + otlpTracesPath
+		options := []otlptracehttp.Option{otlptracehttp.WithEndpointURL(endpoint.String())}
+		if tlsConfig != nil {
+			options = append(options, otlptracehttp.WithTLSClientConfig(tlsConfig))
+		}
+		if len(opts.Headers) > 0 {
+			options = append(options, otlptracehttp.WithHeaders(opts.Headers))
+		}
+		if opts.Timeout > 0 {
+			options = append(options, otlptracehttp.WithTimeout(opts.Timeout))
+		}
+		if opts.Compression == "gzip" {
+			options = append(options, otlptracehttp.WithCompression(otlptracehttp.GzipCompression))
+		} else {
+			options = append(options, otlptracehttp.WithCompression(otlptracehttp.NoCompression))
+		}
+
+		return otlptracehttp.NewClient(options...), nil
+
+	default:
+		return nil, fmt.Errorf("unknown OTLP protocol '%s', expected %s or %s", opts.Protocol, OTLP_PROTOCOL_GRPC, OTLP_PROTOCOL_HTTP)
+	}
+}
+
+// endpointURL returns the endpoint as a url, an endpoint without a scheme uses TLS unless it is
+// insecure.
+func (o OTLPOptions) endpointURL() (*url.URL, error) {
+	if !strings.Contains(o.Endpoint, "://") {
+		scheme := "https"
+		if o.Insecure {
+			scheme = "http"
+		}
+		return &url.URL{Scheme: scheme, Host: o.Endpoint}, nil
+	}
+
+	u, err := url.Parse(o.Endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid OTLP endpoint '%s': %w", o.Endpoint, err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid OTLP endpoint '%s', expecting 'host:port' or an http or https url", o.Endpoint)
+	}
+	return u, nil
+}
+
+// tlsConfig verifies the collector with the system CAs, or the ones in the certificate file, and
+// presents the client certificate when there is one. The files are read again when they change.
+func (o OTLPOptions) tlsConfig() (*tls.Config, error) {
+	config := &tls.Config{MinVersion: tls.VersionTLS12, ServerName: o.ServerName}
+	if o.Certificate == "" && o.ClientCertificate == "" && o.ClientKey == "" {
+		return config, nil
+	}
+
+	serverName := o.ServerName
+	if serverName == "" {
+		endpoint, err := o.endpointURL()
+		if err != nil {
+			return nil, err
+		}
+		serverName = endpoint.Hostname()
+	}
+	files, err := newCertFiles(o.ClientCertificate, o.ClientKey, o.Certificate, serverName)
+	if err != nil {
+		return nil, err
+	}
+	files.apply(config)
+	return config, nil
+}
@@ -0,0 +1,97 @@
+package otel
+
+import (
+	"compress/gzip"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+func TestEndpointURL(t *testing.T) {
+	tests := map[string]struct {
+		givenOptions  OTLPOptions
+		expectedURL   string
+		expectedError string
+	}{
+		"host and port": {
+			givenOptions: OTLPOptions{Endpoint: "collector:4317"},
+			expectedURL:  "https://collector:4317",
+		},
+		"insecure host and port": {
+			givenOptions: OTLPOptions{Endpoint: "localhost:4317", Insecure: true},
+			expectedURL:  "http://localhost:4317",
+		},
+		"url ignores insecure": {
+			givenOptions: OTLPOptions{Endpoint: "https://api.honeycomb.io", Insecure: true},
+			expectedURL:  "https://api.honeycomb.io",
+		},
+		"unknown scheme": {
+			givenOptions:  OTLPOptions{Endpoint: "ftp://collector"},
+			expectedError: "invalid OTLP endpoint 'ftp://collector', expecting 'host:port' or an http or https url",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			// Act
+			u, err := test.givenOptions.endpointURL()
+
+			// Assert
+			if test.expectedError == "" {
+				assert.NoError(t, err)
+				assert.Equal(t, test.expectedURL, u.String())
+			} else {
+				assert.EqualError(t, err, test.expectedError)
+			}
+		})
+	}
+}
+
+func TestNewOTLPExporterHTTP(t *testing.T) {
+	// Arrange
+	type request struct {
+		path     string
+		header   string
+		encoding string
+		body     []byte
+	}
+	requests := make(chan request, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gz, err := gzip.NewReader(r.Body)
+		assert.NoError(t, err)
+		body, _ := io.ReadAll(gz)
+		requests <- request{path: r.URL.Path, header: r.Header.Get("X-Api-Key"), encoding: r.Header.Get("Content-Encoding"), body: body}
+	}))
+	defer server.Close()
+
+	exporter, err := NewOTLPExporter(context.Background(), OTLPOptions{
+		Endpoint:    server.URL + "/otlp/",
+		Protocol:    OTLP_PROTOCOL_HTTP,
+		Headers:     map[string]string{"X-Api-Key": "secret"},
+		Timeout:     5 * time.Second,
+		Compression: "gzip",
+	})
+	assert.NoError(t, err)
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter), sdktrace.WithResource(resource.Empty()))
+
+	// Act
+	_, span := provider.Tracer("test").Start(context.Background(), "build")
+	span.End()
+	assert.NoError(t, provider.Shutdown(context.Background()))
+
+	// Assert
+	req := <-requests
+	assert.Equal(t, "/otlp/v1/traces", req.path, "the traces path should be appended to the endpoint")
+	assert.Equal(t, "secret", req.header)
+	assert.Equal(t, "gzip", req.encoding)
+	assert.Contains(t, string(req.body), "build")
+}
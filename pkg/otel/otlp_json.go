@@ -0,0 +1,255 @@
+package otel
+
+import (
+	"strconv"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/instrumentation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	ot "go.opentelemetry.io/otel/trace"
+)
+
+// The OTLP/JSON encoding of spans, as written by the collector's file exporter and read by its
+// otlpjsonfile receiver. Unlike the protobuf JSON mapping, ids are hex encoded. 64 bit integers are
+// strings and enums are numbers, like the protobuf JSON mapping.
+
+type otlpTraces struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+	SchemaURL  string           `json:"schemaUrl,omitempty"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes,omitempty"`
+}
+
+type otlpScopeSpans struct {
+	Scope     otlpScope  `json:"scope"`
+	Spans     []otlpSpan `json:"spans"`
+	SchemaURL string     `json:"schemaUrl,omitempty"`
+}
+
+type otlpScope struct {
+	Name    string `json:"name,omitempty"`
+	Version string `json:"version,omitempty"`
+}
+
+type otlpSpan struct {
+	TraceID                string         `json:"traceId"`
+	SpanID                 string         `json:"spanId"`
+	TraceState             string         `json:"traceState,omitempty"`
+	ParentSpanID           string         `json:"parentSpanId,omitempty"`
+	Flags                  uint32         `json:"flags,omitempty"`
+	Name                   string         `json:"name"`
+	Kind                   int            `json:"kind"`
+	StartTimeUnixNano      string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano        string         `json:"endTimeUnixNano"`
+	Attributes             []otlpKeyValue `json:"attributes,omitempty"`
+	DroppedAttributesCount int            `json:"droppedAttributesCount,omitempty"`
+	Events                 []otlpEvent    `json:"events,omitempty"`
+	DroppedEventsCount     int            `json:"droppedEventsCount,omitempty"`
+	Links                  []otlpLink     `json:"links,omitempty"`
+	DroppedLinksCount      int            `json:"droppedLinksCount,omitempty"`
+	Status                 otlpStatus     `json:"status"`
+}
+
+type otlpEvent struct {
+	TimeUnixNano           string         `json:"timeUnixNano"`
+	Name                   string         `json:"name"`
+	Attributes             []otlpKeyValue `json:"attributes,omitempty"`
+	DroppedAttributesCount int            `json:"droppedAttributesCount,omitempty"`
+}
+
+type otlpLink struct {
+	TraceID                string         `json:"traceId"`
+	SpanID                 string         `json:"spanId"`
+	TraceState             string         `json:"traceState,omitempty"`
+	Attributes             []otlpKeyValue `json:"attributes,omitempty"`
+	DroppedAttributesCount int            `json:"droppedAttributesCount,omitempty"`
+	Flags                  uint32         `json:"flags,omitempty"`
+}
+
+type otlpStatus struct {
+	Message string `json:"message,omitempty"`
+	Code    int    `json:"code,omitempty"`
+}
+
+type otlpKeyValue struct {
+	Key   string       `json:"key"`
+	Value otlpAnyValue `json:"value"`
+}
+
+type otlpAnyValue struct {
+	StringValue *string         `json:"stringValue,omitempty"`
+	BoolValue   *bool           `json:"boolValue,omitempty"`
+	IntValue    *string         `json:"intValue,omitempty"`
+	DoubleValue *float64        `json:"doubleValue,omitempty"`
+	ArrayValue  *otlpArrayValue `json:"arrayValue,omitempty"`
+}
+
+type otlpArrayValue struct {
+	Values []otlpAnyValue `json:"values"`
+}
+
+// the span flags that hold the trace flags, and whether the parent (or linked span) is remote
+const (
+	otlpFlagsHasIsRemote = 0x100
+	otlpFlagsIsRemote    = 0x200
+)
+
+// newOTLPTraces groups the spans by their resource and instrumentation scope, keeping the order of
+// the spans within a group.
+func newOTLPTraces(spans []sdktrace.ReadOnlySpan) otlpTraces {
+	type scopeKey struct {
+		resource attribute.Distinct
+		scope    instrumentation.Scope
+	}
+
+	traces := otlpTraces{}
+	resources := map[attribute.Distinct]int{}
+	scopes := map[scopeKey]int{}
+	for _, span := range spans {
+		res := span.Resource()
+		if res == nil {
+			res = resource.Empty()
+		}
+
+		r, ok := resources[res.Equivalent()]
+		if !ok {
+			r = len(traces.ResourceSpans)
+			resources[res.Equivalent()] = r
+			traces.ResourceSpans = append(traces.ResourceSpans, otlpResourceSpans{
+				Resource:  otlpResource{Attributes: otlpAttributes(res.Attributes())},
+				SchemaURL: res.SchemaURL(),
+			})
+		}
+		resourceSpans := &traces.ResourceSpans[r]
+
+		scope := span.InstrumentationScope()
+		key := scopeKey{resource: res.Equivalent(), scope: scope}
+		s, ok := scopes[key]
+		if !ok {
+			s = len(resourceSpans.ScopeSpans)
+			scopes[key] = s
+			resourceSpans.ScopeSpans = append(resourceSpans.ScopeSpans, otlpScopeSpans{
+				Scope:     otlpScope{Name: scope.Name, Version: scope.Version},
+				SchemaURL: scope.SchemaURL,
+			})
+		}
+		scopeSpans := &resourceSpans.ScopeSpans[s]
+		scopeSpans.Spans = append(scopeSpans.Spans, newOTLPSpan(span))
+	}
+
+	return traces
+}
+
+func newOTLPSpan(span sdktrace.ReadOnlySpan) otlpSpan {
+	sc := span.SpanContext()
+	s := otlpSpan{
+		TraceID:                sc.TraceID().String(),
+		SpanID:                 sc.SpanID().String(),
+		TraceState:             sc.TraceState().String(),
+		Flags:                  otlpFlags(sc.TraceFlags(), span.Parent()),
+		Name:                   span.Name(),
+		Kind:                   int(span.SpanKind()),
+		StartTimeUnixNano:      strconv.FormatInt(span.StartTime().UnixNano(), 10),
+		EndTimeUnixNano:        strconv.FormatInt(span.EndTime().UnixNano(), 10),
+		Attributes:             otlpAttributes(span.Attributes()),
+		DroppedAttributesCount: span.DroppedAttributes(),
+		DroppedEventsCount:     span.DroppedEvents(),
+		DroppedLinksCount:      span.DroppedLinks(),
+		Status:                 otlpStatus{Message: span.Status().Description, Code: otlpStatusCode(span.Status().Code)},
+	}
+	if span.Parent().IsValid() {
+		s.ParentSpanID = span.Parent().SpanID().String()
+	}
+	for _, event := range span.Events() {
+		s.Events = append(s.Events, otlpEvent{
+			TimeUnixNano:           strconv.FormatInt(event.Time.UnixNano(), 10),
+			Name:                   event.Name,
+			Attributes:             otlpAttributes(event.Attributes),
+			DroppedAttributesCount: event.DroppedAttributeCount,
+		})
+	}
+	for _, link := range span.Links() {
+		s.Links = append(s.Links, otlpLink{
+			TraceID:                link.SpanContext.TraceID().String(),
+			SpanID:                 link.SpanContext.SpanID().String(),
+			TraceState:             link.SpanContext.TraceState().String(),
+			Attributes:             otlpAttributes(link.Attributes),
+			DroppedAttributesCount: link.DroppedAttributeCount,
+			Flags:                  otlpFlags(link.SpanContext.TraceFlags(), link.SpanContext),
+		})
+	}
+	return s
+}
+
+func otlpFlags(flags ot.TraceFlags, remote ot.SpanContext) uint32 {
+	f := uint32(flags) | otlpFlagsHasIsRemote
+	if remote.IsRemote() {
+		f |= otlpFlagsIsRemote
+	}
+	return f
+}
+
+// the status codes of OTLP are in a different order than those of the api
+func otlpStatusCode(code codes.Code) int {
+	switch code {
+	case codes.Ok:
+		return 1
+	case codes.Error:
+		return 2
+	default:
+		return 0
+	}
+}
+
+func otlpAttributes(attributes []attribute.KeyValue) []otlpKeyValue {
+	if len(attributes) == 0 {
+		return nil
+	}
+	kvs := make([]otlpKeyValue, 0, len(attributes))
+	for _, kv := range attributes {
+		kvs = append(kvs, otlpKeyValue{Key: string(kv.Key), Value: otlpValue(kv.Value)})
+	}
+	return kvs
+}
+
+func otlpValue(v attribute.Value) otlpAnyValue {
+	switch v.Type() {
+	case attribute.BOOL:
+		b := v.AsBool()
+		return otlpAnyValue{BoolValue: &b}
+	case attribute.INT64:
+		i := strconv.FormatInt(v.AsInt64(), 10)
+		return otlpAnyValue{IntValue: &i}
+	case attribute.FLOAT64:
+		f := v.AsFloat64()
+		return otlpAnyValue{DoubleValue: &f}
+	case attribute.BOOLSLICE:
+		return otlpArray(v.AsBoolSlice(), attribute.BoolValue)
+	case attribute.INT64SLICE:
+		return otlpArray(v.AsInt64Slice(), attribute.Int64Value)
+	case attribute.FLOAT64SLICE:
+		return otlpArray(v.AsFloat64Slice(), attribute.Float64Value)
+	case attribute.STRINGSLICE:
+		return otlpArray(v.AsStringSlice(), attribute.StringValue)
+	default:
+		s := v.Emit()
+		return otlpAnyValue{StringValue: &s}
+	}
+}
+
+func otlpArray[T any](values []T, toValue func(T) attribute.Value) otlpAnyValue {
+	array := &otlpArrayValue{Values: make([]otlpAnyValue, 0, len(values))}
+	for _, value := range values {
+		array.Values = append(array.Values, otlpValue(toValue(value)))
+	}
+	return otlpAnyValue{ArrayValue: array}
+}
@@ -0,0 +1,76 @@
+package otel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"go.opentelemetry.io/otel/sdk/resource"
+	semconv "go.opentelemetry.io/otel/semconv/v1.27.0"
+)
+
+// the detectors that describe where the service runs, in both resources
+const (
+	// host.name, host.id and host.arch
+	RESOURCE_DETECTOR_HOST = "host"
+	// os.type and os.description
+	RESOURCE_DETECTOR_OS = "os"
+	// process.pid, the executable and the go runtime, not the command line since it can hold secrets
+	RESOURCE_DETECTOR_PROCESS = "process"
+	// container.id, read from the cgroup of the process
+	RESOURCE_DETECTOR_CONTAINER = "container"
+)
+
+var resourceDetectors = map[string][]resource.Option{
+	RESOURCE_DETECTOR_HOST:      {resource.WithHost(), resource.WithHostID()},
+	RESOURCE_DETECTOR_OS:        {resource.WithOS()},
+	RESOURCE_DETECTOR_PROCESS:   {resource.WithProcessPID(), resource.WithProcessExecutableName(), resource.WithProcessExecutablePath(), resource.WithProcessRuntimeName(), resource.WithProcessRuntimeVersion(), resource.WithProcessRuntimeDescription()},
+	RESOURCE_DETECTOR_CONTAINER: {resource.WithContainer()},
+}
+
+// CheckResourceDetector returns an error for a detector that doesn't exist.
+func CheckResourceDetector(name string) error {
+	if _, ok := resourceDetectors[name]; !ok {
+		return fmt.Errorf("unknown resource detector '%s', expected %s, %s, %s or %s", name, RESOURCE_DETECTOR_HOST, RESOURCE_DETECTOR_OS, RESOURCE_DETECTOR_PROCESS, RESOURCE_DETECTOR_CONTAINER)
+	}
+	return nil
+}
+
+// newResource merges, each over the ones before it:
+//   - the telemetry sdk and the detectors
+//   - the Cloud Run job task
+//   - the service name
+//   - OTEL_RESOURCE_ATTRIBUTES and OTEL_SERVICE_NAME
+//
+// The environment only names the service when envServiceName is set, so the traces of runs aren't
+// named after the service that exports them. Detectors that fail are logged, and the attributes
+// they found are still used.
+func newResource(ctx context.Context, serviceName string, envServiceName bool, detectors []string) (*resource.Resource, error) {
+	opts := []resource.Option{resource.WithTelemetrySDK()}
+	for _, name := range detectors {
+		detector, ok := resourceDetectors[name]
+		if !ok {
+			return nil, CheckResourceDetector(name)
+		}
+		opts = append(opts, detector...)
+	}
+	opts = append(opts,
+		resource.WithAttributes(cloudRunJobAttributes()...),
+		resource.WithAttributes(semconv.ServiceName(serviceName)),
+		resource.WithFromEnv(),
+	)
+	if !envServiceName {
+		opts = append(opts, resource.WithAttributes(semconv.ServiceName(serviceName)))
+	}
+
+	res, err := resource.New(ctx, opts...)
+	if errors.Is(err, resource.ErrPartialResource) {
+		slog.Warn("failed to detect some of the resource attributes", "service.name", serviceName, "err", err)
+		err = nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the resource of %s: %w", serviceName, err)
+	}
+	return res, nil
+}
@@ -0,0 +1,80 @@
+package otel
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.27.0"
+)
+
+func TestNewResource(t *testing.T) {
+	tests := map[string]struct {
+		givenEnv            map[string]string
+		givenEnvServiceName bool
+		expectedAttributes  map[attribute.Key]string
+	}{
+		"default service name": {
+			givenEnv:            map[string]string{},
+			givenEnvServiceName: true,
+			expectedAttributes:  map[attribute.Key]string{semconv.ServiceNameKey: "trace-export-service"},
+		},
+		"resource attributes override the detectors and cloud run": {
+			givenEnv: map[string]string{
+				"OTEL_RESOURCE_ATTRIBUTES": "deployment.environment.name=prod,host.name=exporter-0,service.name=exporter",
+				CLOUD_RUN_EXECUTION_KEY:    "backfill-abc",
+			},
+			givenEnvServiceName: true,
+			expectedAttributes: map[attribute.Key]string{
+				semconv.ServiceNameKey:             "exporter",
+				semconv.HostNameKey:                "exporter-0",
+				"deployment.environment.name":      "prod",
+				semconv.GCPCloudRunJobExecutionKey: "backfill-abc",
+			},
+		},
+		"service name overrides the resource attributes": {
+			givenEnv:            map[string]string{"OTEL_RESOURCE_ATTRIBUTES": "service.name=exporter", "OTEL_SERVICE_NAME": "trace-export"},
+			givenEnvServiceName: true,
+			expectedAttributes:  map[attribute.Key]string{semconv.ServiceNameKey: "trace-export"},
+		},
+		"runs aren't named by the environment": {
+			givenEnv:            map[string]string{"OTEL_RESOURCE_ATTRIBUTES": "service.name=exporter,team=ci", "OTEL_SERVICE_NAME": "trace-export"},
+			givenEnvServiceName: false,
+			expectedAttributes:  map[attribute.Key]string{semconv.ServiceNameKey: "trace-export-service", "team": "ci"},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			// Arrange
+			for _, key := range []string{"OTEL_RESOURCE_ATTRIBUTES", "OTEL_SERVICE_NAME", CLOUD_RUN_EXECUTION_KEY} {
+				t.Setenv(key, test.givenEnv[key])
+			}
+
+			// Act
+			res, err := newResource(context.Background(), "trace-export-service", test.givenEnvServiceName, []string{RESOURCE_DETECTOR_HOST, RESOURCE_DETECTOR_PROCESS})
+
+			// Assert
+			if !assert.NoError(t, err) {
+				t.FailNow()
+			}
+			for key, expected := range test.expectedAttributes {
+				value, _ := res.Set().Value(key)
+				assert.Equal(t, expected, value.AsString(), string(key))
+			}
+			_, ok := res.Set().Value(semconv.ProcessPIDKey)
+			assert.True(t, ok, "the detectors should add their attributes")
+			_, ok = res.Set().Value(semconv.ProcessCommandArgsKey)
+			assert.False(t, ok, "the command line can hold secrets")
+		})
+	}
+}
+
+func TestNewResourceRejectsUnknownDetector(t *testing.T) {
+	// Act
+	_, err := newResource(context.Background(), "trace-export-service", true, []string{"kubernetes"})
+
+	// Assert
+	assert.EqualError(t, err, "unknown resource detector 'kubernetes', expected host, os, process or container")
+}
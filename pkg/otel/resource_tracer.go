@@ -0,0 +1,207 @@
+package otel
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.27.0"
+	ot "go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/embedded"
+)
+
+// the providers of resources that weren't used for this long are dropped when no timeout is set
+const DEFAULT_RESOURCE_IDLE_TIMEOUT = time.Hour
+
+// the prefix of the template variables of the custom properties of the repo
+const customPropertiesVariable = "custom_properties."
+
+// ResourceOptions template the resource of the traces of each run. The templates expand
+// ${repo} ('owner/repo'), ${owner}, ${repo_name}, ${workflow} and ${custom_properties.<name>}.
+type ResourceOptions struct {
+	// the service.name, the default one is used when it is empty or expands to nothing
+	ServiceName string
+	// attributes that expand to nothing are left out
+	Attributes map[string]string
+	// DEFAULT_RESOURCE_IDLE_TIMEOUT is used when zero
+	IdleTimeout time.Duration
+}
+
+func (o ResourceOptions) enabled() bool {
+	return o.ServiceName != "" || len(o.Attributes) > 0
+}
+
+// CheckResourceTemplate returns an error for a variable the templates don't know.
+func CheckResourceTemplate(template string) error {
+	var unknown []string
+	os.Expand(template, func(name string) string {
+		_, ok := runVariable(runInfo{}, nil, name)
+		if !ok {
+			unknown = append(unknown, name)
+		}
+		return ""
+	})
+	if len(unknown) > 0 {
+		return fmt.Errorf("unknown variable '%s', expected repo, owner, repo_name, workflow or custom_properties.<name>", unknown[0])
+	}
+	return nil
+}
+
+func runVariable(run runInfo, properties map[string]string, name string) (string, bool) {
+	owner, repoName, _ := strings.Cut(run.repo, "/")
+	switch name {
+	case "repo":
+		return run.repo, true
+	case "owner":
+		return owner, true
+	case "repo_name":
+		return repoName, true
+	case "workflow":
+		return run.workflow, true
+	}
+	if property, ok := strings.CutPrefix(name, customPropertiesVariable); ok && property != "" {
+		return properties[property], true
+	}
+	return "", false
+}
+
+type customPropertiesKey struct{}
+
+// ContextWithCustomProperties returns a context with the custom properties of the repo of the run,
+// for the resource templates.
+func ContextWithCustomProperties(ctx context.Context, properties map[string]string) context.Context {
+	return context.WithValue(ctx, customPropertiesKey{}, properties)
+}
+
+// ResourceTracer starts the spans of each run with a tracer of the provider of its resource. The
+// providers are created the first time a resource is used, and dropped once they weren't used for
+// the idle timeout. They all share the span processor of the default provider, so they don't need to
+// be shut down, and spans that are still open when their provider is dropped are still exported.
+// Spans started without the run in their context use the default provider.
+type ResourceTracer struct {
+	embedded.Tracer
+
+	name      string
+	fallback  ot.Tracer
+	base      resource.Resource
+	processor sdktrace.SpanProcessor
+	opts      ResourceOptions
+	now       func() time.Time
+
+	mu        sync.Mutex
+	providers map[attribute.Distinct]*resourceProvider
+	lastSweep time.Time
+}
+
+type resourceProvider struct {
+	tracer   ot.Tracer
+	lastUsed time.Time
+}
+
+var _ ot.Tracer = (*ResourceTracer)(nil)
+
+// NewResourceTracer creates tracers named name. The resources of the runs are merged over base,
+// and their spans are processed by processor, which isn't shut down by the providers.
+func NewResourceTracer(name string, fallback ot.Tracer, base resource.Resource, processor sdktrace.SpanProcessor, opts ResourceOptions) *ResourceTracer {
+	if opts.IdleTimeout <= 0 {
+		opts.IdleTimeout = DEFAULT_RESOURCE_IDLE_TIMEOUT
+	}
+	return &ResourceTracer{
+		name:      name,
+		fallback:  fallback,
+		base:      base,
+		processor: sharedProcessor{processor},
+		opts:      opts,
+		now:       time.Now,
+		providers: make(map[attribute.Distinct]*resourceProvider),
+	}
+}
+
+func (t *ResourceTracer) Start(ctx context.Context, spanName string, opts ...ot.SpanStartOption) (context.Context, ot.Span) {
+	run, ok := ctx.Value(runKey{}).(runInfo)
+	if !ok {
+		return t.fallback.Start(ctx, spanName, opts...)
+	}
+	properties, _ := ctx.Value(customPropertiesKey{}).(map[string]string)
+	return t.tracer(t.attributes(run, properties)).Start(ctx, spanName, opts...)
+}
+
+// attributes expands the templates for the run.
+func (t *ResourceTracer) attributes(run runInfo, properties map[string]string) attribute.Set {
+	expand := func(template string) string {
+		return os.Expand(template, func(name string) string {
+			value, _ := runVariable(run, properties, name)
+			return value
+		})
+	}
+
+	var attributes []attribute.KeyValue
+	for key, template := range t.opts.Attributes {
+		if value := expand(template); value != "" {
+			attributes = append(attributes, attribute.String(key, value))
+		}
+	}
+	if serviceName := expand(t.opts.ServiceName); serviceName != "" {
+		attributes = append(attributes, semconv.ServiceName(serviceName))
+	}
+	return attribute.NewSet(attributes...)
+}
+
+// tracer returns the tracer of the provider of the resource, dropping the providers that have been
+// idle for too long.
+func (t *ResourceTracer) tracer(attributes attribute.Set) ot.Tracer {
+	now := t.now()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if now.Sub(t.lastSweep) >= t.opts.IdleTimeout/2 {
+		for key, provider := range t.providers {
+			if now.Sub(provider.lastUsed) >= t.opts.IdleTimeout {
+				delete(t.providers, key)
+			}
+		}
+		t.lastSweep = now
+	}
+
+	key := attributes.Equivalent()
+	provider, ok := t.providers[key]
+	if !ok {
+		res, err := resource.Merge(&t.base, resource.NewSchemaless(attributes.ToSlice()...))
+		if err != nil {
+			// only the schema urls can conflict, which they don't since the attributes have none
+			res = &t.base
+		}
+		tracerProvider := sdktrace.NewTracerProvider(
+			sdktrace.WithResource(res),
+			sdktrace.WithIDGenerator(NewIDGenerator()),
+			sdktrace.WithSpanProcessor(t.processor),
+		)
+		provider = &resourceProvider{tracer: tracerProvider.Tracer(t.name)}
+		t.providers[key] = provider
+	}
+	provider.lastUsed = now
+	return provider.tracer
+}
+
+// Resources returns the number of resources that have a provider.
+func (t *ResourceTracer) Resources() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.providers)
+}
+
+// sharedProcessor is shut down by the provider that owns it.
+type sharedProcessor struct {
+	sdktrace.SpanProcessor
+}
+
+func (p sharedProcessor) Shutdown(context.Context) error {
+	return nil
+}
@@ -0,0 +1,114 @@
+package otel
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.27.0"
+)
+
+func newTestResourceTracer(opts ResourceOptions) (*ResourceTracer, *tracetest.InMemoryExporter, *sdktrace.TracerProvider) {
+	exporter := tracetest.NewInMemoryExporter()
+	processor := sdktrace.NewSimpleSpanProcessor(exporter)
+	base := resource.NewSchemaless(semconv.ServiceName("trace-workflow-run"), attribute.String("host.name", "exporter-0"))
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(processor), sdktrace.WithResource(base))
+	return NewResourceTracer("test", provider.Tracer("test"), *base, processor, opts), exporter, provider
+}
+
+func TestResourceTracer(t *testing.T) {
+	tests := map[string]struct {
+		givenOpts       ResourceOptions
+		givenContext    func(ctx context.Context) context.Context
+		expectedService string
+		expectedTeam    string
+	}{
+		"service per repo": {
+			givenOpts:       ResourceOptions{ServiceName: "${repo_name}"},
+			givenContext:    func(ctx context.Context) context.Context { return ContextWithRun(ctx, "octo/web", "ci") },
+			expectedService: "web",
+		},
+		"service per custom property": {
+			givenOpts: ResourceOptions{ServiceName: "${custom_properties.team}-ci", Attributes: map[string]string{"team": "${custom_properties.team}"}},
+			givenContext: func(ctx context.Context) context.Context {
+				ctx = ContextWithCustomProperties(ctx, map[string]string{"team": "payments"})
+				return ContextWithRun(ctx, "octo/web", "ci")
+			},
+			expectedService: "payments-ci",
+			expectedTeam:    "payments",
+		},
+		"service that expands to nothing": {
+			givenOpts:       ResourceOptions{ServiceName: "${custom_properties.team}", Attributes: map[string]string{"team": "${custom_properties.team}"}},
+			givenContext:    func(ctx context.Context) context.Context { return ContextWithRun(ctx, "octo/web", "ci") },
+			expectedService: "trace-workflow-run",
+		},
+		"span without a run": {
+			givenOpts:       ResourceOptions{ServiceName: "${repo_name}"},
+			givenContext:    func(ctx context.Context) context.Context { return ctx },
+			expectedService: "trace-workflow-run",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			// Arrange
+			tracer, exporter, provider := newTestResourceTracer(test.givenOpts)
+
+			// Act
+			ctx, run := tracer.Start(test.givenContext(context.Background()), "run")
+			_, job := tracer.Start(ctx, "job")
+			job.End()
+			run.End()
+
+			// Assert
+			spans := exporter.GetSpans()
+			assert.Len(t, spans, 2)
+			for _, span := range spans {
+				service, _ := span.Resource.Set().Value(semconv.ServiceNameKey)
+				assert.Equal(t, test.expectedService, service.AsString(), span.Name)
+				team, _ := span.Resource.Set().Value("team")
+				assert.Equal(t, test.expectedTeam, team.AsString(), span.Name)
+				host, _ := span.Resource.Set().Value("host.name")
+				assert.Equal(t, "exporter-0", host.AsString(), "the resource should be merged over the base one")
+			}
+			assert.NoError(t, provider.Shutdown(context.Background()))
+		})
+	}
+}
+
+func TestResourceTracerDropsIdleProviders(t *testing.T) {
+	// Arrange
+	tracer, exporter, provider := newTestResourceTracer(ResourceOptions{ServiceName: "${repo}", IdleTimeout: time.Hour})
+	now := time.Unix(1700000000, 0)
+	tracer.now = func() time.Time { return now }
+	start := func(repo string) {
+		_, span := tracer.Start(ContextWithRun(context.Background(), repo, "ci"), "run")
+		span.End()
+	}
+
+	// Act
+	start("octo/web")
+	start("octo/api")
+	start("octo/web")
+	before := tracer.Resources()
+	now = now.Add(90 * time.Minute)
+	start("octo/api")
+
+	// Assert
+	assert.Equal(t, 2, before)
+	assert.Equal(t, 1, tracer.Resources(), "the provider of octo/web should be dropped")
+	assert.Len(t, exporter.GetSpans(), 4)
+	assert.NoError(t, provider.Shutdown(context.Background()))
+}
+
+func TestCheckResourceTemplate(t *testing.T) {
+	assert.NoError(t, CheckResourceTemplate("${owner}/${repo_name} ${workflow} ${custom_properties.team}"))
+	assert.EqualError(t, CheckResourceTemplate("${repository}"), "unknown variable 'repository', expected repo, owner, repo_name, workflow or custom_properties.<name>")
+}
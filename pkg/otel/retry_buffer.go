@@ -0,0 +1,407 @@
+package otel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace"
+	"go.opentelemetry.io/otel/metric"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+const bufferFileExtension = ".pb"
+
+// the wait after the first failed retry
+const bufferInitialBackoff = time.Second
+
+// BufferOptions keep the batches the collector didn't accept on disk, to export them again later.
+type BufferOptions struct {
+	// nothing is kept when empty
+	Dir string
+	// the oldest batches are dropped when the buffer grows larger, 0 doesn't limit it
+	MaxBytes int64
+	// batches are dropped when they are older, 0 keeps them until they are exported
+	MaxAge time.Duration
+	// the longest wait between retries
+	MaxBackoff time.Duration
+	// how long a retry may take
+	Timeout time.Duration
+
+	// the destination the batches are for, the metrics of the buffer are named after it
+	destination string
+}
+
+// BufferStats describes the batches that wait on disk to be exported again.
+type BufferStats struct {
+	Batches int   `json:"batches"`
+	Bytes   int64 `json:"bytes"`
+	// how long the oldest batch has been waiting
+	OldestAgeMs int64  `json:"oldest_age_ms"`
+	Replayed    uint64 `json:"replayed"`
+	// batches that were dropped because the buffer was full or they were too old
+	Dropped uint64 `json:"dropped"`
+	// batches the collector rejected for good, like for invalid spans or credentials, which aren't kept
+	Rejected uint64 `json:"rejected"`
+}
+
+// bufferedFile is a batch on disk, the names sort in the order the batches were written.
+type bufferedFile struct {
+	name    string
+	size    int64
+	written time.Time
+}
+
+// bufferClient writes the batches the client fails to upload to disk, and uploads them again in
+// order once the collector is back. Batches are written behind the ones that are still waiting, so
+// the spans of a run aren't exported before older ones. Batches the collector rejected for good are
+// dropped instead, so they don't hold back the ones behind them until they are too old.
+type bufferClient struct {
+	otlptrace.Client
+	opts BufferOptions
+
+	mu    sync.Mutex
+	files []bufferedFile
+	bytes int64
+	// makes unique file names for the batches written in the same nanosecond
+	sequence uint64
+
+	// the first wait after a failed retry, it doubles up to the max backoff
+	initialBackoff time.Duration
+
+	wake     chan struct{}
+	done     chan struct{}
+	stopped  chan struct{}
+	replayed atomic.Uint64
+	dropped  atomic.Uint64
+	rejected atomic.Uint64
+
+	metrics metric.Registration
+}
+
+func newBufferClient(client otlptrace.Client, opts BufferOptions) *bufferClient {
+	if opts.MaxBackoff <= 0 {
+		opts.MaxBackoff = 5 * time.Minute
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = DEFAULT_BATCH_EXPORT_TIMEOUT
+	}
+	return &bufferClient{
+		Client:         client,
+		opts:           opts,
+		initialBackoff: bufferInitialBackoff,
+		wake:           make(chan struct{}, 1),
+		done:           make(chan struct{}),
+		stopped:        make(chan struct{}),
+	}
+}
+
+// Start picks up the batches that were left on disk by the last process, and starts retrying them.
+func (b *bufferClient) Start(ctx context.Context) error {
+	err := b.Client.Start(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(b.opts.Dir, 0o755)
+	if err != nil {
+		return fmt.Errorf("failed to create export buffer directory: %w", err)
+	}
+	entries, err := os.ReadDir(b.opts.Dir)
+	if err != nil {
+		return fmt.Errorf("failed to read export buffer directory: %w", err)
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), bufferFileExtension) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return fmt.Errorf("failed to read export buffer directory: %w", err)
+		}
+		b.files = append(b.files, bufferedFile{name: entry.Name(), size: info.Size(), written: info.ModTime()})
+		b.bytes += info.Size()
+	}
+	slices.SortFunc(b.files, func(a bufferedFile, c bufferedFile) int { return strings.Compare(a.name, c.name) })
+	if len(b.files) > 0 {
+		slog.Info("found batches in the export buffer", "dir", b.opts.Dir, "batches", len(b.files), "bytes", b.bytes)
+	}
+
+	b.metrics, err = registerBufferMetrics(b)
+	if err != nil {
+		return err
+	}
+
+	go b.retry()
+	return nil
+}
+
+// Stop stops retrying, the batches that are still waiting are kept for the next process.
+func (b *bufferClient) Stop(ctx context.Context) error {
+	close(b.done)
+	select {
+	case <-b.stopped:
+	case <-ctx.Done():
+	}
+	err := b.metrics.Unregister()
+	return errors.Join(err, b.Client.Stop(ctx))
+}
+
+// UploadTraces only fails when the batch couldn't be uploaded or written to disk, or the collector
+// rejected it for good.
+func (b *bufferClient) UploadTraces(ctx context.Context, protoSpans []*tracepb.ResourceSpans) error {
+	b.mu.Lock()
+	waiting := len(b.files) > 0
+	b.mu.Unlock()
+
+	if !waiting {
+		err := b.Client.UploadTraces(ctx, protoSpans)
+		if err == nil {
+			return nil
+		}
+		if !isRetryable(err) {
+			b.rejected.Add(1)
+			return fmt.Errorf("the collector rejected the spans, they aren't kept in the export buffer: %w", err)
+		}
+		slog.Warn("failed to export spans, writing them to the export buffer", "err", err)
+	}
+
+	err := b.write(protoSpans)
+	if err != nil {
+		return fmt.Errorf("failed to write spans to the export buffer: %w", err)
+	}
+	return nil
+}
+
+func (b *bufferClient) Stats() BufferStats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	stats := BufferStats{
+		Batches:  len(b.files),
+		Bytes:    b.bytes,
+		Replayed: b.replayed.Load(),
+		Dropped:  b.dropped.Load(),
+		Rejected: b.rejected.Load(),
+	}
+	if len(b.files) > 0 {
+		stats.OldestAgeMs = time.Since(b.files[0].written).Milliseconds()
+	}
+	return stats
+}
+
+func (b *bufferClient) write(protoSpans []*tracepb.ResourceSpans) error {
+	data, err := proto.Marshal(&coltracepb.ExportTraceServiceRequest{ResourceSpans: protoSpans})
+	if err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	b.sequence += 1
+	file := bufferedFile{
+		name:    fmt.Sprintf("%020d-%06d%s", now.UnixNano(), b.sequence%1_000_000, bufferFileExtension),
+		size:    int64(len(data)),
+		written: now,
+	}
+	// written under a temporary name first, so a crash doesn't leave half a batch behind
+	tmp := filepath.Join(b.opts.Dir, file.name+".tmp")
+	err = os.WriteFile(tmp, data, 0o644)
+	if err != nil {
+		return err
+	}
+	err = os.Rename(tmp, filepath.Join(b.opts.Dir, file.name))
+	if err != nil {
+		return err
+	}
+	b.files = append(b.files, file)
+	b.bytes += file.size
+
+	for b.opts.MaxBytes > 0 && b.bytes > b.opts.MaxBytes && len(b.files) > 1 {
+		slog.Warn("dropped the oldest batch of the export buffer, it is full", "file", b.files[0].name, "max_bytes", b.opts.MaxBytes)
+		b.removeOldest()
+		b.dropped.Add(1)
+	}
+
+	select {
+	case b.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// removeOldest must be called with the lock held.
+func (b *bufferClient) removeOldest() {
+	err := os.Remove(filepath.Join(b.opts.Dir, b.files[0].name))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		slog.Error("failed to remove batch from the export buffer", "file", b.files[0].name, "err", err)
+	}
+	b.bytes -= b.files[0].size
+	b.files = b.files[1:]
+}
+
+// retry uploads the oldest batch until the buffer is empty, waiting longer after each failure.
+func (b *bufferClient) retry() {
+	defer close(b.stopped)
+
+	backoff := b.initialBackoff
+	for {
+		wait := backoff
+		ok, err := b.replayOldest()
+		if ok {
+			backoff = b.initialBackoff
+			wait = 0
+		} else if err != nil {
+			slog.Warn("failed to export batch from the export buffer", "retry_in", backoff, "err", err)
+			backoff = min(2*backoff, b.opts.MaxBackoff)
+		}
+
+		b.mu.Lock()
+		empty := len(b.files) == 0
+		b.mu.Unlock()
+		// new batches only wake it up when it is idle, they don't cut the backoff short
+		wake, timer := b.wake, time.After(wait)
+		if empty {
+			timer = nil
+		} else {
+			wake = nil
+		}
+
+		select {
+		case <-b.done:
+			return
+		case <-wake:
+		case <-timer:
+		}
+	}
+}
+
+// replayOldest uploads the oldest batch and removes it, ok is false when there was none or it failed.
+func (b *bufferClient) replayOldest() (ok bool, err error) {
+	b.mu.Lock()
+	for len(b.files) > 0 && b.opts.MaxAge > 0 && time.Since(b.files[0].written) > b.opts.MaxAge {
+		slog.Warn("dropped the oldest batch of the export buffer, it is too old", "file", b.files[0].name, "max_age", b.opts.MaxAge)
+		b.removeOldest()
+		b.dropped.Add(1)
+	}
+	if len(b.files) == 0 {
+		b.mu.Unlock()
+		return false, nil
+	}
+	file := b.files[0]
+	b.mu.Unlock()
+
+	data, err := os.ReadFile(filepath.Join(b.opts.Dir, file.name))
+	if err != nil {
+		return false, err
+	}
+	var request coltracepb.ExportTraceServiceRequest
+	err = proto.Unmarshal(data, &request)
+	if err != nil {
+		// it can't ever be exported, so it is dropped like a batch that got too old
+		slog.Error("dropped batch of the export buffer that can't be read", "file", file.name, "err", err)
+		b.dropped.Add(1)
+		b.removeIfOldest(file)
+		return true, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), b.opts.Timeout)
+	defer cancel()
+	err = b.Client.UploadTraces(ctx, request.ResourceSpans)
+	if err != nil && !isRetryable(err) {
+		// retrying it would only hold back the batches behind it
+		slog.Error("dropped batch of the export buffer that the collector rejected", "file", file.name, "err", err)
+		b.rejected.Add(1)
+		b.removeIfOldest(file)
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	b.replayed.Add(1)
+	b.removeIfOldest(file)
+	return true, nil
+}
+
+// removeIfOldest removes the batch after it was read, unless it was dropped in the meantime.
+func (b *bufferClient) removeIfOldest(file bufferedFile) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.files) > 0 && b.files[0].name == file.name {
+		b.removeOldest()
+	}
+}
+
+// the grpc codes the OTLP specification allows to retry
+var retryableCodes = []codes.Code{codes.Canceled, codes.DeadlineExceeded, codes.ResourceExhausted, codes.Aborted, codes.OutOfRange, codes.Unavailable, codes.DataLoss}
+
+// the http exporter doesn't type the errors of the responses it doesn't retry itself, they end with
+// the status of the response
+var httpStatusError = regexp.MustCompile(`^failed to send to \S+: (\d{3})\b`)
+
+// isRetryable is false for the batches the collector rejected for good, like with InvalidArgument,
+// Unauthenticated or a 4xx status other than 429. Everything else, like a collector that can't be
+// reached, is retried.
+func isRetryable(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+		return true
+	}
+	if s, ok := status.FromError(err); ok {
+		return slices.Contains(retryableCodes, s.Code())
+	}
+	for ; err != nil; err = errors.Unwrap(err) {
+		if match := httpStatusError.FindStringSubmatch(err.Error()); match != nil {
+			code, _ := strconv.Atoi(match[1])
+			return code == http.StatusTooManyRequests || code >= 500
+		}
+	}
+	return true
+}
+
+// bufferedExporter is an OTLP exporter that keeps the batches it fails to export.
+type bufferedExporter struct {
+	*otlptrace.Exporter
+	buffer *bufferClient
+}
+
+func (e bufferedExporter) BufferStats() BufferStats {
+	return e.buffer.Stats()
+}
+
+// NewBufferedOTLPExporter creates the exporter of the protocol, which keeps the batches it fails to
+// export in the directory of the buffer until they can be. It doesn't buffer without a directory.
+func NewBufferedOTLPExporter(ctx context.Context, opts OTLPOptions, buffer BufferOptions) (sdktrace.SpanExporter, error) {
+	if buffer.Dir == "" {
+		return NewOTLPExporter(ctx, opts)
+	}
+
+	client, err := newOTLPClient(opts)
+	if err != nil {
+		return nil, err
+	}
+	b := newBufferClient(client, buffer)
+	exporter, err := otlptrace.New(ctx, b)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s OTLP trace exporter: %w", opts.Protocol, err)
+	}
+	return bufferedExporter{Exporter: exporter, buffer: b}, nil
+}
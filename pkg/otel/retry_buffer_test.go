@@ -0,0 +1,247 @@
+package otel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// fakeClient fails to upload while the collector is down, rejects the batches with a span named
+// in rejected, and records the names of the spans it uploaded.
+type fakeClient struct {
+	mu       sync.Mutex
+	down     bool
+	rejected []string
+	uploaded []string
+}
+
+func (c *fakeClient) Start(context.Context) error { return nil }
+func (c *fakeClient) Stop(context.Context) error  { return nil }
+
+func (c *fakeClient) UploadTraces(_ context.Context, protoSpans []*tracepb.ResourceSpans) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.down {
+		return errors.New("connection refused")
+	}
+	for _, rs := range protoSpans {
+		for _, ss := range rs.ScopeSpans {
+			for _, span := range ss.Spans {
+				if slices.Contains(c.rejected, span.Name) {
+					return status.Error(codes.InvalidArgument, "invalid span")
+				}
+			}
+		}
+	}
+	for _, rs := range protoSpans {
+		for _, ss := range rs.ScopeSpans {
+			for _, span := range ss.Spans {
+				c.uploaded = append(c.uploaded, span.Name)
+			}
+		}
+	}
+	return nil
+}
+
+func (c *fakeClient) setDown(down bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.down = down
+}
+
+func (c *fakeClient) spans() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]string(nil), c.uploaded...)
+}
+
+func batch(name string) []*tracepb.ResourceSpans {
+	return []*tracepb.ResourceSpans{{ScopeSpans: []*tracepb.ScopeSpans{{Spans: []*tracepb.Span{{Name: name}}}}}}
+}
+
+func newTestBufferClient(t *testing.T, client *fakeClient, opts BufferOptions) *bufferClient {
+	b := newBufferClient(client, opts)
+	b.initialBackoff = 10 * time.Millisecond
+	assert.NoError(t, b.Start(context.Background()))
+	t.Cleanup(func() { _ = b.Stop(context.Background()) })
+	return b
+}
+
+func TestBufferClientReplaysInOrder(t *testing.T) {
+	// Arrange
+	client := &fakeClient{down: true}
+	b := newTestBufferClient(t, client, BufferOptions{Dir: t.TempDir(), MaxBackoff: 20 * time.Millisecond})
+
+	// Act
+	for _, name := range []string{"first", "second"} {
+		assert.NoError(t, b.UploadTraces(context.Background(), batch(name)))
+	}
+	buffered := b.Stats()
+	client.setDown(false)
+	// exported behind the buffered batches, even though the collector is back
+	assert.NoError(t, b.UploadTraces(context.Background(), batch("third")))
+
+	// Assert
+	assert.Equal(t, 2, buffered.Batches)
+	assert.Eventually(t, func() bool { return b.Stats().Batches == 0 }, time.Second, 5*time.Millisecond)
+	assert.Equal(t, []string{"first", "second", "third"}, client.spans())
+}
+
+func TestBufferClientDropsOldestWhenFull(t *testing.T) {
+	// Arrange
+	client := &fakeClient{down: true}
+	dir := t.TempDir()
+	b := newTestBufferClient(t, client, BufferOptions{Dir: dir, MaxBytes: 1, MaxBackoff: time.Hour})
+
+	// Act
+	for _, name := range []string{"first", "second", "third"} {
+		assert.NoError(t, b.UploadTraces(context.Background(), batch(name)))
+	}
+
+	// Assert
+	stats := b.Stats()
+	assert.Equal(t, 1, stats.Batches)
+	assert.Equal(t, uint64(2), stats.Dropped)
+	entries, err := os.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
+
+func TestBufferClientKeepsBatchesForTheNextProcess(t *testing.T) {
+	// Arrange
+	dir := t.TempDir()
+	before := newBufferClient(&fakeClient{down: true}, BufferOptions{Dir: dir, MaxBackoff: time.Hour})
+	assert.NoError(t, before.Start(context.Background()))
+	assert.NoError(t, before.UploadTraces(context.Background(), batch("left behind")))
+	assert.NoError(t, before.Stop(context.Background()))
+	client := &fakeClient{}
+
+	// Act
+	newTestBufferClient(t, client, BufferOptions{Dir: dir, MaxBackoff: time.Hour})
+
+	// Assert
+	assert.Eventually(t, func() bool { return len(client.spans()) == 1 }, time.Second, 5*time.Millisecond)
+	assert.Equal(t, []string{"left behind"}, client.spans())
+}
+
+func TestBufferClientDoesNotKeepRejectedBatches(t *testing.T) {
+	// Arrange
+	client := &fakeClient{rejected: []string{"invalid"}}
+	b := newTestBufferClient(t, client, BufferOptions{Dir: t.TempDir(), MaxBackoff: time.Hour})
+
+	// Act
+	err := b.UploadTraces(context.Background(), batch("invalid"))
+
+	// Assert
+	assert.Error(t, err)
+	stats := b.Stats()
+	assert.Equal(t, 0, stats.Batches)
+	assert.Equal(t, uint64(1), stats.Rejected)
+}
+
+func TestBufferClientDropsRejectedBatchesItReplays(t *testing.T) {
+	// Arrange
+	client := &fakeClient{down: true, rejected: []string{"invalid"}}
+	b := newTestBufferClient(t, client, BufferOptions{Dir: t.TempDir(), MaxBackoff: 20 * time.Millisecond})
+	for _, name := range []string{"invalid", "valid"} {
+		assert.NoError(t, b.UploadTraces(context.Background(), batch(name)))
+	}
+
+	// Act
+	client.setDown(false)
+
+	// Assert
+	assert.Eventually(t, func() bool { return b.Stats().Batches == 0 }, time.Second, 5*time.Millisecond)
+	assert.Equal(t, []string{"valid"}, client.spans(), "the rejected batch should not hold back the next one")
+	assert.Equal(t, uint64(1), b.Stats().Rejected)
+}
+
+func TestIsRetryable(t *testing.T) {
+	tests := map[string]struct {
+		err      error
+		expected bool
+	}{
+		"unreachable collector": {
+			err:      errors.New("connection refused"),
+			expected: true,
+		},
+		"timeout": {
+			err:      fmt.Errorf("export: %w", context.DeadlineExceeded),
+			expected: true,
+		},
+		"grpc unavailable": {
+			err:      status.Error(codes.Unavailable, "unavailable"),
+			expected: true,
+		},
+		"grpc invalid argument": {
+			err:      status.Error(codes.InvalidArgument, "invalid"),
+			expected: false,
+		},
+		"grpc unauthenticated": {
+			err:      fmt.Errorf("traces export: %w", status.Error(codes.Unauthenticated, "no token")),
+			expected: false,
+		},
+		"http too many requests": {
+			err:      errors.New("failed to send to http://collector:4318/v1/traces: 429 Too Many Requests"),
+			expected: true,
+		},
+		"http server error": {
+			err:      errors.New("failed to send to http://collector:4318/v1/traces: 500 Internal Server Error"),
+			expected: true,
+		},
+		"http bad request": {
+			err:      fmt.Errorf("traces export: %w", errors.New("failed to send to http://collector:4318/v1/traces: 400 Bad Request")),
+			expected: false,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			// Act
+			retryable := isRetryable(test.err)
+
+			// Assert
+			assert.Equal(t, test.expected, retryable)
+		})
+	}
+}
+
+func TestBufferClientMetrics(t *testing.T) {
+	// Arrange
+	reader := sdkmetric.NewManualReader()
+	otel.SetMeterProvider(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)))
+
+	b := newTestBufferClient(t, &fakeClient{down: true}, BufferOptions{Dir: t.TempDir(), MaxBackoff: time.Hour, destination: "tempo"})
+	assert.NoError(t, b.UploadTraces(context.Background(), batch("first")))
+
+	// Act
+	var collected metricdata.ResourceMetrics
+	assert.NoError(t, reader.Collect(context.Background(), &collected))
+
+	// Assert
+	gauges := map[string]metricdata.DataPoint[int64]{}
+	for _, scope := range collected.ScopeMetrics {
+		for _, m := range scope.Metrics {
+			if gauge, ok := m.Data.(metricdata.Gauge[int64]); ok {
+				gauges[m.Name] = gauge.DataPoints[0]
+			}
+		}
+	}
+	assert.Equal(t, int64(1), gauges["trace_export.buffer.batches"].Value)
+	assert.Equal(t, attribute.NewSet(attribute.String("destination", "tempo")), gauges["trace_export.buffer.batches"].Attributes)
+	assert.Greater(t, gauges["trace_export.buffer.size"].Value, int64(0))
+}
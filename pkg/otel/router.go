@@ -0,0 +1,215 @@
+package otel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	ot "go.opentelemetry.io/otel/trace"
+)
+
+// the name of the exporter of ExporterOptions, next to the named destinations
+const DEFAULT_DESTINATION = "default"
+
+// Destination is another OTLP endpoint the traces of runs can be exported to.
+type Destination struct {
+	Name string
+	OTLP OTLPOptions
+}
+
+// Route sends the runs that match it to the destinations. A run matches when it matches a pattern
+// (of path.Match) of every list that isn't empty.
+type Route struct {
+	Orgs      []string
+	Repos     []string
+	Workflows []string
+	// the names of the destinations
+	Destinations []string
+}
+
+func (r Route) matches(run runInfo) bool {
+	org, _, _ := strings.Cut(run.repo, "/")
+	return matchesAny(r.Orgs, org) && matchesAny(r.Repos, run.repo) && matchesAny(r.Workflows, run.workflow)
+}
+
+// matchesAny is true for no patterns.
+func matchesAny(patterns []string, value string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, value); ok {
+			return true
+		}
+	}
+	return false
+}
+
+type runKey struct{}
+
+type runInfo struct {
+	// 'owner/repo'
+	repo     string
+	workflow string
+}
+
+// ContextWithRun returns a context that routes the spans started from it as spans of the workflow
+// in the repo ('owner/repo').
+func ContextWithRun(ctx context.Context, repo string, workflow string) context.Context {
+	return context.WithValue(ctx, runKey{}, runInfo{repo: repo, workflow: workflow})
+}
+
+// Router sends each span to the batch processors of the destinations its run is routed to. The
+// destinations that no route names get every span, and the runs that match no route go to every
+// destination. Spans started without the run in their context only go to the destinations that no
+// route names.
+type Router struct {
+	names      []string
+	processors map[string]*BatchProcessor
+	routes     []Route
+	defaults   []*BatchProcessor
+	// every processor, in the order of their names
+	all []*BatchProcessor
+
+	mu sync.Mutex
+	// the spans that started but didn't end yet, by their ids because the sdk ends a copy of the span
+	started map[spanKey]*startedSpan
+}
+
+type spanKey struct {
+	traceID ot.TraceID
+	spanID  ot.SpanID
+}
+
+// startedSpan counts the spans with the same ids, like the root span of a run that is traced again
+// while the trace of a redelivered webhook is still being exported.
+type startedSpan struct {
+	processors []*BatchProcessor
+	count      int
+}
+
+var _ sdktrace.SpanProcessor = (*Router)(nil)
+
+// NewRouter routes to the processors by their destination name, the routes may only name those.
+func NewRouter(processors map[string]*BatchProcessor, routes []Route) (*Router, error) {
+	r := &Router{
+		processors: processors,
+		routes:     routes,
+		started:    make(map[spanKey]*startedSpan),
+	}
+
+	routed := map[string]bool{}
+	for i, route := range routes {
+		for _, name := range route.Destinations {
+			if processors[name] == nil {
+				return nil, fmt.Errorf("route %d sends runs to the unknown destination '%s'", i, name)
+			}
+			routed[name] = true
+		}
+	}
+	for name := range processors {
+		r.names = append(r.names, name)
+	}
+	slices.Sort(r.names)
+	for _, name := range r.names {
+		r.all = append(r.all, processors[name])
+		if !routed[name] {
+			r.defaults = append(r.defaults, processors[name])
+		}
+	}
+	return r, nil
+}
+
+func (r *Router) OnStart(ctx context.Context, s sdktrace.ReadWriteSpan) {
+	processors := r.defaults
+	if run, ok := ctx.Value(runKey{}).(runInfo); ok {
+		processors = r.route(run)
+	}
+
+	key := spanKey{s.SpanContext().TraceID(), s.SpanContext().SpanID()}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if started, ok := r.started[key]; ok {
+		started.count += 1
+		return
+	}
+	r.started[key] = &startedSpan{processors: processors, count: 1}
+	for _, p := range processors {
+		p.OnStart(ctx, s)
+	}
+}
+
+// route returns the processors of the defaults and every route the run matches, in the order of
+// their names. A run that matches no route goes to every processor.
+func (r *Router) route(run runInfo) []*BatchProcessor {
+	matched := map[string]bool{}
+	for _, route := range r.routes {
+		if route.matches(run) {
+			for _, name := range route.Destinations {
+				matched[name] = true
+			}
+		}
+	}
+	if len(matched) == 0 {
+		return r.all
+	}
+
+	processors := slices.Clone(r.defaults)
+	for _, name := range r.names {
+		if matched[name] {
+			processors = append(processors, r.processors[name])
+		}
+	}
+	return processors
+}
+
+func (r *Router) OnEnd(s sdktrace.ReadOnlySpan) {
+	key := spanKey{s.SpanContext().TraceID(), s.SpanContext().SpanID()}
+	processors := r.defaults
+	r.mu.Lock()
+	if started, ok := r.started[key]; ok {
+		processors = started.processors
+		started.count -= 1
+		if started.count == 0 {
+			delete(r.started, key)
+		}
+	}
+	r.mu.Unlock()
+
+	for _, p := range processors {
+		p.OnEnd(s)
+	}
+}
+
+func (r *Router) ForceFlush(ctx context.Context) error {
+	var errs error
+	for _, name := range r.names {
+		errs = errors.Join(errs, r.processors[name].ForceFlush(ctx))
+	}
+	return errs
+}
+
+func (r *Router) Shutdown(ctx context.Context) error {
+	var errs error
+	for _, name := range r.names {
+		err := r.processors[name].Shutdown(ctx)
+		if err != nil {
+			errs = errors.Join(errs, fmt.Errorf("failed to shut down the exporter of destination '%s': %w", name, err))
+		}
+	}
+	return errs
+}
+
+// Stats returns the stats of the processor of each destination.
+func (r *Router) Stats() map[string]BatchStats {
+	stats := make(map[string]BatchStats, len(r.processors))
+	for name, p := range r.processors {
+		stats[name] = p.Stats()
+	}
+	return stats
+}
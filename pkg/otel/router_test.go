@@ -0,0 +1,83 @@
+package otel
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestRouter(t *testing.T) {
+	routes := []Route{
+		{Orgs: []string{"platform"}, Destinations: []string{"tempo"}},
+		{Repos: []string{"octo/*"}, Workflows: []string{"release"}, Destinations: []string{"tempo", "archive"}},
+	}
+
+	tests := map[string]struct {
+		givenContext  func(ctx context.Context) context.Context
+		expectedSpans map[string]int
+	}{
+		"unmatched run goes everywhere": {
+			givenContext:  func(ctx context.Context) context.Context { return ContextWithRun(ctx, "octo/web", "ci") },
+			expectedSpans: map[string]int{"default": 2, "tempo": 2, "archive": 2},
+		},
+		"run of an org": {
+			givenContext:  func(ctx context.Context) context.Context { return ContextWithRun(ctx, "platform/infra", "ci") },
+			expectedSpans: map[string]int{"default": 2, "tempo": 2, "archive": 0},
+		},
+		"run matching every list of a route": {
+			givenContext:  func(ctx context.Context) context.Context { return ContextWithRun(ctx, "octo/web", "release") },
+			expectedSpans: map[string]int{"default": 2, "tempo": 2, "archive": 2},
+		},
+		"span without a run": {
+			givenContext:  func(ctx context.Context) context.Context { return ctx },
+			expectedSpans: map[string]int{"default": 2, "tempo": 0, "archive": 0},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			// Arrange
+			exporters := map[string]*tracetest.InMemoryExporter{}
+			processors := map[string]*BatchProcessor{}
+			for _, name := range []string{"default", "tempo", "archive"} {
+				exporters[name] = tracetest.NewInMemoryExporter()
+				processors[name] = NewBatchProcessor(exporters[name], BatchOptions{Interval: time.Hour, FlushOnRootEnd: true})
+			}
+			router, err := NewRouter(processors, routes)
+			assert.NoError(t, err)
+			provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(router))
+			tracer := provider.Tracer("test")
+
+			// Act
+			ctx, run := tracer.Start(test.givenContext(context.Background()), "run")
+			_, job := tracer.Start(ctx, "job")
+			job.End()
+			run.End()
+
+			// Assert
+			for name, expected := range test.expectedSpans {
+				assert.Len(t, exporters[name].GetSpans(), expected, name)
+			}
+			assert.Empty(t, router.started, "the spans should be forgotten once they end")
+			assert.NoError(t, provider.Shutdown(context.Background()))
+		})
+	}
+}
+
+func TestNewRouterRejectsUnknownDestination(t *testing.T) {
+	// Arrange
+	processors := map[string]*BatchProcessor{"default": NewBatchProcessor(tracetest.NewInMemoryExporter(), BatchOptions{})}
+	defer processors["default"].Shutdown(context.Background())
+
+	// Act
+	_, err := NewRouter(processors, []Route{{Orgs: []string{"octo"}, Destinations: []string{"tempo"}}})
+
+	// Assert
+	assert.EqualError(t, err, "route 0 sends runs to the unknown destination 'tempo'")
+}
@@ -5,13 +5,12 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
+	"strconv"
 	"time"
 
-	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials/insecure"
-
 	"go.opentelemetry.io/otel"
-	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
 	"go.opentelemetry.io/otel/sdk/resource"
 	sdktrace "go.opentelemetry.io/otel/sdk/trace"
@@ -21,13 +20,53 @@ import (
 
 const CLOUD_RUN_EXECUTION_KEY string = "CLOUD_RUN_EXECUTION"
 const CLOUD_RUN_TASK_INDEX_KEY string = "CLOUD_RUN_TASK_INDEX"
+const CLOUD_RUN_TASK_COUNT_KEY string = "CLOUD_RUN_TASK_COUNT"
 
 const SERVICE_TRACER_NAME = "github.com/pitoniak32/trace-export"
 const workflowRunTracerName = "github.com/pitoniak32/trace-export/workflow_run"
 
+// the service.name of the traces of runs, unless the resource of runs is templated
+const workflowRunServiceName = "trace-workflow-run"
+
+// ExporterOptions decide where the spans are exported to. They are written to files when a file
+// directory is set, posted to Zipkin when its endpoint is set, sent to the OTLP endpoint when it is
+// set, and pretty printed to stdout otherwise.
+// The traces of runs can also be exported to more destinations, only the service spans can't.
+type ExporterOptions struct {
+	OTLP         OTLPOptions
+	File         FileOptions
+	Zipkin       ZipkinOptions
+	Batch        BatchOptions
+	Destinations []Destination
+	Routes       []Route
+	// the resource of each run, only the traces of runs use it
+	Resource ResourceOptions
+	// the resource detectors of both tracer providers, like RESOURCE_DETECTOR_HOST
+	Detectors []string
+	// the batches of each OTLP destination are kept in a directory of the buffer named after it
+	Buffer BufferOptions
+}
+
+// ExporterStats counts the spans of the tracer providers, for the workflow runs by destination.
+type ExporterStats struct {
+	WorkflowRun map[string]BatchStats `json:"workflow_run"`
+	Service     BatchStats            `json:"service"`
+	// the number of resources of runs that have a tracer provider
+	Resources int `json:"resources"`
+}
+
+type FileOptions struct {
+	Dir string
+	// FILE_SPLIT_RUN or FILE_SPLIT_SIZE
+	Split    string
+	MaxBytes int64
+}
+
 // setupOTelSDK bootstraps the OpenTelemetry pipeline.
 // If it does not return an error, make sure to call shutdown for proper cleanup.
-func SetupOTelSDK(ctx context.Context, otlpEndpoint string) (serviceTracer ot.Tracer, workflowRunTracer ot.Tracer, shutdown func(context.Context) error, err error) {
+// The trace of a run is exported when its root span ends, stats counts the spans that were exported
+// and dropped. The metrics of the service are exported to the OTLP endpoint when the spans are.
+func SetupOTelSDK(ctx context.Context, opts ExporterOptions) (serviceTracer ot.Tracer, workflowRunTracer ot.Tracer, stats func() ExporterStats, shutdown func(context.Context) error, err error) {
 	var shutdownFuncs []func(context.Context) error
 
 	// shutdown calls cleanup functions registered via shutdownFuncs.
@@ -48,36 +87,41 @@ func SetupOTelSDK(ctx context.Context, otlpEndpoint string) (serviceTracer ot.Tr
 	}
 
 	// Set up trace provider for workflow run traces.
-	wfResource, err := resource.New(
-		ctx,
-		resource.WithTelemetrySDK(),
-		resource.WithAttributes(
-			semconv.ServiceName("trace-workflow-run"),
-			semconv.GCPCloudRunJobExecution(os.Getenv(CLOUD_RUN_EXECUTION_KEY)),
-		),
-	)
+	wfResource, err := newResource(ctx, workflowRunServiceName, false, opts.Detectors)
 	if err != nil {
-		panic(fmt.Sprintf("failed to setup workflow run tracer provider resource: %s", err))
+		handleErr(err)
+		return
 	}
-	tracerProviderWorkflowRun, err := NewTracerProvider(otlpEndpoint, *wfResource)
+	workflowRunOpts := opts
+	workflowRunOpts.Batch.FlushOnRootEnd = true
+	tracerProviderWorkflowRun, workflowRunRouter, err := NewTracerProvider(workflowRunOpts, *wfResource)
 	if err != nil {
 		handleErr(err)
 		return
 	}
 	shutdownFuncs = append(shutdownFuncs, tracerProviderWorkflowRun.Shutdown)
 	workflowRunTracer = tracerProviderWorkflowRun.Tracer(workflowRunTracerName)
+	var resourceTracer *ResourceTracer
+	if opts.Resource.enabled() {
+		resourceTracer = NewResourceTracer(workflowRunTracerName, workflowRunTracer, *wfResource, workflowRunRouter, opts.Resource)
+		workflowRunTracer = resourceTracer
+	}
 
 	// We need to create a new tracer provider here to use for our service traces
 	// because the global one is used for the traces of workflow runs.
-	sResource, err := resource.New(
-		ctx,
-		resource.WithTelemetrySDK(),
-		resource.WithAttributes(semconv.ServiceName("trace-export-service")),
-	)
+	sResource, err := newResource(ctx, "trace-export-service", true, opts.Detectors)
 	if err != nil {
-		panic(fmt.Sprintf("failed to setup service tracer provider resource: %s", err))
+		handleErr(err)
+		return
 	}
-	tracerProviderService, err := NewTracerProvider(otlpEndpoint, *sResource)
+	// the service spans aren't part of a run, a file per trace would be a file per request
+	serviceOpts := opts
+	serviceOpts.File.Split = FILE_SPLIT_SIZE
+	serviceOpts.Batch.FlushOnRootEnd = false
+	// the service spans aren't worth keeping on disk
+	serviceOpts.Destinations, serviceOpts.Routes, serviceOpts.Buffer = nil, nil, BufferOptions{}
+	serviceOpts.Resource = ResourceOptions{}
+	tracerProviderService, serviceRouter, err := NewTracerProvider(serviceOpts, *sResource)
 	if err != nil {
 		handleErr(err)
 		return
@@ -86,31 +130,109 @@ func SetupOTelSDK(ctx context.Context, otlpEndpoint string) (serviceTracer ot.Tr
 	otel.SetTracerProvider(tracerProviderService)
 	serviceTracer = tracerProviderService.Tracer(SERVICE_TRACER_NAME)
 
+	// the metrics of the service, like the depth of the export buffer, go where the spans go over OTLP
+	if opts.exportsOTLP() {
+		meterProvider, meterErr := NewMeterProvider(ctx, opts.OTLP, *sResource)
+		if meterErr != nil {
+			handleErr(meterErr)
+			return
+		}
+		shutdownFuncs = append(shutdownFuncs, meterProvider.Shutdown)
+		otel.SetMeterProvider(meterProvider)
+	}
+
+	stats = func() ExporterStats {
+		stats := ExporterStats{WorkflowRun: workflowRunRouter.Stats(), Service: serviceRouter.Stats()[DEFAULT_DESTINATION]}
+		if resourceTracer != nil {
+			stats.Resources = resourceTracer.Resources()
+		}
+		return stats
+	}
 	return
 }
 
-func NewTracerProvider(otlpEndpoint string, resource resource.Resource) (*sdktrace.TracerProvider, error) {
+// cloudRunJobAttributes describes the Cloud Run job task we are running as, so the spans of each
+// task of a sharded backfill can be told apart.
+func cloudRunJobAttributes() []attribute.KeyValue {
+	attributes := []attribute.KeyValue{
+		semconv.GCPCloudRunJobExecution(os.Getenv(CLOUD_RUN_EXECUTION_KEY)),
+	}
+	if index, err := strconv.Atoi(os.Getenv(CLOUD_RUN_TASK_INDEX_KEY)); err == nil {
+		attributes = append(attributes, semconv.GCPCloudRunJobTaskIndex(index))
+	}
+	if count, err := strconv.Atoi(os.Getenv(CLOUD_RUN_TASK_COUNT_KEY)); err == nil {
+		attributes = append(attributes, attribute.Int("gcp.cloud_run.job.task_count", count))
+	}
+	return attributes
+}
 
-	var exporter sdktrace.SpanExporter
-	if otlpEndpoint == "" {
-		var err error
-		exporter, err = stdouttrace.New(
-			stdouttrace.WithPrettyPrint())
+// NewTracerProvider creates a provider that exports the spans in batches, to the destinations their
+// runs are routed to by the router it returns.
+func NewTracerProvider(opts ExporterOptions, resource resource.Resource) (*sdktrace.TracerProvider, *Router, error) {
+	exporter, err := newExporter(opts, resource)
+	if err != nil {
+		return nil, nil, err
+	}
+	exporters := map[string]sdktrace.SpanExporter{DEFAULT_DESTINATION: exporter}
+	for _, destination := range opts.Destinations {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		exporter, err := NewBufferedOTLPExporter(ctx, destination.OTLP, opts.buffer(destination.Name))
+		cancel()
 		if err != nil {
-			return nil, fmt.Errorf("failed to create stdout trace exporter: %w", err)
+			for _, created := range exporters {
+				_ = created.Shutdown(context.Background())
+			}
+			return nil, nil, fmt.Errorf("destination '%s': %w", destination.Name, err)
 		}
-	} else {
-		ctx := context.Background()
-		ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
-		defer cancel()
-		conn, err := grpc.NewClient(otlpEndpoint, grpc.WithTransportCredentials(insecure.NewCredentials()))
+		exporters[destination.Name] = exporter
+	}
+
+	processors := make(map[string]*BatchProcessor, len(exporters))
+	for name, exporter := range exporters {
+		processors[name] = NewBatchProcessor(exporter, opts.Batch)
+	}
+	router, err := NewRouter(processors, opts.Routes)
+	if err != nil {
+		for _, processor := range processors {
+			_ = processor.Shutdown(context.Background())
+		}
+		return nil, nil, err
+	}
+
+	traceProvider := sdktrace.NewTracerProvider(
+		sdktrace.WithResource(&resource),
+		sdktrace.WithIDGenerator(NewIDGenerator()),
+		sdktrace.WithSpanProcessor(router),
+	)
+	return traceProvider, router, nil
+}
+
+// newExporter creates the exporter of the default destination.
+func newExporter(opts ExporterOptions, resource resource.Resource) (sdktrace.SpanExporter, error) {
+	if opts.File.Dir != "" {
+		exporter, err := NewFileExporter(opts.File.Dir, serviceName(resource), opts.File.Split, opts.File.MaxBytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create file trace exporter: %w", err)
+		}
+		return exporter, nil
+	}
+
+	// the retry buffer only keeps OTLP batches
+	if opts.Zipkin.Endpoint != "" {
+		exporter, err := NewZipkinExporter(opts.Zipkin)
 		if err != nil {
-			return nil, fmt.Errorf("failed to create gRPC connection to collector: %w", err)
+			return nil, fmt.Errorf("failed to create zipkin trace exporter: %w", err)
 		}
-		exporter, err = otlptracegrpc.New(ctx, otlptracegrpc.WithGRPCConn(conn))
+		return exporter, nil
+	}
+
+	if opts.OTLP.Endpoint == "" {
+		exporter, err := stdouttrace.New(
+			stdouttrace.WithPrettyPrint())
 		if err != nil {
-			return nil, fmt.Errorf("failed to create grpc OTLP trace exporter: %w", err)
+			return nil, fmt.Errorf("failed to create stdout trace exporter: %w", err)
 		}
+		return exporter, nil
 	}
 
 	// Google exporter
@@ -119,11 +241,22 @@ func NewTracerProvider(otlpEndpoint string, resource resource.Resource) (*sdktra
 	// 	panic(fmt.Sprintf("Could not create trace exporter %s", err))
 	// }
 
-	traceProvider := sdktrace.NewTracerProvider(
-		sdktrace.WithResource(&resource),
-		sdktrace.WithSyncer(
-			exporter,
-		),
-	)
-	return traceProvider, nil
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return NewBufferedOTLPExporter(ctx, opts.OTLP, opts.buffer(DEFAULT_DESTINATION))
+}
+
+// exportsOTLP reports whether the default destination is the OTLP endpoint, see newExporter.
+func (o ExporterOptions) exportsOTLP() bool {
+	return o.File.Dir == "" && o.Zipkin.Endpoint == "" && o.OTLP.Endpoint != ""
+}
+
+// buffer returns the buffer options of the destination.
+func (o ExporterOptions) buffer(destination string) BufferOptions {
+	buffer := o.Buffer
+	if buffer.Dir != "" {
+		buffer.Dir = filepath.Join(buffer.Dir, destination)
+	}
+	buffer.destination = destination
+	return buffer
 }
@@ -0,0 +1,163 @@
+package otel
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"os"
+	"sync"
+	"time"
+)
+
+// certFiles holds the client certificate and the CAs from their files, and reads them again when
+// the files change, so renewed certificates are used without a restart. The files are checked on
+// every handshake, which only happens when a connection is made.
+type certFiles struct {
+	certFile string
+	keyFile  string
+	caFile   string
+	// the name the certificate of the collector is verified against
+	serverName string
+
+	mu     sync.Mutex
+	stamps map[string]fileStamp
+	cert   *tls.Certificate
+	roots  *x509.CertPool
+}
+
+// fileStamp tells when a file was changed, without reading it.
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// newCertFiles reads the files, the client certificate and key are optional, and so are the CAs. The
+// certificate of the collector is verified against the server name (a host name or an ip) when
+// there are CAs.
+func newCertFiles(certFile string, keyFile string, caFile string, serverName string) (*certFiles, error) {
+	if (certFile == "") != (keyFile == "") {
+		return nil, errors.New("both a client certificate and key are required for mTLS")
+	}
+	if caFile != "" && serverName == "" {
+		return nil, errors.New("the host of the OTLP endpoint, or a server name, is required to verify the certificate of the collector")
+	}
+
+	c := &certFiles{certFile: certFile, keyFile: keyFile, caFile: caFile, serverName: serverName}
+	stamps, err := c.stat()
+	if err != nil {
+		return nil, err
+	}
+	err = c.load(stamps)
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// apply sets the client certificate and the verification of the collector on the config.
+func (c *certFiles) apply(config *tls.Config) {
+	if c.certFile != "" {
+		config.GetClientCertificate = c.clientCertificate
+	}
+	if c.caFile != "" {
+		// the roots of a config can't change, so the certificate of the collector is verified here
+		// instead, with the CAs from the file as they are now
+		config.InsecureSkipVerify = true
+		config.VerifyConnection = c.verifyConnection
+	}
+}
+
+func (c *certFiles) clientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.reloadIfChanged()
+	return c.cert, nil
+}
+
+func (c *certFiles) verifyConnection(state tls.ConnectionState) error {
+	c.mu.Lock()
+	c.reloadIfChanged()
+	roots := c.roots
+	c.mu.Unlock()
+
+	if len(state.PeerCertificates) == 0 {
+		return errors.New("the collector didn't send a certificate")
+	}
+	intermediates := x509.NewCertPool()
+	for _, cert := range state.PeerCertificates[1:] {
+		intermediates.AddCert(cert)
+	}
+	// not the server name of the handshake, it is empty when no SNI was sent (like for an ip) and
+	// then any certificate of the CAs would be accepted
+	_, err := state.PeerCertificates[0].Verify(x509.VerifyOptions{
+		DNSName:       c.serverName,
+		Roots:         roots,
+		Intermediates: intermediates,
+	})
+	return err
+}
+
+// reloadIfChanged must be called with the lock held. The files are kept when they fail to load,
+// like when the certificate was replaced but its key not yet.
+func (c *certFiles) reloadIfChanged() {
+	stamps, err := c.stat()
+	if err != nil {
+		slog.Error("failed to check the OTLP certificates, using the current ones", "err", err)
+		return
+	}
+	if maps.EqualFunc(stamps, c.stamps, func(a fileStamp, b fileStamp) bool { return a.modTime.Equal(b.modTime) && a.size == b.size }) {
+		return
+	}
+
+	err = c.load(stamps)
+	if err != nil {
+		slog.Error("failed to reload the OTLP certificates, using the current ones", "err", err)
+		return
+	}
+	slog.Info("reloaded the OTLP certificates")
+}
+
+// load must be called with the lock held, or before the files are used.
+func (c *certFiles) load(stamps map[string]fileStamp) error {
+	var cert *tls.Certificate
+	if c.certFile != "" {
+		loaded, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+		if err != nil {
+			return fmt.Errorf("failed to load the OTLP client certificate: %w", err)
+		}
+		cert = &loaded
+	}
+
+	var roots *x509.CertPool
+	if c.caFile != "" {
+		pem, err := os.ReadFile(c.caFile)
+		if err != nil {
+			return fmt.Errorf("failed to read OTLP certificate: %w", err)
+		}
+		roots = x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(pem) {
+			return errors.New("failed to read OTLP certificate: no PEM encoded certificates in " + c.caFile)
+		}
+	}
+
+	c.cert, c.roots, c.stamps = cert, roots, stamps
+	return nil
+}
+
+func (c *certFiles) stat() (map[string]fileStamp, error) {
+	stamps := make(map[string]fileStamp, 3)
+	for _, name := range []string{c.certFile, c.keyFile, c.caFile} {
+		if name == "" {
+			continue
+		}
+		info, err := os.Stat(name)
+		if err != nil {
+			return nil, err
+		}
+		stamps[name] = fileStamp{modTime: info.ModTime(), size: info.Size()}
+	}
+	return stamps, nil
+}
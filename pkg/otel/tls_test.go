@@ -0,0 +1,259 @@
+package otel
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// testCert is a certificate with its key, signed by the CA it was issued by.
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCert(t *testing.T, name string, parent *testCert) testCert {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	signer, signerKey := template, key
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage |= x509.KeyUsageCertSign
+	} else {
+		signer, signerKey = parent.cert, parent.key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	cert, err := x509.ParseCertificate(der)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	return testCert{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+func (c testCert) keyPEM(t *testing.T) []byte {
+	t.Helper()
+	der, err := x509.MarshalECPrivateKey(c.key)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+}
+
+// writeFile writes the file with the modification time, so a rewrite within the
+// resolution of the file system is still seen as a change.
+func writeFile(t *testing.T, path string, data []byte, modTime time.Time) {
+	t.Helper()
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatalf("writing %s failed: %s", path, err)
+	}
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatalf("writing %s failed: %s", path, err)
+	}
+}
+
+func TestNewOTLPExporterMTLS(t *testing.T) {
+	// Arrange
+	ca := newTestCert(t, "test ca", nil)
+	serverCert := newTestCert(t, "collector.internal", &ca)
+	clientCert := newTestCert(t, "trace-export", &ca)
+
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+	clients := make(chan string, 1)
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		clients <- r.TLS.PeerCertificates[0].Subject.CommonName
+	}))
+	server.TLS = &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{serverCert.cert.Raw}, PrivateKey: serverCert.key}},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    pool,
+	}
+	server.StartTLS()
+	defer server.Close()
+
+	dir := t.TempDir()
+	now := time.Now()
+	writeFile(t, filepath.Join(dir, "ca.pem"), ca.pem, now)
+	writeFile(t, filepath.Join(dir, "client.pem"), clientCert.pem, now)
+	writeFile(t, filepath.Join(dir, "client-key.pem"), clientCert.keyPEM(t), now)
+
+	exporter, err := NewOTLPExporter(context.Background(), OTLPOptions{
+		Endpoint:          server.URL,
+		Protocol:          OTLP_PROTOCOL_HTTP,
+		Certificate:       filepath.Join(dir, "ca.pem"),
+		ClientCertificate: filepath.Join(dir, "client.pem"),
+		ClientKey:         filepath.Join(dir, "client-key.pem"),
+		ServerName:        "collector.internal",
+	})
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter), sdktrace.WithResource(resource.Empty()))
+
+	// Act
+	_, span := provider.Tracer("test").Start(context.Background(), "run")
+	span.End()
+
+	// Assert
+	assert.Equal(t, "trace-export", <-clients)
+	assert.NoError(t, provider.Shutdown(context.Background()))
+}
+
+func TestNewOTLPExporterTLSWithoutHTTPS(t *testing.T) {
+	// Act
+	_, err := NewOTLPExporter(context.Background(), OTLPOptions{
+		Endpoint:    "localhost:4317",
+		Insecure:    true,
+		Certificate: "ca.pem",
+	})
+
+	// Assert
+	assert.EqualError(t, err, "the OTLP endpoint 'localhost:4317' doesn't use TLS, but certificates or a server name are configured. Use an https url, or turn off insecure")
+}
+
+func TestCertFilesReload(t *testing.T) {
+	tests := map[string]struct {
+		givenRotatedKey bool
+		expectedName    string
+	}{
+		"rotated certificate and key": {
+			givenRotatedKey: true,
+			expectedName:    "renewed",
+		},
+		"certificate rotated before its key keeps the old one": {
+			givenRotatedKey: false,
+			expectedName:    "original",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			// Arrange
+			ca := newTestCert(t, "test ca", nil)
+			original := newTestCert(t, "original", &ca)
+			renewed := newTestCert(t, "renewed", &ca)
+
+			dir := t.TempDir()
+			certFile, keyFile := filepath.Join(dir, "client.pem"), filepath.Join(dir, "client-key.pem")
+			now := time.Now()
+			writeFile(t, certFile, original.pem, now)
+			writeFile(t, keyFile, original.keyPEM(t), now)
+
+			files, err := newCertFiles(certFile, keyFile, "", "")
+			if !assert.NoError(t, err) {
+				t.FailNow()
+			}
+
+			// Act
+			writeFile(t, certFile, renewed.pem, now.Add(time.Minute))
+			if test.givenRotatedKey {
+				writeFile(t, keyFile, renewed.keyPEM(t), now.Add(time.Minute))
+			}
+			cert, err := files.clientCertificate(nil)
+
+			// Assert
+			if !assert.NoError(t, err) {
+				t.FailNow()
+			}
+			leaf, err := x509.ParseCertificate(cert.Certificate[0])
+			if !assert.NoError(t, err) {
+				t.FailNow()
+			}
+			assert.Equal(t, test.expectedName, leaf.Subject.CommonName)
+		})
+	}
+}
+
+func TestNewCertFilesRequiresKey(t *testing.T) {
+	// Act
+	_, err := newCertFiles("client.pem", "", "", "")
+
+	// Assert
+	assert.EqualError(t, err, "both a client certificate and key are required for mTLS")
+}
+
+func TestCertFilesVerifiesTheCollectorName(t *testing.T) {
+	ca := newTestCert(t, "test ca", nil)
+	collector := newTestCert(t, "collector.internal", &ca)
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	writeFile(t, caFile, ca.pem, time.Now())
+
+	tests := map[string]struct {
+		serverName  string
+		expectedErr bool
+	}{
+		"name of the certificate": {serverName: "collector.internal"},
+		"other name":              {serverName: "other.internal", expectedErr: true},
+		// no SNI is sent for an ip, the name of the handshake is empty
+		"ip the certificate isn't for": {serverName: "127.0.0.1", expectedErr: true},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			// Arrange
+			files, err := newCertFiles("", "", caFile, test.serverName)
+			if !assert.NoError(t, err) {
+				t.FailNow()
+			}
+
+			// Act
+			err = files.verifyConnection(tls.ConnectionState{PeerCertificates: []*x509.Certificate{collector.cert}})
+
+			// Assert
+			if test.expectedErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestNewCertFilesRequiresServerName(t *testing.T) {
+	// Act
+	_, err := newCertFiles("", "", "ca.pem", "")
+
+	// Assert
+	assert.EqualError(t, err, "the host of the OTLP endpoint, or a server name, is required to verify the certificate of the collector")
+}
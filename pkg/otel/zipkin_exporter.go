@@ -0,0 +1,258 @@
+package otel
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	ot "go.opentelemetry.io/otel/trace"
+)
+
+// the timeout of OTEL_EXPORTER_ZIPKIN_TIMEOUT when none is set
+const DEFAULT_ZIPKIN_TIMEOUT = 10 * time.Second
+
+// the attributes of the spans of jobs and steps that are mapped to the zipkin model
+const (
+	runnerNameKey = attribute.Key("workflow_job.runner_name")
+	// the conclusions of runs, jobs and steps that mark their spans as errors
+	runConclusionKey  = attribute.Key("workflow_run.conclusion")
+	jobConclusionKey  = attribute.Key("workflow_job.conclusion")
+	stepConclusionKey = attribute.Key("step.conclusion")
+)
+
+// the conclusions of GitHub that are errors, cancelled and skipped runs didn't fail
+var errorConclusions = []string{"failure", "timed_out", "startup_failure"}
+
+// ZipkinOptions are the settings of the OTEL_EXPORTER_ZIPKIN_* environment variables.
+type ZipkinOptions struct {
+	// the url the spans are posted to, like 'http://localhost:9411/api/v2/spans'
+	Endpoint string
+	// DEFAULT_ZIPKIN_TIMEOUT is used when zero
+	Timeout time.Duration
+}
+
+// ZipkinExporter posts the spans as Zipkin v2 JSON, for backends without an OTLP receiver. The
+// local endpoint of a span is the service, except for the spans of jobs and their steps, which are
+// named after the runner the job ran on. Zipkin has no status, so failed runs, jobs and steps get an
+// error tag with their conclusion.
+type ZipkinExporter struct {
+	endpoint string
+	client   *http.Client
+
+	mu     sync.Mutex
+	closed bool
+}
+
+var _ sdktrace.SpanExporter = (*ZipkinExporter)(nil)
+
+func NewZipkinExporter(opts ZipkinOptions) (*ZipkinExporter, error) {
+	if !strings.HasPrefix(opts.Endpoint, "http://") && !strings.HasPrefix(opts.Endpoint, "https://") {
+		return nil, fmt.Errorf("the zipkin endpoint '%s' must be an http or https url", opts.Endpoint)
+	}
+	timeout := opts.Timeout
+	if timeout <= 0 {
+		timeout = DEFAULT_ZIPKIN_TIMEOUT
+	}
+	return &ZipkinExporter{endpoint: opts.Endpoint, client: &http.Client{Timeout: timeout}}, nil
+}
+
+func (e *ZipkinExporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	if len(spans) == 0 {
+		return nil
+	}
+
+	e.mu.Lock()
+	closed := e.closed
+	e.mu.Unlock()
+	if closed {
+		return errors.New("zipkin exporter is shut down")
+	}
+
+	body, err := json.Marshal(newZipkinSpans(spans))
+	if err != nil {
+		return fmt.Errorf("failed to encode spans: %w", err)
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, e.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create zipkin request: %w", err)
+	}
+	request.Header.Set("Content-Type", "application/json")
+
+	response, err := e.client.Do(request)
+	if err != nil {
+		return fmt.Errorf("failed to export spans to zipkin: %w", err)
+	}
+	defer response.Body.Close()
+	// the start of the body explains why a batch was rejected
+	message, _ := io.ReadAll(io.LimitReader(response.Body, 1<<10))
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return fmt.Errorf("zipkin returned %s: %s", response.Status, strings.TrimSpace(string(message)))
+	}
+	return nil
+}
+
+func (e *ZipkinExporter) Shutdown(ctx context.Context) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.closed = true
+	e.client.CloseIdleConnections()
+	return nil
+}
+
+// The Zipkin v2 JSON model, see https://zipkin.io/zipkin-api/#/default/post_spans. Times are in
+// microseconds, ids are hex encoded and the tags are strings.
+
+type zipkinSpan struct {
+	TraceID       string             `json:"traceId"`
+	ID            string             `json:"id"`
+	ParentID      string             `json:"parentId,omitempty"`
+	Name          string             `json:"name"`
+	Kind          string             `json:"kind,omitempty"`
+	Timestamp     int64              `json:"timestamp"`
+	Duration      int64              `json:"duration"`
+	LocalEndpoint zipkinEndpoint     `json:"localEndpoint"`
+	Annotations   []zipkinAnnotation `json:"annotations,omitempty"`
+	Tags          map[string]string  `json:"tags,omitempty"`
+}
+
+type zipkinEndpoint struct {
+	ServiceName string `json:"serviceName"`
+}
+
+type zipkinAnnotation struct {
+	Timestamp int64  `json:"timestamp"`
+	Value     string `json:"value"`
+}
+
+// newZipkinSpans keeps the order of the spans. Steps are named after the runner of their job when
+// the job is exported with them, like when the trace of a run is exported when it ends.
+func newZipkinSpans(spans []sdktrace.ReadOnlySpan) []zipkinSpan {
+	runners := map[ot.SpanID]string{}
+	for _, span := range spans {
+		if runner := attributeValue(span.Attributes(), runnerNameKey); runner != "" {
+			runners[span.SpanContext().SpanID()] = runner
+		}
+	}
+
+	zipkinSpans := make([]zipkinSpan, 0, len(spans))
+	for _, span := range spans {
+		res := span.Resource()
+		if res == nil {
+			res = resource.Empty()
+		}
+		name := serviceName(*res)
+		if runner, ok := runners[span.SpanContext().SpanID()]; ok {
+			name = runner
+		} else if runner, ok := runners[span.Parent().SpanID()]; ok {
+			name = runner
+		}
+		zipkinSpans = append(zipkinSpans, newZipkinSpan(span, name))
+	}
+	return zipkinSpans
+}
+
+func newZipkinSpan(span sdktrace.ReadOnlySpan, serviceName string) zipkinSpan {
+	sc := span.SpanContext()
+	s := zipkinSpan{
+		TraceID:       sc.TraceID().String(),
+		ID:            sc.SpanID().String(),
+		Name:          span.Name(),
+		Kind:          zipkinKind(span.SpanKind()),
+		Timestamp:     span.StartTime().UnixMicro(),
+		Duration:      span.EndTime().Sub(span.StartTime()).Microseconds(),
+		LocalEndpoint: zipkinEndpoint{ServiceName: serviceName},
+		Tags:          zipkinTags(span),
+	}
+	if span.Parent().IsValid() {
+		s.ParentID = span.Parent().SpanID().String()
+	}
+	for _, event := range span.Events() {
+		value := event.Name
+		if len(event.Attributes) > 0 {
+			attributes := make(map[string]string, len(event.Attributes))
+			for _, kv := range event.Attributes {
+				attributes[string(kv.Key)] = kv.Value.Emit()
+			}
+			encoded, _ := json.Marshal(attributes)
+			value = fmt.Sprintf("%s: %s", event.Name, encoded)
+		}
+		s.Annotations = append(s.Annotations, zipkinAnnotation{Timestamp: event.Time.UnixMicro(), Value: value})
+	}
+	return s
+}
+
+// zipkinKind is empty for internal spans, which Zipkin doesn't have a kind for.
+func zipkinKind(kind ot.SpanKind) string {
+	switch kind {
+	case ot.SpanKindServer:
+		return "SERVER"
+	case ot.SpanKindClient:
+		return "CLIENT"
+	case ot.SpanKindProducer:
+		return "PRODUCER"
+	case ot.SpanKindConsumer:
+		return "CONSUMER"
+	default:
+		return ""
+	}
+}
+
+// zipkinTags are the attributes of the span, with the tags the OpenTelemetry exporters add for the
+// scope and status. The error tag holds the description of an error status, or the conclusion of a
+// run, job or step that failed.
+func zipkinTags(span sdktrace.ReadOnlySpan) map[string]string {
+	tags := make(map[string]string, len(span.Attributes())+3)
+	for _, kv := range span.Attributes() {
+		tags[string(kv.Key)] = kv.Value.Emit()
+	}
+
+	if scope := span.InstrumentationScope(); scope.Name != "" {
+		tags["otel.scope.name"] = scope.Name
+		if scope.Version != "" {
+			tags["otel.scope.version"] = scope.Version
+		}
+	}
+
+	switch span.Status().Code {
+	case codes.Error:
+		tags["otel.status_code"] = "ERROR"
+		tags["error"] = span.Status().Description
+	case codes.Ok:
+		tags["otel.status_code"] = "OK"
+	}
+	if _, ok := tags["error"]; !ok {
+		for _, key := range []attribute.Key{stepConclusionKey, jobConclusionKey, runConclusionKey} {
+			if conclusion := tags[string(key)]; slices.Contains(errorConclusions, conclusion) {
+				tags["error"] = conclusion
+				break
+			}
+		}
+	}
+
+	if len(tags) == 0 {
+		return nil
+	}
+	return tags
+}
+
+func attributeValue(attributes []attribute.KeyValue, key attribute.Key) string {
+	for _, kv := range attributes {
+		if kv.Key == key {
+			return kv.Value.Emit()
+		}
+	}
+	return ""
+}
@@ -0,0 +1,103 @@
+package otel
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.27.0"
+	ot "go.opentelemetry.io/otel/trace"
+)
+
+func TestZipkinExporter(t *testing.T) {
+	// Arrange
+	posted := make(chan []zipkinSpan, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var spans []zipkinSpan
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&spans))
+		posted <- spans
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	exporter, err := NewZipkinExporter(ZipkinOptions{Endpoint: server.URL + "/api/v2/spans"})
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithSpanProcessor(NewBatchProcessor(exporter, BatchOptions{Interval: time.Hour, FlushOnRootEnd: true})),
+		sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceName("trace-workflow-run"))),
+	)
+	tracer := provider.Tracer("test")
+	start := time.Unix(1700000000, 0)
+
+	// Act
+	ctx, run := tracer.Start(context.Background(), "ci", ot.WithTimestamp(start), ot.WithAttributes(
+		attribute.String("workflow_run.conclusion", "failure"),
+	))
+	ctx, job := tracer.Start(ctx, "build", ot.WithTimestamp(start.Add(time.Second)), ot.WithAttributes(
+		attribute.String("workflow_job.runner_name", "runner-1"),
+		attribute.String("workflow_job.conclusion", "success"),
+	))
+	_, step := tracer.Start(ctx, "test", ot.WithTimestamp(start.Add(2*time.Second)), ot.WithAttributes(
+		attribute.Int64("step.number", 2),
+		attribute.String("step.conclusion", "timed_out"),
+	))
+	step.End(ot.WithTimestamp(start.Add(3 * time.Second)))
+	job.End(ot.WithTimestamp(start.Add(4 * time.Second)))
+	run.End(ot.WithTimestamp(start.Add(5 * time.Second)))
+
+	// Assert
+	spans := <-posted
+	if !assert.Len(t, spans, 3) {
+		t.FailNow()
+	}
+	stepSpan, jobSpan, runSpan := spans[0], spans[1], spans[2]
+
+	assert.Equal(t, run.SpanContext().TraceID().String(), runSpan.TraceID)
+	assert.Empty(t, runSpan.ParentID)
+	assert.Equal(t, start.UnixMicro(), runSpan.Timestamp)
+	assert.Equal(t, (5 * time.Second).Microseconds(), runSpan.Duration)
+	assert.Equal(t, "trace-workflow-run", runSpan.LocalEndpoint.ServiceName)
+	assert.Equal(t, "failure", runSpan.Tags["error"])
+
+	assert.Equal(t, run.SpanContext().SpanID().String(), jobSpan.ParentID)
+	assert.Equal(t, "runner-1", jobSpan.LocalEndpoint.ServiceName)
+	assert.NotContains(t, jobSpan.Tags, "error")
+	assert.Equal(t, "test", jobSpan.Tags["otel.scope.name"])
+
+	assert.Equal(t, job.SpanContext().SpanID().String(), stepSpan.ParentID)
+	assert.Equal(t, "runner-1", stepSpan.LocalEndpoint.ServiceName, "steps should be named after the runner of their job")
+	assert.Equal(t, "2", stepSpan.Tags["step.number"])
+	assert.Equal(t, "timed_out", stepSpan.Tags["error"])
+
+	assert.NoError(t, provider.Shutdown(context.Background()))
+}
+
+func TestZipkinExporterReturnsRejection(t *testing.T) {
+	// Arrange
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "no storage", http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+	exporter, err := NewZipkinExporter(ZipkinOptions{Endpoint: server.URL})
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	_, span := sdktrace.NewTracerProvider().Tracer("test").Start(context.Background(), "ci")
+	span.End()
+
+	// Act
+	err = exporter.ExportSpans(context.Background(), []sdktrace.ReadOnlySpan{span.(sdktrace.ReadOnlySpan)})
+
+	// Assert
+	assert.EqualError(t, err, "zipkin returned 503 Service Unavailable: no storage")
+}
@@ -0,0 +1,153 @@
+package poller
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pitoniak32/trace-export/pkg/internal"
+)
+
+// Cursor records which completed runs of each repo have been exported, so a restart doesn't export
+// them again.
+type Cursor struct {
+	mu   sync.Mutex
+	path string
+	// position of each repo, keyed by 'owner/repo'
+	Repos map[string]*RepoCursor `json:"repos"`
+}
+
+type RepoCursor struct {
+	// the latest updated_at of the runs that have been exported
+	UpdatedAt time.Time `json:"updated_at"`
+	// the runs exported within the lookback before UpdatedAt, keyed by 'run_id/run_attempt'
+	Exported map[string]time.Time `json:"exported,omitempty"`
+}
+
+// LoadCursor reads the cursor from the path, a missing file is an empty cursor.
+func LoadCursor(path string) (*Cursor, error) {
+	c := &Cursor{path: path, Repos: make(map[string]*RepoCursor)}
+	if path == "" {
+		return c, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cursor '%s': %w", path, err)
+	}
+
+	err = json.Unmarshal(data, c)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse cursor '%s': %w", path, err)
+	}
+	if c.Repos == nil {
+		c.Repos = make(map[string]*RepoCursor)
+	}
+
+	return c, nil
+}
+
+func runKey(runId int64, runAttempt int) string {
+	return fmt.Sprintf("%d/%d", runId, runAttempt)
+}
+
+// IsExported reports whether the run needs to be exported. Runs that were updated more than lookback
+// before the cursor are considered exported, anything newer is checked against the recorded runs.
+func (c *Cursor) IsExported(repo string, runId int64, runAttempt int, updatedAt time.Time, lookback time.Duration) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	cursor := c.repo(repo)
+	if updatedAt.Before(cursor.UpdatedAt.Add(-lookback)) {
+		return true
+	}
+	_, ok := cursor.Exported[runKey(runId, runAttempt)]
+	return ok
+}
+
+// Start sets the position of a repo that has never been polled, so only runs updated after it are
+// exported instead of its whole history.
+func (c *Cursor) Start(repo string, at time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	cursor := c.repo(repo)
+	if cursor.UpdatedAt.IsZero() {
+		cursor.UpdatedAt = at
+	}
+}
+
+// Position returns the latest updated_at of the runs of the repo that have been exported.
+func (c *Cursor) Position(repo string) time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.repo(repo).UpdatedAt
+}
+
+// MarkExported records the run, the cursor is only moved forward by Advance.
+func (c *Cursor) MarkExported(repo string, runId int64, runAttempt int, updatedAt time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	cursor := c.repo(repo)
+	cursor.Exported[runKey(runId, runAttempt)] = updatedAt
+	return c.save()
+}
+
+// Advance moves the cursor forward to updatedAt, the runs that fell out of the lookback are dropped.
+func (c *Cursor) Advance(repo string, updatedAt time.Time, lookback time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	cursor := c.repo(repo)
+	if updatedAt.After(cursor.UpdatedAt) {
+		cursor.UpdatedAt = updatedAt
+	}
+	for key, exportedAt := range cursor.Exported {
+		if exportedAt.Before(cursor.UpdatedAt.Add(-lookback)) {
+			delete(cursor.Exported, key)
+		}
+	}
+
+	return c.save()
+}
+
+// repo must be called with the lock held.
+func (c *Cursor) repo(repo string) *RepoCursor {
+	cursor, ok := c.Repos[repo]
+	if !ok {
+		cursor = &RepoCursor{}
+		c.Repos[repo] = cursor
+	}
+	if cursor.Exported == nil {
+		cursor.Exported = make(map[string]time.Time)
+	}
+	return cursor
+}
+
+// save must be called with the lock held.
+func (c *Cursor) save() error {
+	if c.path == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode cursor: %w", err)
+	}
+
+	err = internal.WriteFileAtomic(c.path, data)
+	if err != nil {
+		return fmt.Errorf("failed to write cursor '%s': %w", c.path, err)
+	}
+
+	return nil
+}
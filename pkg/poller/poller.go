@@ -0,0 +1,219 @@
+package poller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	eg "github.com/google/go-github/v66/github"
+	ig "github.com/pitoniak32/trace-export/pkg/github"
+	myOtel "github.com/pitoniak32/trace-export/pkg/otel"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	tracer = otel.Tracer(myOtel.SERVICE_TRACER_NAME)
+)
+
+// the number of runs that are listed per request
+const runsPerPoll = 100
+
+// Poller exports the completed runs of repos that we can't install the webhook on.
+type Poller struct {
+	client *eg.Client
+	budget *ig.RateBudget
+	tracer trace.Tracer
+	cursor *Cursor
+	repos  []string
+	// runs updated this long before the cursor are still checked, in case they show up in the list late
+	lookback time.Duration
+
+	mu sync.Mutex
+	// the etag of the last runs response of each repo, an unchanged list doesn't count against the rate limit
+	etags map[string]string
+}
+
+func NewPoller(client *eg.Client, budget *ig.RateBudget, tracer trace.Tracer, cursor *Cursor, repos []string, lookback time.Duration) (*Poller, error) {
+	for _, repo := range repos {
+		if _, _, err := ig.SplitRepo(repo); err != nil {
+			return nil, err
+		}
+	}
+
+	// repos we have never polled start from now, we don't want to export their whole history.
+	now := time.Now()
+	for _, repo := range repos {
+		cursor.Start(repo, now)
+	}
+
+	return &Poller{
+		client:   client,
+		budget:   budget,
+		tracer:   tracer,
+		cursor:   cursor,
+		repos:    repos,
+		lookback: lookback,
+		etags:    make(map[string]string),
+	}, nil
+}
+
+// SchedulePoll polls the repos right away, and then every interval until the context is cancelled.
+func (p *Poller) SchedulePoll(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			_, err := p.Poll(ctx)
+			if err != nil {
+				slog.Error("failed to poll workflow runs", "err", err)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Poll exports the runs of every repo that completed since the last poll. Returns the number of
+// runs that were exported.
+func (p *Poller) Poll(ctx context.Context) (int, error) {
+	ctx, span := tracer.Start(ctx, "PollWorkflowRuns", trace.WithAttributes(attribute.Int("poll.repos", len(p.repos))))
+	defer span.End()
+
+	var errs error
+	exported := 0
+	for _, repo := range p.repos {
+		count, err := p.pollRepo(ctx, repo)
+		exported += count
+		if err != nil {
+			errs = errors.Join(errs, err)
+		}
+	}
+
+	span.SetAttributes(
+		attribute.Int("poll.total.exported", exported),
+		attribute.Int("github.ratelimit.remaining", p.budget.Remaining()),
+	)
+	if errs != nil {
+		span.SetStatus(codes.Error, errs.Error())
+	}
+
+	return exported, errs
+}
+
+// pollRepo only moves the cursor, and keeps the etag of the list, once every run in it was exported,
+// so the runs that failed are listed, and retried, by the next poll.
+func (p *Poller) pollRepo(ctx context.Context, repo string) (int, error) {
+	runs, etag, err := p.listRuns(ctx, repo)
+	if err != nil {
+		return 0, err
+	}
+
+	var errs error
+	failed := false
+	exported := 0
+	var latest time.Time
+	for _, run := range runs {
+		updatedAt := run.GetUpdatedAt().Time
+		if p.cursor.IsExported(repo, run.GetID(), run.GetRunAttempt(), updatedAt, p.lookback) {
+			continue
+		}
+
+		err := p.exportRun(ctx, repo, run)
+		if err != nil {
+			slog.Error("failed to export polled workflow run", "repo", repo, "run.id", run.GetID(), "err", err)
+			errs = errors.Join(errs, err)
+			failed = true
+			continue
+		}
+
+		errs = errors.Join(errs, p.cursor.MarkExported(repo, run.GetID(), run.GetRunAttempt(), updatedAt))
+		exported += 1
+		if updatedAt.After(latest) {
+			latest = updatedAt
+		}
+	}
+	if failed {
+		return exported, errs
+	}
+
+	errs = errors.Join(errs, p.cursor.Advance(repo, latest, p.lookback))
+	if etag != "" {
+		p.mu.Lock()
+		p.etags[repo] = etag
+		p.mu.Unlock()
+	}
+
+	return exported, errs
+}
+
+func (p *Poller) exportRun(ctx context.Context, repo string, run *eg.WorkflowRun) error {
+	owner, name, _ := ig.SplitRepo(repo)
+
+	jobs, err := ig.ListJobs(ctx, p.client, p.budget, owner, name, run.GetID(), int64(run.GetRunAttempt()))
+	if err != nil {
+		return err
+	}
+
+	return ig.TraceWorkflowRun(ctx, *run, run.GetID(), *jobs, p.tracer)
+}
+
+// listRuns lists the completed runs of the repo, newest first, until the runs that were created
+// more than the lookback before the cursor. Those completed before the cursor, unless they took
+// longer than the lookback. Returns nothing when the list has not changed since its etag was kept,
+// the etag is only returned for lists that fit in one page since a run that completes late shows up
+// on a later page without changing the first.
+func (p *Poller) listRuns(ctx context.Context, repo string) ([]*eg.WorkflowRun, string, error) {
+	owner, name, _ := ig.SplitRepo(repo)
+
+	p.mu.Lock()
+	etag := p.etags[repo]
+	p.mu.Unlock()
+
+	listedUntil := p.cursor.Position(repo).Add(-p.lookback)
+
+	var runs []*eg.WorkflowRun
+	for page := 1; ; page++ {
+		req, err := p.client.NewRequest(http.MethodGet, fmt.Sprintf("repos/%s/%s/actions/runs?status=completed&per_page=%d&page=%d", owner, name, runsPerPoll, page), nil)
+		if err != nil {
+			return nil, "", err
+		}
+		if page == 1 && etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+
+		var list eg.WorkflowRuns
+		var res *eg.Response
+		err = p.budget.Do(ctx, func() (*eg.Response, error) {
+			var err error
+			res, err = p.client.Do(ctx, req, &list)
+			return res, err
+		})
+		if page == 1 && res != nil && res.StatusCode == http.StatusNotModified {
+			slog.Debug("workflow runs not modified", "repo", repo)
+			return nil, etag, nil
+		}
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to list workflow runs of '%s': %w", repo, err)
+		}
+		runs = append(runs, list.WorkflowRuns...)
+
+		last := len(list.WorkflowRuns) - 1
+		if res.NextPage == 0 || last < 0 || list.WorkflowRuns[last].GetCreatedAt().Time.Before(listedUntil) {
+			if page > 1 {
+				return runs, "", nil
+			}
+			return runs, res.Header.Get("ETag"), nil
+		}
+	}
+}
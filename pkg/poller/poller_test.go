@@ -0,0 +1,196 @@
+package poller
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	eg "github.com/google/go-github/v66/github"
+	ig "github.com/pitoniak32/trace-export/pkg/github"
+	"github.com/pitoniak32/trace-export/pkg/internal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPollExportsNewRunsOnce(t *testing.T) {
+	// Arrange
+	updatedAt := time.Now().UTC().Truncate(time.Second)
+	notModified := 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/octo/repo/actions/runs", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			notModified += 1
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		_, _ = fmt.Fprintf(w, `{"total_count": 2, "workflow_runs": [
+			{"id": 1, "name": "ci", "run_attempt": 1, "run_started_at": "%[1]s", "updated_at": "%[2]s"},
+			{"id": 2, "name": "old", "run_attempt": 1, "run_started_at": "2020-01-01T00:00:00Z", "updated_at": "2020-01-01T00:05:00Z"}
+		]}`, updatedAt.Add(-5*time.Minute).Format(time.RFC3339), updatedAt.Format(time.RFC3339))
+	})
+	mux.HandleFunc("/repos/octo/repo/actions/runs/1/attempts/1/jobs", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprintf(w, `{"total_count": 1, "jobs": [{"id": 10, "name": "build", "started_at": "%s", "completed_at": "%s"}]}`,
+			updatedAt.Add(-4*time.Minute).Format(time.RFC3339), updatedAt.Add(-time.Minute).Format(time.RFC3339))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client := eg.NewClient(nil)
+	client.BaseURL, _ = url.Parse(server.URL + "/")
+
+	cursorPath := filepath.Join(t.TempDir(), "cursor.json")
+	cursor, err := LoadCursor(cursorPath)
+	assert.NoError(t, err)
+
+	tracer, exporter := internal.NewTestTracerWithExporter()
+	poller, err := NewPoller(client, ig.NewRateBudget(0), tracer, cursor, []string{"octo/repo"}, time.Hour)
+	assert.NoError(t, err)
+
+	// Act
+	first, err := poller.Poll(context.Background())
+	assert.NoError(t, err)
+	second, err := poller.Poll(context.Background())
+	assert.NoError(t, err)
+
+	// a restarted poller doesn't have the etag, but should skip the run because of the cursor
+	cursor, err = LoadCursor(cursorPath)
+	assert.NoError(t, err)
+	restarted, err := NewPoller(client, ig.NewRateBudget(0), tracer, cursor, []string{"octo/repo"}, time.Hour)
+	assert.NoError(t, err)
+	third, err := restarted.Poll(context.Background())
+	assert.NoError(t, err)
+
+	// Assert
+	assert.Equal(t, 1, first, "only the run updated after the poller started should be exported")
+	assert.Equal(t, 0, second)
+	assert.Equal(t, 1, notModified)
+	assert.Equal(t, 0, third)
+	assert.Equal(t, 3, len(exporter.GetSpans()), "expected root, queued and job spans")
+}
+
+func TestPollListsEveryPageSinceTheCursor(t *testing.T) {
+	// Arrange
+	now := time.Now().UTC().Truncate(time.Second)
+	pages := []int{}
+	conditional := 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/octo/repo/actions/runs", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") != "" {
+			conditional += 1
+		}
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		pages = append(pages, page)
+
+		// one run per page, the second one was created before the later ones but completed after them
+		created := map[int]time.Time{1: now.Add(-10 * time.Minute), 2: now.Add(-30 * time.Minute), 3: now.Add(-2 * time.Hour)}[page]
+		updated := map[int]time.Time{1: now.Add(time.Minute), 2: now.Add(2 * time.Minute), 3: now.Add(-time.Hour)}[page]
+		w.Header().Set("ETag", fmt.Sprintf(`"page-%d"`, page))
+		w.Header().Set("Link", fmt.Sprintf(`<%s?page=%d>; rel="next"`, r.URL.Path, page+1))
+		_, _ = fmt.Fprintf(w, `{"total_count": 10, "workflow_runs": [{"id": %[1]d, "name": "ci", "run_attempt": 1, "created_at": "%[2]s", "run_started_at": "%[2]s", "updated_at": "%[3]s"}]}`,
+			page, created.Format(time.RFC3339), updated.Format(time.RFC3339))
+	})
+	mux.HandleFunc("/repos/octo/repo/actions/runs/{id}/attempts/1/jobs", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprintf(w, `{"total_count": 1, "jobs": [{"id": 10, "name": "build", "started_at": "%s", "completed_at": "%s"}]}`,
+			now.Format(time.RFC3339), now.Add(time.Minute).Format(time.RFC3339))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	client := eg.NewClient(nil)
+	client.BaseURL, _ = url.Parse(server.URL + "/")
+
+	cursor, err := LoadCursor("")
+	assert.NoError(t, err)
+	tracer, _ := internal.NewTestTracerWithExporter()
+	poller, err := NewPoller(client, ig.NewRateBudget(0), tracer, cursor, []string{"octo/repo"}, time.Hour)
+	assert.NoError(t, err)
+
+	// Act
+	exported, err := poller.Poll(context.Background())
+	assert.NoError(t, err)
+	again, err := poller.Poll(context.Background())
+	assert.NoError(t, err)
+
+	// Assert
+	assert.Equal(t, 2, exported, "the runs of every page that completed after the poller started should be exported")
+	assert.Equal(t, []int{1, 2, 3, 1, 2, 3}, pages, "pages with runs created more than the lookback before the cursor should not be listed")
+	assert.Equal(t, 0, again)
+	assert.Equal(t, 0, conditional, "the etag of the first page doesn't cover the runs of the later ones")
+	assert.Equal(t, now.Add(2*time.Minute), cursor.Position("octo/repo"))
+}
+
+// newFailingServer lists one run with an etag, and fails to list its jobs the first failures times.
+func newFailingServer(t *testing.T, updatedAt time.Time, failures int) (*eg.Client, *int) {
+	notModified := 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/octo/repo/actions/runs", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			notModified += 1
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		_, _ = fmt.Fprintf(w, `{"total_count": 1, "workflow_runs": [{"id": 1, "name": "ci", "run_attempt": 1, "run_started_at": "%[1]s", "updated_at": "%[2]s"}]}`,
+			updatedAt.Add(-5*time.Minute).Format(time.RFC3339), updatedAt.Format(time.RFC3339))
+	})
+	mux.HandleFunc("/repos/octo/repo/actions/runs/1/attempts/1/jobs", func(w http.ResponseWriter, r *http.Request) {
+		if failures > 0 {
+			failures -= 1
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		_, _ = fmt.Fprintf(w, `{"total_count": 1, "jobs": [{"id": 10, "name": "build", "started_at": "%s", "completed_at": "%s"}]}`,
+			updatedAt.Add(-4*time.Minute).Format(time.RFC3339), updatedAt.Add(-time.Minute).Format(time.RFC3339))
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	client := eg.NewClient(nil)
+	client.BaseURL, _ = url.Parse(server.URL + "/")
+	return client, &notModified
+}
+
+func TestPollRetriesRunsThatFailedToExport(t *testing.T) {
+	// Arrange
+	client, notModified := newFailingServer(t, time.Now().UTC().Truncate(time.Second), 1)
+	cursor, err := LoadCursor("")
+	assert.NoError(t, err)
+	tracer, exporter := internal.NewTestTracerWithExporter()
+	poller, err := NewPoller(client, ig.NewRateBudget(0), tracer, cursor, []string{"octo/repo"}, time.Hour)
+	assert.NoError(t, err)
+
+	// Act
+	failed, failedErr := poller.Poll(context.Background())
+	retried, err := poller.Poll(context.Background())
+
+	// Assert
+	assert.Error(t, failedErr)
+	assert.Equal(t, 0, failed)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, retried, "the list should not be skipped as unchanged while a run of it failed")
+	assert.Equal(t, 0, *notModified)
+	assert.Equal(t, 3, len(exporter.GetSpans()), "expected root, queued and job spans")
+}
+
+func TestSchedulePollPollsRightAway(t *testing.T) {
+	// Arrange
+	client, _ := newFailingServer(t, time.Now().UTC().Truncate(time.Second), 0)
+	cursor, err := LoadCursor("")
+	assert.NoError(t, err)
+	tracer, exporter := internal.NewTestTracerWithExporter()
+	poller, err := NewPoller(client, ig.NewRateBudget(0), tracer, cursor, []string{"octo/repo"}, time.Hour)
+	assert.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Act
+	poller.SchedulePoll(ctx, time.Hour)
+
+	// Assert
+	assert.Eventually(t, func() bool { return len(exporter.GetSpans()) == 3 }, time.Second, 5*time.Millisecond)
+}
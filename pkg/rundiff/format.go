@@ -0,0 +1,116 @@
+package rundiff
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// row is a line of the table and markdown outputs.
+type row struct {
+	name   string
+	base   string
+	head   string
+	delta  string
+	queued string
+}
+
+func (r Report) rows() []row {
+	rows := []row{{
+		name:   "run " + r.Head.Name,
+		base:   formatDuration(r.Duration.Base),
+		head:   formatDuration(r.Duration.Head),
+		delta:  formatDelta(r.Duration),
+		queued: formatChange(r.Queued.Change()),
+	}}
+
+	for _, job := range r.Jobs {
+		rows = append(rows, newRow(job.Label(), job.Change, job.Duration))
+		if job.Change == MATCHED {
+			rows[len(rows)-1].queued = formatChange(job.Queued.Change())
+		}
+		for _, step := range job.Steps {
+			rows = append(rows, newRow("  "+step.Name, step.Change, step.Duration))
+		}
+	}
+	return rows
+}
+
+func newRow(name string, change string, d Delta) row {
+	row := row{name: name, base: "-", head: "-", delta: change}
+	if change != ADDED {
+		row.base = formatDuration(d.Base)
+	}
+	if change != REMOVED {
+		row.head = formatDuration(d.Head)
+	}
+	if change == MATCHED {
+		row.delta = formatDelta(d)
+	}
+	return row
+}
+
+// WriteTable writes the report as an aligned table, with the steps indented under their job.
+func WriteTable(w io.Writer, r Report) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "%s\tBASE\tHEAD\tDELTA\tQUEUED DELTA\n", fmt.Sprintf("%d/%d -> %d/%d", r.Base.RunID, r.Base.Attempt, r.Head.RunID, r.Head.Attempt))
+	for _, row := range r.rows() {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", row.name, row.base, row.head, row.delta, row.queued)
+	}
+	return tw.Flush()
+}
+
+// WriteMarkdown writes the report as a markdown table, like for a comment on a pull request.
+func WriteMarkdown(w io.Writer, r Report) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "**%s**: run %d (attempt %d) compared to run %d (attempt %d)\n\n", r.Head.Name, r.Head.RunID, r.Head.Attempt, r.Base.RunID, r.Base.Attempt)
+	b.WriteString("| | Base | Head | Delta | Queued delta |\n")
+	b.WriteString("|---|---:|---:|---:|---:|\n")
+	for i, row := range r.rows() {
+		name := markdownEscape(row.name)
+		if i == 0 {
+			name = "**" + name + "**"
+		} else if strings.HasPrefix(row.name, "  ") {
+			name = "↳ " + markdownEscape(strings.TrimPrefix(row.name, "  "))
+		}
+		fmt.Fprintf(&b, "| %s | %s | %s | %s | %s |\n", name, row.base, row.head, row.delta, row.queued)
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func WriteJSON(w io.Writer, r Report) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+func formatDelta(d Delta) string {
+	delta := formatChange(d.Change())
+	if d.Base > 0 {
+		delta += fmt.Sprintf(" (%+.0f%%)", d.Percent())
+	}
+	return delta
+}
+
+func formatChange(d time.Duration) string {
+	if d < 0 {
+		return "-" + formatDuration(-d)
+	}
+	return "+" + formatDuration(d)
+}
+
+func formatDuration(d time.Duration) string {
+	if d < time.Second {
+		return d.Round(time.Millisecond).String()
+	}
+	return d.Round(time.Second).String()
+}
+
+func markdownEscape(s string) string {
+	return strings.ReplaceAll(s, "|", "\\|")
+}
@@ -0,0 +1,269 @@
+package rundiff
+
+import (
+	"encoding/json"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pitoniak32/trace-export/pkg/spantree"
+)
+
+// the name of the span of the time a run waited for its first job to start
+const queuedSpanName = "Queued"
+
+// how a job or step of the head run compares to the base run
+const (
+	MATCHED = "matched"
+	ADDED   = "added"
+	REMOVED = "removed"
+)
+
+// Delta is how long something took in the base and the head run, it took zero in the run it isn't in.
+type Delta struct {
+	Base time.Duration
+	Head time.Duration
+}
+
+// Change is positive when the head run is slower.
+func (d Delta) Change() time.Duration {
+	return d.Head - d.Base
+}
+
+// Percent is the change relative to the base, 0 when there is no base.
+func (d Delta) Percent() float64 {
+	if d.Base <= 0 {
+		return 0
+	}
+	return float64(d.Change()) / float64(d.Base) * 100
+}
+
+func (d Delta) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]int64{
+		"base_ms":  d.Base.Milliseconds(),
+		"head_ms":  d.Head.Milliseconds(),
+		"delta_ms": d.Change().Milliseconds(),
+	})
+}
+
+type Report struct {
+	Base     Run   `json:"base"`
+	Head     Run   `json:"head"`
+	Duration Delta `json:"duration"`
+	// how long the runs waited for their first job to start
+	Queued Delta     `json:"queued"`
+	Jobs   []JobDiff `json:"jobs"`
+}
+
+type Run struct {
+	Name    string `json:"name"`
+	RunID   int64  `json:"run_id"`
+	Attempt int64  `json:"attempt"`
+}
+
+type JobDiff struct {
+	// the name without the matrix values
+	Name   string   `json:"name"`
+	Matrix []string `json:"matrix,omitempty"`
+	// MATCHED, ADDED or REMOVED
+	Change   string `json:"change"`
+	Duration Delta  `json:"duration"`
+	// how long the job waited for a runner
+	Queued Delta      `json:"queued"`
+	Steps  []StepDiff `json:"steps,omitempty"`
+}
+
+// Label is the name of the job with its matrix values, like GitHub shows it.
+func (j JobDiff) Label() string {
+	if len(j.Matrix) == 0 {
+		return j.Name
+	}
+	return j.Name + " (" + strings.Join(j.Matrix, ", ") + ")"
+}
+
+type StepDiff struct {
+	Name string `json:"name"`
+	// the number of the step in the head run, or the base run when it was removed
+	Number   int64  `json:"number"`
+	Change   string `json:"change"`
+	Duration Delta  `json:"duration"`
+}
+
+// Compare matches the jobs of two runs by their name and matrix values (in any order), and the
+// steps of matched jobs by their name, and reports how much longer each of them took in the head
+// run. Jobs and steps that repeat a name are matched in the order they ran. The jobs and steps are
+// in the order of the head run, followed by the ones that were removed.
+func Compare(base *spantree.Node, head *spantree.Node) Report {
+	report := Report{
+		Base:     newRun(base),
+		Head:     newRun(head),
+		Duration: Delta{Base: duration(base), Head: duration(head)},
+	}
+	if queued := findQueued(base); queued != nil {
+		report.Queued.Base = duration(queued)
+	}
+	if queued := findQueued(head); queued != nil {
+		report.Queued.Head = duration(queued)
+	}
+
+	for _, pair := range match(jobsOf(base), jobsOf(head), jobKey) {
+		job := newJobDiff(pair)
+		if pair.base != nil && pair.head != nil {
+			for _, steps := range match(pair.base.Children, pair.head.Children, func(n *spantree.Node) string { return n.Name }) {
+				job.Steps = append(job.Steps, newStepDiff(steps))
+			}
+		}
+		report.Jobs = append(report.Jobs, job)
+	}
+
+	return report
+}
+
+type pair struct {
+	base *spantree.Node
+	head *spantree.Node
+}
+
+// match pairs the nodes with the same key, the nth node with a key in the base with the nth with
+// that key in the head.
+func match(base []*spantree.Node, head []*spantree.Node, key func(*spantree.Node) string) []pair {
+	occurrences := func(nodes []*spantree.Node) []string {
+		seen := map[string]int{}
+		keys := make([]string, 0, len(nodes))
+		for _, node := range nodes {
+			k := key(node)
+			keys = append(keys, k+"\x00"+strconv.Itoa(seen[k]))
+			seen[k] += 1
+		}
+		return keys
+	}
+
+	baseKeys := occurrences(base)
+	baseIndex := make(map[string]int, len(base))
+	for i, k := range baseKeys {
+		baseIndex[k] = i
+	}
+
+	pairs := make([]pair, 0, len(head))
+	matched := make([]bool, len(base))
+	for i, k := range occurrences(head) {
+		p := pair{head: head[i]}
+		if j, ok := baseIndex[k]; ok {
+			p.base = base[j]
+			matched[j] = true
+		}
+		pairs = append(pairs, p)
+	}
+	for j, node := range base {
+		if !matched[j] {
+			pairs = append(pairs, pair{base: node})
+		}
+	}
+	return pairs
+}
+
+func newRun(root *spantree.Node) Run {
+	run := Run{Name: root.Name}
+	run.RunID, _ = root.Attributes["workflow_run.id"].(int64)
+	run.Attempt, _ = root.Attributes["workflow_run.attempt"].(int64)
+	return run
+}
+
+func newJobDiff(p pair) JobDiff {
+	node := p.head
+	if node == nil {
+		node = p.base
+	}
+	name, matrix := splitMatrix(node.Name)
+
+	job := JobDiff{Name: name, Matrix: matrix, Change: change(p)}
+	if p.base != nil {
+		job.Duration.Base = duration(p.base)
+		job.Queued.Base = queued(p.base)
+	}
+	if p.head != nil {
+		job.Duration.Head = duration(p.head)
+		job.Queued.Head = queued(p.head)
+	}
+	return job
+}
+
+func newStepDiff(p pair) StepDiff {
+	node := p.head
+	if node == nil {
+		node = p.base
+	}
+
+	step := StepDiff{Name: node.Name, Change: change(p)}
+	step.Number, _ = node.Attributes["step.number"].(int64)
+	if p.base != nil {
+		step.Duration.Base = duration(p.base)
+	}
+	if p.head != nil {
+		step.Duration.Head = duration(p.head)
+	}
+	return step
+}
+
+func change(p pair) string {
+	switch {
+	case p.base == nil:
+		return ADDED
+	case p.head == nil:
+		return REMOVED
+	default:
+		return MATCHED
+	}
+}
+
+func jobsOf(root *spantree.Node) []*spantree.Node {
+	var jobs []*spantree.Node
+	for _, child := range root.Children {
+		if child.Attributes["workflow_job.id"] != nil {
+			jobs = append(jobs, child)
+		}
+	}
+	return jobs
+}
+
+func findQueued(root *spantree.Node) *spantree.Node {
+	for _, child := range root.Children {
+		if child.Name == queuedSpanName && child.Attributes["workflow_job.id"] == nil {
+			return child
+		}
+	}
+	return nil
+}
+
+// jobKey is the name of a job with its matrix values sorted, so reordering the matrix doesn't
+// add and remove every job.
+func jobKey(job *spantree.Node) string {
+	name, matrix := splitMatrix(job.Name)
+	matrix = slices.Clone(matrix)
+	slices.Sort(matrix)
+	return name + "\x00" + strings.Join(matrix, "\x00")
+}
+
+// splitMatrix splits the matrix values off the name of a job, like 'test (ubuntu-latest, 1.22)'.
+func splitMatrix(name string) (string, []string) {
+	if !strings.HasSuffix(name, ")") {
+		return name, nil
+	}
+	i := strings.LastIndex(name, " (")
+	if i < 0 {
+		return name, nil
+	}
+
+	values := strings.Split(name[i+2:len(name)-1], ", ")
+	return name[:i], values
+}
+
+func duration(node *spantree.Node) time.Duration {
+	return node.EndTime.Sub(node.StartTime)
+}
+
+func queued(job *spantree.Node) time.Duration {
+	ms, _ := job.Attributes["workflow_job.queued.ms"].(int64)
+	return time.Duration(ms) * time.Millisecond
+}
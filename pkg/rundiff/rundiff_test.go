@@ -0,0 +1,104 @@
+package rundiff
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pitoniak32/trace-export/pkg/spantree"
+	"github.com/stretchr/testify/assert"
+)
+
+var start = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func node(name string, d time.Duration, attributes map[string]any, children ...*spantree.Node) *spantree.Node {
+	return &spantree.Node{Name: name, StartTime: start, EndTime: start.Add(d), Attributes: attributes, Children: children}
+}
+
+func job(id int64, queued time.Duration) map[string]any {
+	return map[string]any{"workflow_job.id": id, "workflow_job.queued.ms": queued.Milliseconds()}
+}
+
+func step(number int64) map[string]any {
+	return map[string]any{"step.number": number}
+}
+
+func TestCompare(t *testing.T) {
+	// Arrange
+	base := node("ci", 10*time.Minute, map[string]any{"workflow_run.id": int64(1), "workflow_run.attempt": int64(1)},
+		node("Queued", time.Minute, nil),
+		node("build", 4*time.Minute, job(1, time.Minute),
+			node("checkout", 10*time.Second, step(1)),
+			node("go build", 2*time.Minute, step(2)),
+		),
+		node("test (ubuntu-latest, 1.22)", 5*time.Minute, job(2, 0)),
+		node("lint", time.Minute, job(3, 0)),
+	)
+	head := node("ci", 12*time.Minute, map[string]any{"workflow_run.id": int64(2), "workflow_run.attempt": int64(1)},
+		node("Queued", 30*time.Second, nil),
+		node("build", 5*time.Minute, job(4, 2*time.Minute),
+			node("checkout", 10*time.Second, step(1)),
+			node("setup go", 30*time.Second, step(2)),
+			node("go build", 3*time.Minute, step(3)),
+		),
+		node("test (1.22, ubuntu-latest)", 4*time.Minute, job(5, 0)),
+		node("docs", time.Minute, job(6, 0)),
+	)
+
+	// Act
+	report := Compare(base, head)
+
+	// Assert
+	assert.Equal(t, Run{Name: "ci", RunID: 2, Attempt: 1}, report.Head)
+	assert.Equal(t, Delta{Base: 10 * time.Minute, Head: 12 * time.Minute}, report.Duration)
+	assert.Equal(t, -30*time.Second, report.Queued.Change())
+
+	var jobs []string
+	for _, job := range report.Jobs {
+		jobs = append(jobs, job.Label()+" "+job.Change)
+	}
+	assert.Equal(t, []string{"build matched", "test (1.22, ubuntu-latest) matched", "docs added", "lint removed"}, jobs, "jobs should match in any matrix order")
+
+	build := report.Jobs[0]
+	assert.Equal(t, time.Minute, build.Queued.Change())
+	assert.Equal(t, []StepDiff{
+		{Name: "checkout", Number: 1, Change: MATCHED, Duration: Delta{Base: 10 * time.Second, Head: 10 * time.Second}},
+		{Name: "setup go", Number: 2, Change: ADDED, Duration: Delta{Head: 30 * time.Second}},
+		{Name: "go build", Number: 3, Change: MATCHED, Duration: Delta{Base: 2 * time.Minute, Head: 3 * time.Minute}},
+	}, build.Steps, "steps should be matched by name when their numbers shift")
+	assert.Equal(t, 50.0, build.Steps[2].Duration.Percent())
+}
+
+func TestWriteMarkdown(t *testing.T) {
+	// Arrange
+	report := Report{
+		Base:     Run{Name: "ci", RunID: 1, Attempt: 1},
+		Head:     Run{Name: "ci", RunID: 2, Attempt: 1},
+		Duration: Delta{Base: 10 * time.Minute, Head: 12 * time.Minute},
+		Jobs: []JobDiff{
+			{Name: "build", Change: MATCHED, Duration: Delta{Base: time.Minute, Head: 30 * time.Second}, Queued: Delta{Head: 5 * time.Second}, Steps: []StepDiff{
+				{Name: "go build", Number: 1, Change: MATCHED, Duration: Delta{Base: time.Minute, Head: 30 * time.Second}},
+			}},
+			{Name: "test", Matrix: []string{"a|b"}, Change: ADDED, Duration: Delta{Head: time.Minute}},
+		},
+	}
+	var out bytes.Buffer
+
+	// Act
+	err := WriteMarkdown(&out, report)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, strings.Join([]string{
+		"**ci**: run 2 (attempt 1) compared to run 1 (attempt 1)",
+		"",
+		"| | Base | Head | Delta | Queued delta |",
+		"|---|---:|---:|---:|---:|",
+		"| **run ci** | 10m0s | 12m0s | +2m0s (+20%) | +0s |",
+		"| build | 1m0s | 30s | -30s (-50%) | +5s |",
+		"| ↳ go build | 1m0s | 30s | -30s (-50%) |  |",
+		"| test (a\\|b) | - | 1m0s | added |  |",
+		"",
+	}, "\n"), out.String())
+}
@@ -0,0 +1,122 @@
+package sampling
+
+import (
+	"math"
+	"path"
+	"slices"
+	"time"
+)
+
+// why a run was kept
+const (
+	REASON_CONCLUSION = "conclusion"
+	REASON_DURATION   = "duration"
+	REASON_RATE       = "rate"
+)
+
+// the conclusions of runs that failed or were cancelled
+var DEFAULT_KEEP_CONCLUSIONS = []string{"failure", "cancelled", "timed_out", "startup_failure"}
+
+// Options decide which runs are kept. Runs with one of the conclusions, or that took longer than the
+// duration, are always kept, the rest are kept at the rate of the first rule they match.
+type Options struct {
+	// the chance a run that no rule matches is kept, 1 keeps every run
+	Rate float64
+	// 0 doesn't keep runs for their duration
+	KeepDurationOver time.Duration
+	KeepConclusions  []string
+	Rules            []Rule
+}
+
+// Rule sets the rate of the runs that match a pattern (of path.Match) of every list that isn't empty.
+type Rule struct {
+	// 'owner/repo'
+	Repos     []string
+	Workflows []string
+	Rate      float64
+}
+
+func (r Rule) matches(run Run) bool {
+	return matchesAny(r.Repos, run.Repo) && matchesAny(r.Workflows, run.Workflow)
+}
+
+// matchesAny is true for no patterns.
+func matchesAny(patterns []string, value string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, value); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Run is a completed workflow run attempt.
+type Run struct {
+	ID int64
+	// 'owner/repo'
+	Repo       string
+	Workflow   string
+	Conclusion string
+	Duration   time.Duration
+}
+
+// Decision is whether the trace of a run is exported.
+type Decision struct {
+	Keep bool
+	// one of REASON_CONCLUSION, REASON_DURATION or REASON_RATE
+	Reason string
+	// the chance the run had to be kept, 1 for runs that are always kept
+	Rate float64
+}
+
+// SampleRate is the number of runs the kept one stands for, which backends multiply its counts by.
+func (d Decision) SampleRate() int64 {
+	if d.Rate <= 0 {
+		return 0
+	}
+	return int64(math.Round(1 / d.Rate))
+}
+
+type Sampler struct {
+	opts Options
+}
+
+func NewSampler(opts Options) *Sampler {
+	return &Sampler{opts: opts}
+}
+
+// Sample decides up front whether the run is kept, since the whole run is known once it completed.
+// Runs are kept at a rate by their id, so every delivery of the webhooks of a run, and every attempt
+// that is sampled at a rate, gets the same decision.
+func (s *Sampler) Sample(run Run) Decision {
+	if slices.Contains(s.opts.KeepConclusions, run.Conclusion) {
+		return Decision{Keep: true, Reason: REASON_CONCLUSION, Rate: 1}
+	}
+	if s.opts.KeepDurationOver > 0 && run.Duration > s.opts.KeepDurationOver {
+		return Decision{Keep: true, Reason: REASON_DURATION, Rate: 1}
+	}
+
+	rate := s.opts.Rate
+	for _, rule := range s.opts.Rules {
+		if rule.matches(run) {
+			rate = rule.Rate
+			break
+		}
+	}
+	return Decision{Keep: position(run.ID) < rate, Reason: REASON_RATE, Rate: rate}
+}
+
+// position spreads the run ids evenly over [0, 1), with the finalizer of splitmix64 since the ids
+// of the runs of a repo are close to each other.
+func position(runID int64) float64 {
+	x := uint64(runID)
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return float64(x>>11) / (1 << 53)
+}
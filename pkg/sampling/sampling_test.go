@@ -0,0 +1,80 @@
+package sampling
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSample(t *testing.T) {
+	sampler := NewSampler(Options{
+		Rate:             1,
+		KeepDurationOver: 30 * time.Minute,
+		KeepConclusions:  DEFAULT_KEEP_CONCLUSIONS,
+		Rules: []Rule{
+			{Repos: []string{"octo/*"}, Workflows: []string{"lint"}, Rate: 0},
+			{Repos: []string{"octo/web"}, Rate: 0.5},
+		},
+	})
+
+	tests := map[string]struct {
+		givenRun         Run
+		expectedDecision Decision
+	}{
+		"failed run is kept": {
+			givenRun:         Run{ID: 1, Repo: "octo/web", Workflow: "lint", Conclusion: "failure", Duration: time.Minute},
+			expectedDecision: Decision{Keep: true, Reason: REASON_CONCLUSION, Rate: 1},
+		},
+		"cancelled run is kept": {
+			givenRun:         Run{ID: 1, Repo: "octo/web", Workflow: "lint", Conclusion: "cancelled", Duration: time.Minute},
+			expectedDecision: Decision{Keep: true, Reason: REASON_CONCLUSION, Rate: 1},
+		},
+		"slow run is kept": {
+			givenRun:         Run{ID: 1, Repo: "octo/web", Workflow: "lint", Conclusion: "success", Duration: time.Hour},
+			expectedDecision: Decision{Keep: true, Reason: REASON_DURATION, Rate: 1},
+		},
+		"first matching rule sets the rate": {
+			givenRun:         Run{ID: 1, Repo: "octo/web", Workflow: "lint", Conclusion: "success", Duration: time.Minute},
+			expectedDecision: Decision{Keep: false, Reason: REASON_RATE, Rate: 0},
+		},
+		"run that no rule matches": {
+			givenRun:         Run{ID: 1, Repo: "platform/infra", Workflow: "lint", Conclusion: "success", Duration: time.Minute},
+			expectedDecision: Decision{Keep: true, Reason: REASON_RATE, Rate: 1},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			// Act
+			decision := sampler.Sample(test.givenRun)
+
+			// Assert
+			assert.Equal(t, test.expectedDecision, decision)
+		})
+	}
+}
+
+func TestSampleKeepsTheRateOfRuns(t *testing.T) {
+	// Arrange
+	sampler := NewSampler(Options{Rate: 0.1})
+
+	// Act
+	kept := 0
+	for id := int64(1); id <= 10_000; id++ {
+		decision := sampler.Sample(Run{ID: id, Repo: "octo/web", Workflow: "ci", Conclusion: "success"})
+		if decision.Keep {
+			kept += 1
+		}
+		assert.Equal(t, decision, sampler.Sample(Run{ID: id, Repo: "octo/web", Workflow: "ci", Conclusion: "success"}), "the decision should be the same for a run")
+	}
+
+	// Assert
+	assert.InDelta(t, 1_000, kept, 100)
+}
+
+func TestDecisionSampleRate(t *testing.T) {
+	assert.Equal(t, int64(1), Decision{Rate: 1}.SampleRate())
+	assert.Equal(t, int64(20), Decision{Rate: 0.05}.SampleRate())
+	assert.Equal(t, int64(3), Decision{Rate: 0.3}.SampleRate())
+}
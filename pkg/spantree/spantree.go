@@ -0,0 +1,142 @@
+package spantree
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"time"
+
+	myOtel "github.com/pitoniak32/trace-export/pkg/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// the name of the tracer that spans are rendered with
+const renderTracerName = "github.com/pitoniak32/trace-export/render"
+
+// Node is a span with the spans that are its children, as it is returned from the debug endpoint.
+type Node struct {
+	Name         string         `json:"name"`
+	TraceID      string         `json:"trace_id"`
+	SpanID       string         `json:"span_id"`
+	ParentSpanID string         `json:"parent_span_id,omitempty"`
+	Kind         string         `json:"kind"`
+	StartTime    time.Time      `json:"start_time"`
+	EndTime      time.Time      `json:"end_time"`
+	Duration     string         `json:"duration"`
+	Attributes   map[string]any `json:"attributes,omitempty"`
+	Events       []Event        `json:"events,omitempty"`
+	Links        []Link         `json:"links,omitempty"`
+	Status       Status         `json:"status"`
+	Children     []*Node        `json:"children,omitempty"`
+}
+
+type Event struct {
+	Name       string         `json:"name"`
+	Time       time.Time      `json:"time"`
+	Attributes map[string]any `json:"attributes,omitempty"`
+}
+
+type Link struct {
+	TraceID    string         `json:"trace_id"`
+	SpanID     string         `json:"span_id"`
+	Attributes map[string]any `json:"attributes,omitempty"`
+}
+
+type Status struct {
+	Code        string `json:"code"`
+	Description string `json:"description,omitempty"`
+}
+
+// Render calls fn with a tracer that keeps its spans in memory instead of exporting them, and
+// returns the spans that were ended as trees. The spans are returned even when fn fails.
+func Render(ctx context.Context, fn func(ctx context.Context, tracer trace.Tracer) error) ([]*Node, error) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithIDGenerator(myOtel.NewIDGenerator()),
+		sdktrace.WithSyncer(exporter),
+	)
+	defer func() { _ = provider.Shutdown(context.Background()) }()
+
+	err := fn(ctx, provider.Tracer(renderTracerName))
+	return Build(exporter.GetSpans().Snapshots()), err
+}
+
+// Build arranges the spans into trees. Spans whose parent isn't one of the spans are roots, the
+// roots and the children of each span are ordered by their start time.
+func Build(spans []sdktrace.ReadOnlySpan) []*Node {
+	nodes := make(map[trace.SpanID]*Node, len(spans))
+	for _, span := range spans {
+		nodes[span.SpanContext().SpanID()] = newNode(span)
+	}
+
+	var roots []*Node
+	for _, span := range spans {
+		node := nodes[span.SpanContext().SpanID()]
+		parent, ok := nodes[span.Parent().SpanID()]
+		if span.Parent().IsValid() && ok && parent != node {
+			parent.Children = append(parent.Children, node)
+		} else {
+			roots = append(roots, node)
+		}
+	}
+
+	sortNodes(roots)
+	return roots
+}
+
+func sortNodes(nodes []*Node) {
+	slices.SortStableFunc(nodes, func(a, b *Node) int {
+		if c := a.StartTime.Compare(b.StartTime); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Name, b.Name)
+	})
+	for _, node := range nodes {
+		sortNodes(node.Children)
+	}
+}
+
+func newNode(span sdktrace.ReadOnlySpan) *Node {
+	node := &Node{
+		Name:       span.Name(),
+		TraceID:    span.SpanContext().TraceID().String(),
+		SpanID:     span.SpanContext().SpanID().String(),
+		Kind:       span.SpanKind().String(),
+		StartTime:  span.StartTime(),
+		EndTime:    span.EndTime(),
+		Duration:   span.EndTime().Sub(span.StartTime()).String(),
+		Attributes: attributeMap(span.Attributes()),
+		Status: Status{
+			Code:        span.Status().Code.String(),
+			Description: span.Status().Description,
+		},
+	}
+	if span.Parent().IsValid() {
+		node.ParentSpanID = span.Parent().SpanID().String()
+	}
+	for _, event := range span.Events() {
+		node.Events = append(node.Events, Event{Name: event.Name, Time: event.Time, Attributes: attributeMap(event.Attributes)})
+	}
+	for _, link := range span.Links() {
+		node.Links = append(node.Links, Link{
+			TraceID:    link.SpanContext.TraceID().String(),
+			SpanID:     link.SpanContext.SpanID().String(),
+			Attributes: attributeMap(link.Attributes),
+		})
+	}
+	return node
+}
+
+func attributeMap(attributes []attribute.KeyValue) map[string]any {
+	if len(attributes) == 0 {
+		return nil
+	}
+	m := make(map[string]any, len(attributes))
+	for _, kv := range attributes {
+		m[string(kv.Key)] = kv.Value.AsInterface()
+	}
+	return m
+}
@@ -0,0 +1,78 @@
+package spantree
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	eg "github.com/google/go-github/v66/github"
+	ig "github.com/pitoniak32/trace-export/pkg/github"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestRender(t *testing.T) {
+	// Arrange
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	workflowRun := eg.WorkflowRun{
+		ID:           eg.Int64(42),
+		Name:         eg.String("ci"),
+		RunAttempt:   eg.Int(1),
+		RunStartedAt: &eg.Timestamp{Time: start},
+		UpdatedAt:    &eg.Timestamp{Time: start.Add(10 * time.Minute)},
+	}
+	jobs := eg.Jobs{TotalCount: eg.Int(2), Jobs: []*eg.WorkflowJob{
+		{
+			ID:          eg.Int64(2),
+			Name:        eg.String("test"),
+			StartedAt:   &eg.Timestamp{Time: start.Add(2 * time.Minute)},
+			CompletedAt: &eg.Timestamp{Time: start.Add(8 * time.Minute)},
+			Steps: []*eg.TaskStep{
+				{Name: eg.String("go test"), Number: eg.Int64(1), StartedAt: &eg.Timestamp{Time: start.Add(3 * time.Minute)}, CompletedAt: &eg.Timestamp{Time: start.Add(7 * time.Minute)}},
+			},
+		},
+		{
+			ID:          eg.Int64(1),
+			Name:        eg.String("build"),
+			StartedAt:   &eg.Timestamp{Time: start.Add(time.Minute)},
+			CompletedAt: &eg.Timestamp{Time: start.Add(5 * time.Minute)},
+		},
+	}}
+
+	// Act
+	roots, err := Render(context.Background(), func(ctx context.Context, tracer trace.Tracer) error {
+		return ig.TraceWorkflowRun(ctx, workflowRun, 42, jobs, tracer)
+	})
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(roots))
+	root := roots[0]
+	assert.Equal(t, "ci", root.Name)
+	assert.Equal(t, ig.RunTraceID(42, 1).String(), root.TraceID)
+	assert.Equal(t, "10m0s", root.Duration)
+	assert.Equal(t, int64(42), root.Attributes["workflow_run.id"])
+
+	var children []string
+	for _, child := range root.Children {
+		children = append(children, child.Name)
+	}
+	assert.Equal(t, []string{"Queued", "build", "test"}, children, "children should be ordered by their start time")
+	assert.Equal(t, "go test", root.Children[2].Children[0].Name)
+	assert.Equal(t, root.Children[2].SpanID, root.Children[2].Children[0].ParentSpanID)
+}
+
+func TestRenderReturnsSpansOnError(t *testing.T) {
+	// Act
+	roots, err := Render(context.Background(), func(ctx context.Context, tracer trace.Tracer) error {
+		_, span := tracer.Start(ctx, "partial")
+		span.End()
+		return errors.New("failed halfway")
+	})
+
+	// Assert
+	assert.EqualError(t, err, "failed halfway")
+	assert.Equal(t, 1, len(roots))
+	assert.Equal(t, "Unset", roots[0].Status.Code)
+}
@@ -0,0 +1,131 @@
+package state
+
+import (
+	"context"
+	"maps"
+	"sync"
+	"time"
+
+	eg "github.com/google/go-github/v66/github"
+)
+
+// RunKey identifies a single attempt of a workflow run.
+type RunKey struct {
+	RunID      int64
+	RunAttempt int64
+}
+
+// Run is the state that is tracked for a workflow run attempt while it is in progress.
+type Run struct {
+	Key RunKey
+	// the time the workflow run started, as reported by the requested or in_progress event
+	StartedAt time.Time
+	// set once the span tracking how long the run was queued before the first job started has been emitted
+	QueuedTraced bool
+	// the ids of the jobs that have already been emitted as spans
+	TracedJobs map[int64]bool
+	// the latest workflow_job payload received for each job of the run
+	Jobs map[int64]*eg.WorkflowJob
+	// the workflow_run payload of the completed event
+	WorkflowRun *eg.WorkflowRun
+	// the time the completed event for the run was received, zero until then
+	CompletedAt time.Time
+	// set while the trace of the run is being assembled, so it is only assembled once at a time
+	Assembling bool
+	// the number of times assembling the trace of the run failed
+	FailedAssemblies int
+	// set once the trace of the run has been exported, the entry is kept until it expires so
+	// redelivered events for the run are ignored
+	Exported bool
+	// the last time this entry was written to the store
+	UpdatedAt time.Time
+}
+
+type Store interface {
+	// Get returns the run for the key, and false if the store has no entry for it.
+	Get(ctx context.Context, key RunKey) (Run, bool, error)
+	// Update calls fn with the current entry for the key (or a new one if it doesn't exist) and
+	// stores the result. The entry is not stored if fn returns an error.
+	Update(ctx context.Context, key RunKey, fn func(run *Run) error) error
+	Delete(ctx context.Context, key RunKey) error
+	// List returns all the runs in the store.
+	List(ctx context.Context) ([]Run, error)
+}
+
+type MemoryStore struct {
+	mu sync.Mutex
+	// entries that have not been updated for this long are dropped on the next write
+	expireAfter time.Duration
+	runs        map[RunKey]Run
+}
+
+func NewMemoryStore(expireAfter time.Duration) *MemoryStore {
+	return &MemoryStore{
+		expireAfter: expireAfter,
+		runs:        make(map[RunKey]Run),
+	}
+}
+
+func (s *MemoryStore) Get(_ context.Context, key RunKey) (Run, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	run, ok := s.runs[key]
+	return run, ok, nil
+}
+
+func (s *MemoryStore) Update(_ context.Context, key RunKey, fn func(run *Run) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	run, ok := s.runs[key]
+	if !ok {
+		run = Run{Key: key, TracedJobs: make(map[int64]bool), Jobs: make(map[int64]*eg.WorkflowJob)}
+	} else {
+		// copy the maps so a failed update doesn't leak into the stored entry
+		run.TracedJobs = maps.Clone(run.TracedJobs)
+		run.Jobs = maps.Clone(run.Jobs)
+	}
+
+	if err := fn(&run); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	run.UpdatedAt = now
+	s.runs[key] = run
+	s.expire(now)
+
+	return nil
+}
+
+func (s *MemoryStore) Delete(_ context.Context, key RunKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.runs, key)
+	return nil
+}
+
+func (s *MemoryStore) List(_ context.Context) ([]Run, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	runs := make([]Run, 0, len(s.runs))
+	for _, run := range s.runs {
+		runs = append(runs, run)
+	}
+	return runs, nil
+}
+
+// expire drops entries for runs that we never saw complete, must be called with the lock held.
+func (s *MemoryStore) expire(now time.Time) {
+	if s.expireAfter <= 0 {
+		return
+	}
+	for key, run := range s.runs {
+		if now.Sub(run.UpdatedAt) >= s.expireAfter {
+			delete(s.runs, key)
+		}
+	}
+}
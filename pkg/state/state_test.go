@@ -0,0 +1,112 @@
+package state
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	eg "github.com/google/go-github/v66/github"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryStoreUpdate(t *testing.T) {
+	tests := []struct {
+		name     string
+		existing bool
+		fnErr    error
+		want     Run
+		wantOk   bool
+	}{
+		{
+			name:   "creates the entry of a new run",
+			want:   Run{Key: RunKey{RunID: 1, RunAttempt: 1}, QueuedTraced: true, TracedJobs: map[int64]bool{7: true}, Jobs: map[int64]*eg.WorkflowJob{}},
+			wantOk: true,
+		},
+		{
+			name:     "updates the entry of a known run",
+			existing: true,
+			want:     Run{Key: RunKey{RunID: 1, RunAttempt: 1}, QueuedTraced: true, TracedJobs: map[int64]bool{6: true, 7: true}, Jobs: map[int64]*eg.WorkflowJob{}},
+			wantOk:   true,
+		},
+		{
+			name:  "doesn't store a failed update of a new run",
+			fnErr: errors.New("failed"),
+		},
+		{
+			name:     "doesn't leak a failed update into the entry",
+			existing: true,
+			fnErr:    errors.New("failed"),
+			want:     Run{Key: RunKey{RunID: 1, RunAttempt: 1}, TracedJobs: map[int64]bool{6: true}, Jobs: map[int64]*eg.WorkflowJob{}},
+			wantOk:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			ctx := context.Background()
+			key := RunKey{RunID: 1, RunAttempt: 1}
+			store := NewMemoryStore(time.Hour)
+			if tt.existing {
+				assert.NoError(t, store.Update(ctx, key, func(run *Run) error {
+					run.TracedJobs[6] = true
+					return nil
+				}))
+			}
+
+			// Act
+			err := store.Update(ctx, key, func(run *Run) error {
+				run.QueuedTraced = true
+				run.TracedJobs[7] = true
+				return tt.fnErr
+			})
+
+			// Assert
+			assert.Equal(t, tt.fnErr, err)
+			run, ok, err := store.Get(ctx, key)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantOk, ok)
+			run.UpdatedAt = time.Time{}
+			assert.Equal(t, tt.want, run)
+		})
+	}
+}
+
+func TestMemoryStoreDelete(t *testing.T) {
+	// Arrange
+	ctx := context.Background()
+	store := NewMemoryStore(time.Hour)
+	kept, deleted := RunKey{RunID: 1, RunAttempt: 1}, RunKey{RunID: 1, RunAttempt: 2}
+	for _, key := range []RunKey{kept, deleted} {
+		assert.NoError(t, store.Update(ctx, key, func(*Run) error { return nil }))
+	}
+
+	// Act
+	err := store.Delete(ctx, deleted)
+
+	// Assert
+	assert.NoError(t, err)
+	runs, err := store.List(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(runs))
+	assert.Equal(t, kept, runs[0].Key)
+}
+
+func TestMemoryStoreExpiresIdleRuns(t *testing.T) {
+	// Arrange
+	ctx := context.Background()
+	store := NewMemoryStore(time.Millisecond)
+	idle, active := RunKey{RunID: 1, RunAttempt: 1}, RunKey{RunID: 2, RunAttempt: 1}
+	assert.NoError(t, store.Update(ctx, idle, func(*Run) error { return nil }))
+	time.Sleep(2 * time.Millisecond)
+
+	// Act
+	assert.NoError(t, store.Update(ctx, active, func(*Run) error { return nil }))
+
+	// Assert
+	_, ok, _ := store.Get(ctx, idle)
+	assert.False(t, ok, "the idle run should have expired")
+	_, ok, _ = store.Get(ctx, active)
+	assert.True(t, ok, "the run that was just written should be kept")
+}
@@ -0,0 +1,223 @@
+package waterfall
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/pitoniak32/trace-export/pkg/spantree"
+)
+
+// the attribute of a job span with how long it waited for a runner
+const queuedKey = "workflow_job.queued.ms"
+
+// the name of the span of the time a run waited for its first job to start
+const queuedSpanName = "Queued"
+
+// labels longer than this are cut off
+const maxLabelWidth = 40
+
+const (
+	barChar   = "█"
+	queueChar = "░"
+)
+
+const (
+	ansiReset = "\x1b[0m"
+	ansiBold  = "\x1b[1m"
+	ansiDim   = "\x1b[2m"
+	ansiRed   = "\x1b[31m"
+)
+
+type Options struct {
+	// the width of the bars, in characters
+	Width int
+	// highlight failures and the critical path with ANSI colors, they are also marked without them
+	Color bool
+}
+
+// Render prints the trace of a run as a waterfall, with a row for every job and step. Rows of
+// failures are marked with '✗', and the jobs on the critical path (the chain of jobs that the run
+// waited on) with '*'. The time a job waited for a runner is shown before its bar.
+func Render(w io.Writer, root *spantree.Node, opts Options) error {
+	if opts.Width < 10 {
+		opts.Width = 10
+	}
+
+	r := renderer{
+		opts:     opts,
+		start:    root.StartTime,
+		total:    root.EndTime.Sub(root.StartTime),
+		critical: CriticalPath(root),
+	}
+
+	var rows []row
+	r.collect(root, 0, &rows)
+
+	labelWidth := 0
+	for _, row := range rows {
+		labelWidth = max(labelWidth, utf8.RuneCountInString(row.label))
+	}
+
+	fmt.Fprintf(w, "%s  %s  %s\n", root.Name, root.StartTime.UTC().Format(time.RFC3339), conclusion(root))
+	total := formatDuration(r.total)
+	fmt.Fprintf(w, "%s %-*s%*s\n", strings.Repeat(" ", 2+labelWidth+1+8), opts.Width/2, "0s", opts.Width-opts.Width/2, total)
+
+	for _, row := range rows {
+		line := fmt.Sprintf("%-2s%s %8s %s", row.marker, padRight(row.label, labelWidth), formatDuration(row.duration), r.bar(row))
+		if opts.Color && row.style != "" {
+			line = row.style + line + ansiReset
+		}
+		_, err := fmt.Fprintln(w, line)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// CriticalPath returns the span ids of the jobs that the run waited on. Without the dependencies
+// between the jobs, it starts from the job that ended last and goes back to the job that ended
+// last before it started, until there are no jobs left.
+func CriticalPath(root *spantree.Node) map[string]bool {
+	var jobs []*spantree.Node
+	for _, child := range root.Children {
+		if child.Attributes["workflow_job.id"] != nil {
+			jobs = append(jobs, child)
+		}
+	}
+
+	critical := map[string]bool{}
+	before := root.EndTime
+	for {
+		var last *spantree.Node
+		for _, job := range jobs {
+			if critical[job.SpanID] || job.EndTime.After(before) {
+				continue
+			}
+			if last == nil || job.EndTime.After(last.EndTime) {
+				last = job
+			}
+		}
+		if last == nil {
+			return critical
+		}
+		critical[last.SpanID] = true
+		before = last.StartTime
+	}
+}
+
+type row struct {
+	marker   string
+	label    string
+	style    string
+	queued   time.Duration
+	start    time.Time
+	duration time.Duration
+	queue    bool
+}
+
+type renderer struct {
+	opts     Options
+	start    time.Time
+	total    time.Duration
+	critical map[string]bool
+}
+
+func (r *renderer) collect(node *spantree.Node, depth int, rows *[]row) {
+	row := row{
+		label:    strings.Repeat("  ", depth) + node.Name,
+		start:    node.StartTime,
+		duration: node.EndTime.Sub(node.StartTime),
+		queue:    depth == 1 && node.Name == queuedSpanName,
+	}
+	if queued, ok := node.Attributes[queuedKey].(int64); ok {
+		row.queued = time.Duration(queued) * time.Millisecond
+	}
+	if utf8.RuneCountInString(row.label) > maxLabelWidth {
+		row.label = string([]rune(row.label)[:maxLabelWidth-1]) + "…"
+	}
+
+	switch {
+	case failed(node):
+		row.marker, row.style = "✗", ansiRed
+	case r.critical[node.SpanID]:
+		row.marker, row.style = "*", ansiBold
+	}
+	if row.queue {
+		row.style = ansiDim
+	}
+
+	*rows = append(*rows, row)
+	for _, child := range node.Children {
+		r.collect(child, depth+1, rows)
+	}
+}
+
+// bar draws the time the row waited and ran, on the scale of the whole run.
+func (r *renderer) bar(row row) string {
+	column := func(t time.Time) int {
+		if r.total <= 0 {
+			return 0
+		}
+		c := int(float64(t.Sub(r.start)) / float64(r.total) * float64(r.opts.Width))
+		return min(max(c, 0), r.opts.Width)
+	}
+
+	queueStart := column(row.start.Add(-row.queued))
+	start := column(row.start)
+	end := max(column(row.start.Add(row.duration)), start+1)
+	if end > r.opts.Width {
+		start, end = r.opts.Width-1, r.opts.Width
+	}
+
+	char := barChar
+	if row.queue {
+		char = queueChar
+	}
+
+	queue := strings.Repeat(queueChar, start-queueStart)
+	if r.opts.Color && queue != "" && !row.queue {
+		// the rest of the row may be bold or red, the queue is always dim
+		queue = ansiReset + ansiDim + queue + ansiReset + row.style
+	}
+	return strings.Repeat(" ", queueStart) + queue + strings.Repeat(char, end-start)
+}
+
+// the conclusions that fail a run, job or step
+var failedConclusions = map[string]bool{"failure": true, "timed_out": true, "startup_failure": true}
+
+func failed(node *spantree.Node) bool {
+	if node.Status.Code == "Error" {
+		return true
+	}
+	for _, key := range []string{"workflow_run.conclusion", "workflow_job.conclusion", "step.conclusion"} {
+		if conclusion, _ := node.Attributes[key].(string); failedConclusions[conclusion] {
+			return true
+		}
+	}
+	return false
+}
+
+func conclusion(root *spantree.Node) string {
+	status, _ := root.Attributes["workflow_run.status"].(string)
+	conclusion, _ := root.Attributes["workflow_run.conclusion"].(string)
+	if conclusion == "" {
+		return status
+	}
+	return status + "/" + conclusion
+}
+
+func formatDuration(d time.Duration) string {
+	if d < time.Second {
+		return d.Round(time.Millisecond).String()
+	}
+	return d.Round(time.Second).String()
+}
+
+func padRight(s string, width int) string {
+	return s + strings.Repeat(" ", max(width-utf8.RuneCountInString(s), 0))
+}
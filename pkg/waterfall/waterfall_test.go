@@ -0,0 +1,75 @@
+package waterfall
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pitoniak32/trace-export/pkg/spantree"
+	"github.com/stretchr/testify/assert"
+)
+
+func node(name string, start time.Time, duration time.Duration, attributes map[string]any, children ...*spantree.Node) *spantree.Node {
+	return &spantree.Node{
+		Name:       name,
+		SpanID:     name,
+		StartTime:  start,
+		EndTime:    start.Add(duration),
+		Attributes: attributes,
+		Status:     spantree.Status{Code: "Unset"},
+		Children:   children,
+	}
+}
+
+func job(id int64, conclusion string, queued time.Duration) map[string]any {
+	return map[string]any{"workflow_job.id": id, "workflow_job.conclusion": conclusion, "workflow_job.queued.ms": queued.Milliseconds()}
+}
+
+func TestRender(t *testing.T) {
+	// Arrange
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	root := node("ci", start, 10*time.Second, map[string]any{"workflow_run.status": "completed", "workflow_run.conclusion": "failure"},
+		node("Queued", start, time.Second, nil),
+		node("build", start.Add(time.Second), 4*time.Second, job(1, "success", time.Second),
+			node("go build", start.Add(2*time.Second), 2*time.Second, map[string]any{"step.conclusion": "success"}),
+		),
+		node("lint", start.Add(time.Second), 2*time.Second, job(2, "success", time.Second)),
+		node("test", start.Add(6*time.Second), 4*time.Second, job(3, "failure", time.Second)),
+	)
+	var out bytes.Buffer
+
+	// Act
+	err := Render(&out, root, Options{Width: 10})
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, strings.Join([]string{
+		"ci  2024-01-01T00:00:00Z  completed/failure",
+		"                        0s     10s",
+		"✗ ci                10s ██████████",
+		"    Queued           1s ░",
+		"*   build            4s ░████",
+		"      go build       2s   ██",
+		"    lint             2s ░██",
+		"✗   test             4s      ░████",
+		"",
+	}, "\n"), out.String())
+}
+
+func TestCriticalPath(t *testing.T) {
+	// Arrange
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	root := node("ci", start, 10*time.Minute, nil,
+		node("build", start, 3*time.Minute, job(1, "success", 0)),
+		node("lint", start, time.Minute, job(2, "success", 0)),
+		node("test", start.Add(4*time.Minute), 5*time.Minute, job(3, "success", 0)),
+		node("docs", start.Add(5*time.Minute), time.Minute, job(4, "success", 0)),
+	)
+
+	// Act
+	critical := CriticalPath(root)
+
+	// Assert
+	assert.Equal(t, map[string]bool{"build": true, "test": true}, critical)
+}
@@ -0,0 +1,133 @@
+package webhook
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Archive stores recorded webhooks. Implementations must be safe to call from concurrent requests.
+type Archive interface {
+	Write(ctx context.Context, record Record) error
+	Close() error
+}
+
+// the suffix of the file that is being written to, it is renamed once it is rotated
+const partialSuffix = ".partial"
+
+// FileArchive writes the records to gzip compressed JSONL files in a directory. A new file is
+// started once the current one has MaxBytes of (uncompressed) records or is older than MaxAge.
+type FileArchive struct {
+	dir      string
+	maxBytes int64
+	maxAge   time.Duration
+
+	mu       sync.Mutex
+	file     *os.File
+	gz       *gzip.Writer
+	written  int64
+	openedAt time.Time
+	closed   bool
+}
+
+// NewFileArchive creates the directory if needed. A zero maxBytes or maxAge doesn't rotate on that
+// limit.
+func NewFileArchive(dir string, maxBytes int64, maxAge time.Duration) (*FileArchive, error) {
+	err := os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create archive directory '%s': %w", dir, err)
+	}
+
+	return &FileArchive{dir: dir, maxBytes: maxBytes, maxAge: maxAge}, nil
+}
+
+func (a *FileArchive) Write(ctx context.Context, record Record) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to encode record: %w", err)
+	}
+	line = append(line, '\n')
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.closed {
+		return errors.New("archive is closed")
+	}
+
+	now := time.Now()
+	if a.file != nil && a.shouldRotate(now) {
+		err = a.rotate()
+		if err != nil {
+			return err
+		}
+	}
+	if a.file == nil {
+		err = a.open(now)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = a.gz.Write(line)
+	if err != nil {
+		return fmt.Errorf("failed to write record to '%s': %w", a.file.Name(), err)
+	}
+	a.written += int64(len(line))
+
+	// so the records written so far can be read from the partial file if the process dies
+	return a.gz.Flush()
+}
+
+func (a *FileArchive) Close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.closed = true
+	if a.file == nil {
+		return nil
+	}
+	return a.rotate()
+}
+
+// shouldRotate must be called with the lock held.
+func (a *FileArchive) shouldRotate(now time.Time) bool {
+	return (a.maxBytes > 0 && a.written >= a.maxBytes) || (a.maxAge > 0 && now.Sub(a.openedAt) >= a.maxAge)
+}
+
+// open must be called with the lock held.
+func (a *FileArchive) open(now time.Time) error {
+	name := fmt.Sprintf("webhooks-%s.jsonl.gz", now.UTC().Format("20060102T150405.000000000Z"))
+	file, err := os.OpenFile(filepath.Join(a.dir, name+partialSuffix), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to create archive file: %w", err)
+	}
+
+	a.file = file
+	a.gz = gzip.NewWriter(file)
+	a.written = 0
+	a.openedAt = now
+	return nil
+}
+
+// rotate finishes the current file, and must be called with the lock held.
+func (a *FileArchive) rotate() error {
+	partial := a.file.Name()
+	err := errors.Join(a.gz.Close(), a.file.Close())
+	a.file, a.gz = nil, nil
+	if err != nil {
+		return fmt.Errorf("failed to close archive file '%s': %w", partial, err)
+	}
+
+	err = os.Rename(partial, partial[:len(partial)-len(partialSuffix)])
+	if err != nil {
+		return fmt.Errorf("failed to rotate archive file '%s': %w", partial, err)
+	}
+	return nil
+}
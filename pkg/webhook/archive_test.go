@@ -0,0 +1,70 @@
+package webhook
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileArchiveRotatesOnSize(t *testing.T) {
+	// Arrange
+	dir := t.TempDir()
+	archive, err := NewFileArchive(dir, 150, 0)
+	assert.NoError(t, err)
+
+	// Act
+	for _, id := range []string{"1", "2", "3"} {
+		record := Record{DeliveryID: id, Event: "workflow_run", ReceivedAt: time.Now()}
+		record.SetPayload([]byte(`{"action": "completed"}`))
+		assert.NoError(t, archive.Write(context.Background(), record))
+	}
+	partials, _ := filepath.Glob(filepath.Join(dir, "*"+partialSuffix))
+	assert.NoError(t, archive.Close())
+
+	// Assert
+	assert.Equal(t, 1, len(partials), "only the current file should be partial")
+	files, _ := filepath.Glob(filepath.Join(dir, "webhooks-*.jsonl.gz"))
+	sort.Strings(files)
+	assert.Equal(t, 2, len(files), "the first file should be rotated after two records")
+
+	var ids []string
+	for _, name := range files {
+		file, err := os.Open(name)
+		assert.NoError(t, err)
+		err = ReadRecords(file, func(record Record) error {
+			ids = append(ids, record.DeliveryID)
+			return nil
+		})
+		assert.NoError(t, err)
+		file.Close()
+	}
+	assert.Equal(t, []string{"1", "2", "3"}, ids)
+
+	assert.Error(t, archive.Write(context.Background(), Record{}), "a closed archive should not be written to")
+	for _, name := range files {
+		assert.False(t, strings.HasSuffix(name, partialSuffix))
+	}
+}
+
+func TestFileArchiveRotatesOnAge(t *testing.T) {
+	// Arrange
+	dir := t.TempDir()
+	archive, err := NewFileArchive(dir, 0, 10*time.Millisecond)
+	assert.NoError(t, err)
+
+	// Act
+	assert.NoError(t, archive.Write(context.Background(), Record{DeliveryID: "1", Body: []byte("{}")}))
+	time.Sleep(20 * time.Millisecond)
+	assert.NoError(t, archive.Write(context.Background(), Record{DeliveryID: "2", Body: []byte("{}")}))
+
+	// Assert
+	rotated, _ := filepath.Glob(filepath.Join(dir, "webhooks-*.jsonl.gz"))
+	assert.Equal(t, 1, len(rotated))
+	assert.NoError(t, archive.Close())
+}
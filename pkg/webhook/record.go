@@ -0,0 +1,127 @@
+package webhook
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	EventHeader     = "X-GitHub-Event"
+	DeliveryHeader  = "X-GitHub-Delivery"
+	SignatureHeader = "X-Hub-Signature-256"
+)
+
+// Record is a webhook delivery as it was received, one per line of a JSONL file.
+type Record struct {
+	DeliveryID string    `json:"delivery_id,omitempty"`
+	Event      string    `json:"event,omitempty"`
+	ReceivedAt time.Time `json:"received_at"`
+	// the headers of the delivery, keyed by their canonical name
+	Headers map[string]string `json:"headers,omitempty"`
+	// the payload when it is JSON, anything else is stored as a JSON string
+	Body json.RawMessage `json:"body"`
+}
+
+// NewRecord records the request with the headers, the payload has already been read from its body.
+func NewRecord(r *http.Request, payload []byte, receivedAt time.Time, headers []string) Record {
+	record := Record{
+		DeliveryID: r.Header.Get(DeliveryHeader),
+		Event:      r.Header.Get(EventHeader),
+		ReceivedAt: receivedAt,
+		Headers:    make(map[string]string),
+	}
+	for _, name := range headers {
+		if value := r.Header.Get(name); value != "" {
+			record.Headers[http.CanonicalHeaderKey(name)] = value
+		}
+	}
+	record.SetPayload(payload)
+	return record
+}
+
+// SetPayload sets the body, keeping JSON payloads readable in the file.
+func (r *Record) SetPayload(payload []byte) {
+	if json.Valid(payload) {
+		r.Body = json.RawMessage(payload)
+		return
+	}
+	quoted, _ := json.Marshal(string(payload))
+	r.Body = quoted
+}
+
+// Payload returns the body as it was received.
+func (r Record) Payload() []byte {
+	var payload string
+	if len(r.Body) > 0 && r.Body[0] == '"' && json.Unmarshal(r.Body, &payload) == nil {
+		return []byte(payload)
+	}
+	return r.Body
+}
+
+// NewRequest returns a delivery of the record to the url, with its original headers.
+func (r Record) NewRequest(ctx context.Context, url string) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(r.Payload()))
+	if err != nil {
+		return nil, err
+	}
+
+	for name, value := range r.Headers {
+		req.Header.Set(name, value)
+	}
+	if r.Event != "" {
+		req.Header.Set(EventHeader, r.Event)
+	}
+	if r.DeliveryID != "" {
+		req.Header.Set(DeliveryHeader, r.DeliveryID)
+	}
+	if req.Header.Get("Content-Type") == "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	return req, nil
+}
+
+// ReadRecords calls fn with each record of the JSONL input, stopping at the first error. Blank lines
+// are skipped, and gzip compressed input (like the files of a FileArchive) is decompressed.
+func ReadRecords(in io.Reader, fn func(Record) error) error {
+	reader := bufio.NewReader(in)
+	if magic, _ := reader.Peek(2); bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		gz, err := gzip.NewReader(reader)
+		if err != nil {
+			return fmt.Errorf("failed to read compressed records: %w", err)
+		}
+		defer gz.Close()
+		reader = bufio.NewReader(gz)
+	}
+	lineNumber := 0
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("failed to read records: %w", err)
+		}
+		lineNumber += 1
+
+		if trimmed := strings.TrimSpace(string(line)); trimmed != "" {
+			var record Record
+			if jsonErr := json.Unmarshal([]byte(trimmed), &record); jsonErr != nil {
+				return fmt.Errorf("invalid record on line %d: %w", lineNumber, jsonErr)
+			}
+			if fnErr := fn(record); fnErr != nil {
+				return fnErr
+			}
+		}
+
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package webhook
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	ig "github.com/pitoniak32/trace-export/pkg/github"
+)
+
+// the value that redacted fields are replaced with
+const Redacted = "[REDACTED]"
+
+// GitHub doesn't deliver payloads larger than 25 MB, anything larger isn't a webhook of theirs.
+const MAX_PAYLOAD_BYTES = 25 << 20
+
+// DefaultHeaders are the headers that are recorded when none are configured. The signature is left
+// out, replays are signed again.
+var DefaultHeaders = []string{
+	"Content-Type",
+	"User-Agent",
+	"X-GitHub-Hook-ID",
+	"X-GitHub-Hook-Installation-Target-ID",
+	"X-GitHub-Hook-Installation-Target-Type",
+}
+
+// Recorder writes every webhook it receives to an archive, before it is handled. Only the webhooks
+// signed with one of the secrets are written.
+type Recorder struct {
+	archive Archive
+	// the current webhook secrets, they can change when the config is reloaded
+	secrets func() []string
+	headers []string
+	// dotted paths of the payload fields that are replaced, '*' matches any key or array element and
+	// arrays without a '*' apply the rest of the path to each element
+	redact [][]string
+}
+
+func NewRecorder(archive Archive, secrets func() []string, headers []string, redact []string) *Recorder {
+	if len(headers) == 0 {
+		headers = DefaultHeaders
+	}
+
+	paths := make([][]string, 0, len(redact))
+	for _, path := range redact {
+		paths = append(paths, strings.Split(path, "."))
+	}
+
+	return &Recorder{archive: archive, secrets: secrets, headers: headers, redact: paths}
+}
+
+// Middleware records the request and passes it on with its body intact. A webhook that fails to be
+// recorded, or isn't recorded because its signature doesn't match, is still handled (and rejected
+// by the handler when it isn't signed). Bodies larger than MAX_PAYLOAD_BYTES are refused.
+func (rec *Recorder) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		payload, err := io.ReadAll(http.MaxBytesReader(w, r.Body, MAX_PAYLOAD_BYTES))
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, "payload too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		if err != nil {
+			http.Error(w, "failed to read body", http.StatusBadRequest)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(payload))
+
+		if !rec.verified(r, payload) {
+			slog.Debug("not recording unsigned webhook", "delivery", r.Header.Get(DeliveryHeader))
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		record := NewRecord(r, rec.Redact(payload), time.Now(), rec.headers)
+		err = rec.archive.Write(r.Context(), record)
+		if err != nil {
+			slog.Error("failed to record webhook", "delivery", record.DeliveryID, "err", err)
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// verified checks the signature of the payload the same way the handler does, so anyone who can
+// reach the endpoint can't fill the archive.
+func (rec *Recorder) verified(r *http.Request, payload []byte) bool {
+	var secrets []string
+	if rec.secrets != nil {
+		secrets = rec.secrets()
+	}
+
+	signed := r.Clone(r.Context())
+	signed.Body = io.NopCloser(bytes.NewReader(payload))
+	_, err := ig.ValidateWebhookSignature(signed, secrets)
+	return err == nil
+}
+
+// Redact replaces the configured fields of a JSON payload, anything else is returned as is.
+func (rec *Recorder) Redact(payload []byte) []byte {
+	if len(rec.redact) == 0 {
+		return payload
+	}
+
+	var body any
+	if err := json.Unmarshal(payload, &body); err != nil {
+		return payload
+	}
+
+	redacted := false
+	for _, path := range rec.redact {
+		redacted = redactPath(body, path) || redacted
+	}
+	if !redacted {
+		return payload
+	}
+
+	out, err := json.Marshal(body)
+	if err != nil {
+		return payload
+	}
+	return out
+}
+
+// redactPath replaces the values at the path, and reports whether anything was replaced.
+func redactPath(value any, path []string) bool {
+	redacted := false
+	visit := func(key string, child any, set func(any)) {
+		if path[0] != "*" && path[0] != key {
+			return
+		}
+		if len(path) == 1 {
+			set(Redacted)
+			redacted = true
+			return
+		}
+		redacted = redactPath(child, path[1:]) || redacted
+	}
+
+	switch v := value.(type) {
+	case map[string]any:
+		for key, child := range v {
+			visit(key, child, func(replacement any) { v[key] = replacement })
+		}
+	case []any:
+		for i, child := range v {
+			if path[0] == "*" {
+				visit("*", child, func(replacement any) { v[i] = replacement })
+			} else {
+				// arrays don't need their own segment, the path applies to each element
+				redacted = redactPath(child, path) || redacted
+			}
+		}
+	}
+
+	return redacted
+}
@@ -0,0 +1,128 @@
+package webhook
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type memoryArchive struct {
+	mu      sync.Mutex
+	records []Record
+}
+
+func (a *memoryArchive) Write(ctx context.Context, record Record) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.records = append(a.records, record)
+	return nil
+}
+
+func (a *memoryArchive) Close() error { return nil }
+
+func TestRecorderMiddleware(t *testing.T) {
+	// Arrange
+	archive := &memoryArchive{}
+	secrets := func() []string { return []string{"secret"} }
+	recorder := NewRecorder(archive, secrets, nil, []string{"sender.email", "commits.author", "workflow_run.head_commit.*"})
+	payload := `{"sender": {"login": "octo", "email": "octo@example.com"}, "commits": [{"id": "a", "author": "octo"}, {"id": "b"}], "workflow_run": {"head_commit": {"id": "a", "message": "fix"}}}`
+
+	var handled string
+	handler := recorder.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		handled = string(body)
+	}))
+
+	r := httptest.NewRequest("POST", "/webhook", strings.NewReader(payload))
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set(EventHeader, "workflow_run")
+	r.Header.Set(DeliveryHeader, "delivery-1")
+	r.Header.Set(SignatureHeader, Sign([]byte(payload), "secret"))
+
+	// Act
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+
+	// Assert
+	assert.Equal(t, payload, handled, "the handler should get the payload as it was received")
+	assert.Equal(t, 1, len(archive.records))
+	record := archive.records[0]
+	assert.Equal(t, "delivery-1", record.DeliveryID)
+	assert.Equal(t, "workflow_run", record.Event)
+	assert.Equal(t, map[string]string{"Content-Type": "application/json"}, record.Headers, "the signature should not be recorded by default")
+	assert.JSONEq(t, `{
+		"sender": {"login": "octo", "email": "[REDACTED]"},
+		"commits": [{"id": "a", "author": "[REDACTED]"}, {"id": "b"}],
+		"workflow_run": {"head_commit": {"id": "[REDACTED]", "message": "[REDACTED]"}}
+	}`, string(record.Body))
+}
+
+func TestRecorderMiddlewareSkipsUnsignedWebhooks(t *testing.T) {
+	tests := map[string]struct {
+		signature string
+	}{
+		"unsigned":        {signature: ""},
+		"wrong signature": {signature: Sign([]byte(`{"action": "completed"}`), "other")},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			// Arrange
+			archive := &memoryArchive{}
+			recorder := NewRecorder(archive, func() []string { return []string{"secret"} }, nil, nil)
+			handled := false
+			handler := recorder.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				handled = true
+			}))
+
+			r := httptest.NewRequest("POST", "/webhook", strings.NewReader(`{"action": "completed"}`))
+			r.Header.Set("Content-Type", "application/json")
+			if test.signature != "" {
+				r.Header.Set(SignatureHeader, test.signature)
+			}
+
+			// Act
+			handler.ServeHTTP(httptest.NewRecorder(), r)
+
+			// Assert
+			assert.True(t, handled, "the handler should still get the webhook, to reject it")
+			assert.Equal(t, 0, len(archive.records))
+		})
+	}
+}
+
+func TestRecorderMiddlewareRefusesLargePayloads(t *testing.T) {
+	// Arrange
+	archive := &memoryArchive{}
+	recorder := NewRecorder(archive, nil, nil, nil)
+	handled := false
+	handler := recorder.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handled = true
+	}))
+	r := httptest.NewRequest("POST", "/webhook", strings.NewReader(strings.Repeat("a", MAX_PAYLOAD_BYTES+1)))
+	w := httptest.NewRecorder()
+
+	// Act
+	handler.ServeHTTP(w, r)
+
+	// Assert
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	assert.False(t, handled)
+	assert.Equal(t, 0, len(archive.records))
+}
+
+func TestRedactLeavesNonJSONPayloads(t *testing.T) {
+	// Arrange
+	recorder := NewRecorder(&memoryArchive{}, nil, nil, []string{"sender"})
+
+	// Act
+	redacted := recorder.Redact([]byte("payload=%7B%7D"))
+
+	// Assert
+	assert.Equal(t, "payload=%7B%7D", string(redacted))
+}
@@ -0,0 +1,156 @@
+package webhook
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	myOtel "github.com/pitoniak32/trace-export/pkg/otel"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	tracer = otel.Tracer(myOtel.SERVICE_TRACER_NAME)
+)
+
+// SendFn delivers a replayed webhook, and returns the status code of the response.
+type SendFn func(req *http.Request) (int, error)
+
+// SendToHandler delivers the webhooks to a handler in the same process. A panic in the handler fails
+// the delivery, like the server would, instead of stopping the replay.
+func SendToHandler(handler http.Handler) SendFn {
+	return func(req *http.Request) (status int, err error) {
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				status, err = http.StatusInternalServerError, fmt.Errorf("handler panicked: %v", recovered)
+			}
+		}()
+
+		w := &statusRecorder{header: make(http.Header), status: http.StatusOK}
+		handler.ServeHTTP(w, req)
+		return w.status, nil
+	}
+}
+
+// SendToURL delivers the webhooks over http.
+func SendToURL(client *http.Client) SendFn {
+	return func(req *http.Request) (int, error) {
+		res, err := client.Do(req)
+		if err != nil {
+			return 0, err
+		}
+		defer res.Body.Close()
+		_, _ = io.Copy(io.Discard, res.Body)
+		return res.StatusCode, nil
+	}
+}
+
+// statusRecorder is the response of a webhook handled in process, only the status is kept.
+type statusRecorder struct {
+	header      http.Header
+	status      int
+	wroteHeader bool
+}
+
+func (w *statusRecorder) Header() http.Header { return w.header }
+
+func (w *statusRecorder) Write(data []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	return len(data), nil
+}
+
+func (w *statusRecorder) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.status = status
+		w.wroteHeader = true
+	}
+}
+
+type ReplayOptions struct {
+	// the url the records are delivered to, only the path matters when they are handled in process
+	URL string
+	// wait between the records as long as between when they were received, divided by Speed
+	PreserveTiming bool
+	Speed          float64
+	// the records are signed again with the secret, since their bodies may have been redacted
+	Secret string
+}
+
+type ReplaySummary struct {
+	Sent   int
+	Failed int
+}
+
+// Replay delivers every record of the JSONL input in order. Records that fail to deliver, or get
+// a status other than 2xx, are logged and counted as failed.
+func Replay(ctx context.Context, in io.Reader, send SendFn, opts ReplayOptions) (ReplaySummary, error) {
+	ctx, span := tracer.Start(ctx, "ReplayWebhooks", trace.WithAttributes(
+		attribute.String("replay.url", opts.URL),
+		attribute.Bool("replay.preserve_timing", opts.PreserveTiming),
+	))
+	defer span.End()
+
+	if opts.Speed <= 0 {
+		opts.Speed = 1
+	}
+
+	summary := ReplaySummary{}
+	var previous time.Time
+	err := ReadRecords(in, func(record Record) error {
+		if opts.PreserveTiming && !previous.IsZero() && record.ReceivedAt.After(previous) {
+			wait := time.Duration(float64(record.ReceivedAt.Sub(previous)) / opts.Speed)
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(wait):
+			}
+		}
+		if !record.ReceivedAt.IsZero() {
+			previous = record.ReceivedAt
+		}
+
+		req, err := record.NewRequest(ctx, opts.URL)
+		if err != nil {
+			return fmt.Errorf("failed to create request for delivery '%s': %w", record.DeliveryID, err)
+		}
+		if opts.Secret != "" {
+			req.Header.Set(SignatureHeader, Sign(record.Payload(), opts.Secret))
+		}
+
+		status, err := send(req)
+		if err != nil || status < 200 || status > 299 {
+			slog.Error("failed to replay webhook", "delivery", record.DeliveryID, "event", record.Event, "status", status, "err", err)
+			summary.Failed += 1
+			return nil
+		}
+		summary.Sent += 1
+		return nil
+	})
+
+	span.SetAttributes(
+		attribute.Int("replay.total.sent", summary.Sent),
+		attribute.Int("replay.total.failed", summary.Failed),
+	)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	return summary, err
+}
+
+// Sign returns the X-Hub-Signature-256 header of the payload.
+func Sign(payload []byte, secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
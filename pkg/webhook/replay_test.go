@@ -0,0 +1,78 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	ig "github.com/pitoniak32/trace-export/pkg/github"
+	"github.com/stretchr/testify/assert"
+)
+
+const records = `{"delivery_id": "1", "event": "workflow_run", "received_at": "2024-01-01T00:00:00Z", "body": {"action": "completed"}}
+
+{"delivery_id": "2", "event": "workflow_job", "received_at": "2024-01-01T00:00:00.2Z", "headers": {"Content-Type": "application/x-www-form-urlencoded"}, "body": "payload=%7B%7D"}
+{"delivery_id": "3", "event": "ping", "received_at": "2024-01-01T00:00:00.4Z", "body": {}}
+`
+
+func TestReplay(t *testing.T) {
+	// Arrange
+	var events, bodies []string
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		_, err := ig.ValidateWebhookSignature(r, []string{"secret"})
+		assert.NoError(t, err, "the records should be signed again")
+
+		events = append(events, r.Header.Get(EventHeader))
+		bodies = append(bodies, string(body))
+		if r.Header.Get(EventHeader) == "ping" {
+			panic("unexpected event")
+		}
+	})
+
+	// Act
+	summary, err := Replay(context.Background(), strings.NewReader(records), SendToHandler(handler), ReplayOptions{
+		URL:    "/webhook",
+		Secret: "secret",
+	})
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, ReplaySummary{Sent: 2, Failed: 1}, summary, "the panic should only fail its own delivery")
+	assert.Equal(t, []string{"workflow_run", "workflow_job", "ping"}, events)
+	assert.Equal(t, `{"action": "completed"}`, bodies[0])
+	assert.Equal(t, "payload=%7B%7D", bodies[1], "non JSON bodies should be sent as they were received")
+}
+
+func TestReplayPreservesTiming(t *testing.T) {
+	// Arrange
+	send := func(req *http.Request) (int, error) { return http.StatusOK, nil }
+
+	// Act
+	start := time.Now()
+	summary, err := Replay(context.Background(), strings.NewReader(records), send, ReplayOptions{
+		URL:            "/webhook",
+		PreserveTiming: true,
+		Speed:          2,
+	})
+	elapsed := time.Since(start)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, 3, summary.Sent)
+	assert.GreaterOrEqual(t, elapsed, 200*time.Millisecond, "400ms of records at double speed")
+	assert.Less(t, elapsed, 400*time.Millisecond)
+}
+
+func TestReadRecordsInvalidLine(t *testing.T) {
+	// Act
+	err := ReadRecords(strings.NewReader("{}\nnot json\n"), func(Record) error { return nil })
+
+	// Assert
+	assert.ErrorContains(t, err, "invalid record on line 2")
+}
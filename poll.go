@@ -0,0 +1,30 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+
+	eg "github.com/google/go-github/v66/github"
+	"github.com/pitoniak32/trace-export/pkg/config"
+	ig "github.com/pitoniak32/trace-export/pkg/github"
+	"github.com/pitoniak32/trace-export/pkg/poller"
+)
+
+// startPoller polls the repos that can't send us webhooks, sharing the client and rate limit budget
+// with the rest of the service.
+func startPoller(ctx context.Context, client *eg.Client, budget *ig.RateBudget, cfg config.Poll) error {
+	cursor, err := poller.LoadCursor(cfg.Cursor)
+	if err != nil {
+		return err
+	}
+
+	p, err := poller.NewPoller(client, budget, workflowRunTracer, cursor, cfg.Repos, cfg.Lookback)
+	if err != nil {
+		return err
+	}
+
+	slog.Info("polling workflow runs", "repos", cfg.Repos, "interval", cfg.Interval, "cursor", cfg.Cursor)
+	p.SchedulePoll(ctx, cfg.Interval)
+
+	return nil
+}
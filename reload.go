@@ -0,0 +1,34 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/pitoniak32/trace-export/pkg/config"
+)
+
+// watchReloads reloads the config on SIGHUP, and when the config file changes if there is one.
+func watchReloads(ctx context.Context, reloader *config.Reloader, configPath string, interval time.Duration) {
+	if configPath != "" && interval > 0 {
+		slog.Info("watching config file for changes", "config", configPath, "interval", interval)
+		reloader.ScheduleWatch(ctx, configPath, interval)
+	}
+
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	go func() {
+		defer signal.Stop(hangup)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-hangup:
+				_, _ = reloader.Reload(ctx, "SIGHUP")
+			}
+		}
+	}()
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/pitoniak32/trace-export/pkg/cache"
+	"github.com/pitoniak32/trace-export/pkg/chrometrace"
+	"github.com/pitoniak32/trace-export/pkg/config"
+	ig "github.com/pitoniak32/trace-export/pkg/github"
+	"github.com/pitoniak32/trace-export/pkg/spantree"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const TRACE_EXPORT_RENDER_FORMAT_KEY string = "TRACE_EXPORT_RENDER_FORMAT"
+const TRACE_EXPORT_RENDER_OUT_KEY string = "TRACE_EXPORT_RENDER_OUT"
+
+// runRender fetches a workflow run like the export command, but writes its spans to a file instead
+// of exporting them, for timeline views like ui.perfetto.dev or to upload as an artifact.
+func runRender(ctx context.Context, args []string) (err error) {
+	flags := newCommandFlags("render", renderUsage)
+	cfg, err := flags.loadConfig(args, true)
+	if err != nil {
+		return err
+	}
+	var repo, format, out string
+	var runId, runAttempt int64
+	flags.envString(&repo, "repo", "GITHUB_REPOSITORY", "", "repo of the run as 'owner/repo'")
+	flags.envInt64(&runId, "run-id", "GITHUB_RUN_ID", 0, "id of the run")
+	flags.envInt64(&runAttempt, "run-attempt", "GITHUB_RUN_ATTEMPT", 1, "attempt of the run")
+	flags.envString(&format, "format", TRACE_EXPORT_RENDER_FORMAT_KEY, "chrome", "chrome for the Chrome Trace Event Format, or json for the span tree of /debug/render")
+	flags.envString(&out, "out", TRACE_EXPORT_RENDER_OUT_KEY, "-", "file the trace is written to, '-' writes to stdout")
+	err = flags.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	owner, name, err := ig.SplitRepo(repo)
+	if err != nil {
+		return err
+	}
+	if runId == 0 {
+		return errors.New("a run id is required, pass -run-id or set GITHUB_RUN_ID")
+	}
+	if format != "chrome" && format != "json" {
+		return fmt.Errorf("invalid -format '%s', must be chrome or json", format)
+	}
+
+	// the trace can be written to stdout, so it can't be mixed with the logs
+	setupLogging(cfg, os.Stderr)
+
+	spans, err := renderRun(ctx, cfg, ig.RunRef{Owner: owner, Repo: name, RunID: runId, RunAttempt: runAttempt})
+	if err != nil {
+		return err
+	}
+
+	var w io.Writer = os.Stdout
+	if out != "-" {
+		f, err := os.Create(out)
+		if err != nil {
+			return fmt.Errorf("failed to create '%s': %w", out, err)
+		}
+		defer func() {
+			err = errors.Join(err, f.Close())
+		}()
+		w = f
+	}
+
+	return writeSpans(w, format, spans)
+}
+
+// renderRun fetches a run attempt and returns its spans, without exporting them. Whatever is still
+// in progress ends now.
+func renderRun(ctx context.Context, cfg *config.Config, ref ig.RunRef) ([]*spantree.Node, error) {
+	client, err := newGitHubClient(cfg.GitHub)
+	if err != nil {
+		return nil, err
+	}
+	budget := ig.NewRateBudget(0)
+	run, jobs, err := ig.GetRunAttempt(ctx, client, budget, ref.Owner, ref.Repo, ref.RunID, ref.RunAttempt)
+	if err != nil {
+		return nil, err
+	}
+	closedRun, closedJobs := ig.CloseInProgress(*run, *jobs, time.Now())
+
+	slog.Info("rendering workflow run", "repo", ref.Owner+"/"+ref.Repo, "run.id", ref.RunID, "run.attempt", ref.RunAttempt, "run.status", run.GetStatus(), "jobs", closedJobs.GetTotalCount())
+	propCache := cache.NewPropCache(cfg.Cache.TTL, ig.RefreshCustomProperties(client, budget))
+	ctx = withEnricher(ctx, func() *config.Config { return cfg }, propCache)
+	return spantree.Render(ctx, func(ctx context.Context, tracer trace.Tracer) error {
+		return ig.TraceWorkflowRun(ctx, closedRun, ref.RunID, closedJobs, tracer)
+	})
+}
+
+// writeSpans writes the span trees in the format of the render command.
+func writeSpans(w io.Writer, format string, spans []*spantree.Node) error {
+	if format == "chrome" {
+		return chrometrace.Write(w, spans)
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(spans)
+}
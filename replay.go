@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/pitoniak32/trace-export/pkg/config"
+	"github.com/pitoniak32/trace-export/pkg/webhook"
+)
+
+const TRACE_EXPORT_REPLAY_FILE_KEY string = "TRACE_EXPORT_REPLAY_FILE"
+const TRACE_EXPORT_REPLAY_URL_KEY string = "TRACE_EXPORT_REPLAY_URL"
+const TRACE_EXPORT_REPLAY_PRESERVE_TIMING_KEY string = "TRACE_EXPORT_REPLAY_PRESERVE_TIMING"
+const TRACE_EXPORT_REPLAY_SPEED_KEY string = "TRACE_EXPORT_REPLAY_SPEED"
+
+// runReplay delivers recorded webhooks through the same handler as /webhook, or to the /webhook of
+// a running service, to reproduce bugs and load test.
+func runReplay(ctx context.Context, args []string) (err error) {
+	flags := newCommandFlags("replay", replayUsage)
+	cfg, err := flags.loadConfig(args, false)
+	if err != nil {
+		return err
+	}
+	var file, url string
+	var preserveTiming bool
+	var speed float64
+	flags.envString(&file, "file", TRACE_EXPORT_REPLAY_FILE_KEY, "-", "JSONL file of recorded webhooks, '-' reads stdin")
+	flags.envString(&url, "url", TRACE_EXPORT_REPLAY_URL_KEY, "", "webhook url of a running service, the webhooks are handled in process when empty")
+	flags.envBool(&preserveTiming, "preserve-timing", TRACE_EXPORT_REPLAY_PRESERVE_TIMING_KEY, false, "wait between webhooks as long as between when they were received, instead of sending them as fast as possible")
+	flags.envFloat64(&speed, "speed", TRACE_EXPORT_REPLAY_SPEED_KEY, 1, "with -preserve-timing, divides the waits between webhooks")
+	err = flags.Parse(args)
+	if err != nil {
+		return err
+	}
+	if speed <= 0 {
+		return fmt.Errorf("invalid -speed %v, must be positive", speed)
+	}
+
+	var in io.Reader = os.Stdin
+	if file != "-" {
+		f, err := os.Open(file)
+		if err != nil {
+			return fmt.Errorf("failed to open records: %w", err)
+		}
+		defer f.Close()
+		in = f
+	}
+
+	err = setup(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err = errors.Join(err, otelShutdown(context.Background()))
+	}()
+
+	ctxCancelScheduled, cancelScheduled := context.WithCancel(ctx)
+	defer cancelScheduled()
+
+	opts := webhook.ReplayOptions{
+		URL:            url,
+		PreserveTiming: preserveTiming,
+		Speed:          speed,
+	}
+	// the recorded signatures don't match redacted bodies, or the secrets of another service
+	if len(cfg.Webhook.Secrets) > 0 {
+		opts.Secret = cfg.Webhook.Secrets[0]
+	}
+
+	var send webhook.SendFn
+	if url == "" {
+		handler, _, _, _, err := startHandler(ctxCancelScheduled, config.NewReloader(cfg, flags.reloadConfig), false)
+		if err != nil {
+			return err
+		}
+		opts.URL = "/webhook"
+		send = webhook.SendToHandler(handler)
+	} else {
+		send = webhook.SendToURL(&http.Client{Timeout: 30 * time.Second})
+	}
+
+	summary, err := webhook.Replay(ctx, in, send, opts)
+	slog.Info("replay summary", "sent", summary.Sent, "failed", summary.Failed)
+	if err == nil && summary.Failed > 0 {
+		err = fmt.Errorf("failed to replay %d webhooks", summary.Failed)
+	}
+
+	return err
+}